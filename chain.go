@@ -0,0 +1,235 @@
+package geche
+
+import (
+	"errors"
+	"iter"
+	"maps"
+	"sync"
+)
+
+// WritePolicy controls which levels of Chain are updated by writes.
+type WritePolicy int
+
+const (
+	// WriteAll sets the record in all levels.
+	WriteAll WritePolicy = iota
+	// WriteFirst sets the record in the first level only
+	// and deletes the old record from the rest of them.
+	WriteFirst
+	// WriteLast sets the record in the last level only
+	// and deletes the old record from the faster levels,
+	// so the next Get back-fills them.
+	WriteLast
+)
+
+// Chain is a wrapper for several Geche interface implementations (levels)
+// ordered from the fastest to the slowest, e.g. small local cache
+// in front of the shared Sharded cache in front of the Updater.
+// Get searches levels in order and copies the record found
+// to the faster levels (back-fill). Del and Clear are applied
+// to all levels, and Set is applied according to WritePolicy.
+// Levels usually hold copies of the same records, so Len and Snapshot
+// count every key once, and the value of the faster level takes precedence.
+type Chain[K comparable, V any] struct {
+	levels []Geche[K, V]
+	policy WritePolicy
+	// Get takes the read lock for the lookup and back-fill,
+	// so back-fill can't overwrite the newer record set concurrently.
+	mux sync.RWMutex
+}
+
+// NewChain creates Chain of levels with the given write policy.
+// Panics if no levels are given.
+func NewChain[K comparable, V any](policy WritePolicy, levels ...Geche[K, V]) *Chain[K, V] {
+	if len(levels) == 0 {
+		panic("chain must have at least one level")
+	}
+
+	return &Chain[K, V]{
+		levels: levels,
+		policy: policy,
+	}
+}
+
+// set writes the record according to the write policy.
+// Caller must hold the lock.
+func (c *Chain[K, V]) set(key K, value V) {
+	last := len(c.levels) - 1
+	for i, level := range c.levels {
+		switch {
+		case c.policy == WriteAll,
+			c.policy == WriteFirst && i == 0,
+			c.policy == WriteLast && i == last:
+			level.Set(key, value)
+		default:
+			_ = level.Del(key)
+		}
+	}
+}
+
+// get searches the levels for the key and back-fills faster levels.
+// Caller must hold the lock.
+func (c *Chain[K, V]) get(key K) (V, error) {
+	var (
+		v   V
+		err error
+	)
+	for i, level := range c.levels {
+		v, err = level.Get(key)
+		if err == nil {
+			for _, faster := range c.levels[:i] {
+				faster.Set(key, v)
+			}
+			return v, nil
+		}
+	}
+
+	return v, err
+}
+
+// Set writes the record to the levels according to the write policy.
+func (c *Chain[K, V]) Set(key K, value V) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.set(key, value)
+}
+
+// SetIfPresent sets the value only if the key is found in any level.
+// Lookup is the same as in Get, so if the last level is Updater,
+// it can load the record.
+func (c *Chain[K, V]) SetIfPresent(key K, value V) (V, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	old, err := c.get(key)
+	if err != nil {
+		return old, false
+	}
+
+	c.set(key, value)
+	return old, true
+}
+
+// SetIfAbsent sets the value only if the key is not found in any level.
+// Lookup is the same as in Get, so if the last level is Updater,
+// it can load the record.
+func (c *Chain[K, V]) SetIfAbsent(key K, value V) (V, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	old, err := c.get(key)
+	if err == nil {
+		return old, false
+	}
+
+	c.set(key, value)
+	return old, true
+}
+
+// Get returns the value from the first level that has the key,
+// and sets it to all faster levels. If the key is not found
+// in any level, the error returned by the last level is returned
+// (e.g. the error of Updater's update function).
+// Writes to the chain wait while Get searches the levels.
+func (c *Chain[K, V]) Get(key K) (V, error) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	return c.get(key)
+}
+
+// Del deletes the key from all levels.
+func (c *Chain[K, V]) Del(key K) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	var errs []error
+	for _, level := range c.levels {
+		errs = append(errs, level.Del(key))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Snapshot returns a shallow copy of records of all levels.
+// If the key is stored in several levels, the value of the fastest one is used.
+func (c *Chain[K, V]) Snapshot() map[K]V {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	s := c.levels[len(c.levels)-1].Snapshot()
+	for i := len(c.levels) - 2; i >= 0; i-- {
+		maps.Copy(s, c.levels[i].Snapshot())
+	}
+
+	return s
+}
+
+// Len returns the number of distinct keys in all levels.
+// Unless the chain has a single level, all keys are iterated.
+func (c *Chain[K, V]) Len() int {
+	if len(c.levels) == 1 {
+		return c.levels[0].Len()
+	}
+
+	n := 0
+	for range c.Keys() {
+		n++
+	}
+
+	return n
+}
+
+// Clear removes all records from all levels.
+func (c *Chain[K, V]) Clear() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, level := range c.levels {
+		level.Clear()
+	}
+}
+
+// All is an iterator over all key-value pairs of all levels.
+// Every key is yielded once, with the value of the fastest level that has it.
+// Records are not back-filled while iterating.
+// Iterator holds read lock for the whole iteration,
+// and locking rules of the levels apply.
+func (c *Chain[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c.mux.RLock()
+		defer c.mux.RUnlock()
+
+		var seen map[K]struct{}
+		if len(c.levels) > 1 {
+			seen = make(map[K]struct{})
+		}
+
+		for _, level := range c.levels {
+			for k, v := range all(level) {
+				if seen != nil {
+					if _, ok := seen[k]; ok {
+						continue
+					}
+					seen[k] = struct{}{}
+				}
+				if !yield(k, v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Keys is an iterator over all distinct keys of all levels.
+// Same rules as for All apply.
+func (c *Chain[K, V]) Keys() iter.Seq[K] {
+	return keysOf(c.All())
+}
+
+// Values is an iterator over values of all distinct keys of all levels.
+// Same rules as for All apply.
+func (c *Chain[K, V]) Values() iter.Seq[V] {
+	return valuesOf(c.All())
+}
@@ -0,0 +1,194 @@
+package geche
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func ExampleNewChain() {
+	local := NewMapCache[string, string]()
+	shared := NewMapCache[string, string]()
+	shared.Set("a", "shared")
+
+	c := NewChain(WriteAll, local, shared)
+
+	v, _ := c.Get("a") // Found in shared and copied to local.
+	fmt.Println(v, local.Len())
+
+	c.Set("b", "new")
+	fmt.Println(local.Len(), shared.Len(), c.Len())
+	// Output:
+	// shared 1
+	// 2 2 2
+}
+
+func TestChainBackfill(t *testing.T) {
+	l1 := NewMapCache[string, string]()
+	l2 := NewMapCache[string, string]()
+	l3 := NewMapCache[string, string]()
+	l3.Set("k", "v")
+
+	c := NewChain(WriteAll, l1, l2, l3)
+	if v, err := c.Get("k"); err != nil || v != "v" {
+		t.Fatalf("unexpected value %q, %v", v, err)
+	}
+	for i, l := range []Geche[string, string]{l1, l2} {
+		if v, err := l.Get("k"); err != nil || v != "v" {
+			t.Errorf("expected level %d to be back-filled, got %q, %v", i, v, err)
+		}
+	}
+
+	if _, err := c.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := c.Del("k"); err != nil {
+		t.Fatalf("unexpected error in Del: %v", err)
+	}
+	if l1.Len()+l2.Len()+l3.Len() != 0 {
+		t.Error("expected key to be deleted from all levels")
+	}
+
+	if !panics(func() { NewChain[string, string](WriteAll) }) {
+		t.Error("expected NewChain to panic without levels")
+	}
+}
+
+func TestChainWritePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy   WritePolicy
+		expected [3]string
+	}{
+		{WriteAll, [3]string{"new", "new", "new"}},
+		{WriteFirst, [3]string{"new", "", ""}},
+		{WriteLast, [3]string{"", "", "new"}},
+	} {
+		levels := []Geche[string, string]{
+			NewMapCache[string, string](),
+			NewMapCache[string, string](),
+			NewMapCache[string, string](),
+		}
+		for _, l := range levels {
+			l.Set("k", "old")
+		}
+
+		c := NewChain(tc.policy, levels...)
+		c.Set("k", "new")
+
+		for i, l := range levels {
+			if v, _ := l.Get("k"); v != tc.expected[i] {
+				t.Errorf("policy %d: expected %q in level %d, got %q", tc.policy, tc.expected[i], i, v)
+			}
+		}
+		if v, _ := c.Get("k"); v != "new" {
+			t.Errorf("policy %d: expected new value, got %q", tc.policy, v)
+		}
+	}
+}
+
+func TestChainSetIf(t *testing.T) {
+	l1 := NewMapCache[string, string]()
+	l2 := NewMapCache[string, string]()
+	l2.Set("k", "v")
+
+	c := NewChain(WriteFirst, l1, l2)
+	if old, ok := c.SetIfAbsent("k", "x"); ok || old != "v" {
+		t.Errorf("expected SetIfAbsent to find the key in the second level, got %q, %v", old, ok)
+	}
+	if old, ok := c.SetIfPresent("k", "new"); !ok || old != "v" {
+		t.Errorf("expected SetIfPresent to update the key, got %q, %v", old, ok)
+	}
+	if _, err := l2.Get("k"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected old record to be deleted from the second level, got %v", err)
+	}
+	if _, ok := c.SetIfPresent("missing", "x"); ok {
+		t.Error("expected SetIfPresent to skip missing key")
+	}
+}
+
+func TestChainUpdater(t *testing.T) {
+	errUpdate := errors.New("update failed")
+	calls := 0
+	u := NewCacheUpdater(NewMapCache[string, string](), func(key string) (string, error) {
+		calls++
+		if key == "bad" {
+			return "", errUpdate
+		}
+		return "loaded " + key, nil
+	}, 1)
+
+	local := NewMapCache[string, string]()
+	c := NewChain[string, string](WriteAll, local, u)
+
+	for i := 0; i < 3; i++ {
+		if v, err := c.Get("k"); err != nil || v != "loaded k" {
+			t.Fatalf("unexpected value %q, %v", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected one update call, got %d", calls)
+	}
+	if _, err := c.Get("bad"); !errors.Is(err, errUpdate) {
+		t.Errorf("expected update error, got %v", err)
+	}
+}
+
+func TestChainLenSnapshot(t *testing.T) {
+	l1 := NewMapCache[string, string]()
+	l2 := NewMapCache[string, string]()
+	l1.Set("a", "fast")
+	l1.Set("b", "fast")
+	l2.Set("b", "slow")
+	l2.Set("c", "slow")
+
+	c := NewChain(WriteAll, l1, l2)
+	expected := map[string]string{"a": "fast", "b": "fast", "c": "slow"}
+	if !maps.Equal(expected, c.Snapshot()) {
+		t.Errorf("expected %v, got %v", expected, c.Snapshot())
+	}
+	if c.Len() != 3 {
+		t.Errorf("expected 3 records, got %d", c.Len())
+	}
+	if !maps.Equal(expected, maps.Collect(c.All())) {
+		t.Errorf("expected %v, got %v", expected, maps.Collect(c.All()))
+	}
+	keys := slices.Sorted(c.Keys())
+	if !slices.Equal(keys, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
+
+func TestChainConcurrent(t *testing.T) {
+	l1 := NewRingBuffer[string, int](10)
+	l2 := NewMapCache[string, int]()
+	c := NewChain[string, int](WriteLast, l1, l2)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := strconv.Itoa(i % 20)
+				if w%2 == 0 {
+					c.Set(k, i)
+				} else {
+					_, _ = c.Get(k)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Back-fill must never overwrite newer values.
+	for k, v := range l1.Snapshot() {
+		if v2, _ := l2.Get(k); v != v2 {
+			t.Errorf("stale value of %q in the first level: %d, expected %d", k, v, v2)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package geche
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Codec serializes keys and values of the cache (see SaveTo and LoadFrom).
+// Append functions append encoded key or value to dst and return the extended slice.
+// Decode functions receive exactly the bytes produced by the append functions.
+type Codec[K, V any] interface {
+	AppendKey(dst []byte, key K) ([]byte, error)
+	DecodeKey(data []byte) (K, error)
+	AppendValue(dst []byte, value V) ([]byte, error)
+	DecodeValue(data []byte) (V, error)
+}
+
+// GobCodec encodes keys and values using encoding/gob.
+// Every key and value is encoded separately, so gob type information
+// is repeated for each of them. It is the most flexible, but the least
+// compact of the provided codecs.
+type GobCodec[K, V any] struct{}
+
+// NewGobCodec creates a new GobCodec.
+func NewGobCodec[K, V any]() GobCodec[K, V] {
+	return GobCodec[K, V]{}
+}
+
+func (GobCodec[K, V]) AppendKey(dst []byte, key K) ([]byte, error) {
+	return gobAppend(dst, key)
+}
+
+func (GobCodec[K, V]) DecodeKey(data []byte) (K, error) {
+	return gobDecode[K](data)
+}
+
+func (GobCodec[K, V]) AppendValue(dst []byte, value V) ([]byte, error) {
+	return gobAppend(dst, value)
+}
+
+func (GobCodec[K, V]) DecodeValue(data []byte) (V, error) {
+	return gobDecode[V](data)
+}
+
+func gobAppend[T any](dst []byte, v T) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return dst, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func gobDecode[T any](data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// JSONCodec encodes keys and values using encoding/json.
+type JSONCodec[K, V any] struct{}
+
+// NewJSONCodec creates a new JSONCodec.
+func NewJSONCodec[K, V any]() JSONCodec[K, V] {
+	return JSONCodec[K, V]{}
+}
+
+func (JSONCodec[K, V]) AppendKey(dst []byte, key K) ([]byte, error) {
+	return jsonAppend(dst, key)
+}
+
+func (JSONCodec[K, V]) DecodeKey(data []byte) (K, error) {
+	var k K
+	err := json.Unmarshal(data, &k)
+	return k, err
+}
+
+func (JSONCodec[K, V]) AppendValue(dst []byte, value V) ([]byte, error) {
+	return jsonAppend(dst, value)
+}
+
+func (JSONCodec[K, V]) DecodeValue(data []byte) (V, error) {
+	var v V
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+func jsonAppend[T any](dst []byte, v T) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return dst, err
+	}
+
+	return append(dst, b...), nil
+}
+
+// BinaryCodec encodes fixed-size types (numbers, bools, and arrays or structs
+// of them) using encoding/binary in little endian byte order.
+// Strings and byte slices (including named types based on them)
+// are stored as raw bytes, int and uint as 8 bytes.
+// Decoding data with trailing bytes returns an error.
+// It is the fastest and the most compact of the provided codecs.
+type BinaryCodec[K, V any] struct{}
+
+// NewBinaryCodec creates a new BinaryCodec.
+// Panics if K or V is neither fixed-size type, nor string, nor []byte.
+func NewBinaryCodec[K, V any]() BinaryCodec[K, V] {
+	var (
+		k K
+		v V
+	)
+	if !binaryEncodable(&k) {
+		panic("key type is not supported by BinaryCodec")
+	}
+	if !binaryEncodable(&v) {
+		panic("value type is not supported by BinaryCodec")
+	}
+
+	return BinaryCodec[K, V]{}
+}
+
+func binaryEncodable(p any) bool {
+	if binaryKind(reflect.ValueOf(p).Elem()) != reflect.Invalid {
+		return true
+	}
+
+	return binary.Size(p) >= 0
+}
+
+// binaryKind returns the kind of v if it is a string, a byte slice, int or uint,
+// which are not supported by encoding/binary. Returns reflect.Invalid otherwise.
+func binaryKind(v reflect.Value) reflect.Kind {
+	switch k := v.Kind(); k {
+	case reflect.String, reflect.Int, reflect.Uint:
+		return k
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return k
+		}
+	}
+
+	return reflect.Invalid
+}
+
+func (BinaryCodec[K, V]) AppendKey(dst []byte, key K) ([]byte, error) {
+	return binaryAppend(dst, &key)
+}
+
+func (BinaryCodec[K, V]) DecodeKey(data []byte) (K, error) {
+	var k K
+	err := binaryDecode(data, &k)
+	return k, err
+}
+
+func (BinaryCodec[K, V]) AppendValue(dst []byte, value V) ([]byte, error) {
+	return binaryAppend(dst, &value)
+}
+
+func (BinaryCodec[K, V]) DecodeValue(data []byte) (V, error) {
+	var v V
+	err := binaryDecode(data, &v)
+	return v, err
+}
+
+var errTrailingBytes = errors.New("trailing bytes after the encoded value")
+
+func binaryAppend(dst []byte, p any) ([]byte, error) {
+	v := reflect.ValueOf(p).Elem()
+	switch binaryKind(v) {
+	case reflect.String:
+		return append(dst, v.String()...), nil
+	case reflect.Slice:
+		return append(dst, v.Bytes()...), nil
+	case reflect.Int:
+		return binary.LittleEndian.AppendUint64(dst, uint64(v.Int())), nil
+	case reflect.Uint:
+		return binary.LittleEndian.AppendUint64(dst, v.Uint()), nil
+	}
+
+	return binary.Append(dst, binary.LittleEndian, p)
+}
+
+func binaryDecode(data []byte, p any) error {
+	v := reflect.ValueOf(p).Elem()
+	switch binaryKind(v) {
+	case reflect.String:
+		v.SetString(string(data))
+		return nil
+	case reflect.Slice:
+		v.SetBytes(bytes.Clone(data))
+		return nil
+	case reflect.Int, reflect.Uint:
+		if len(data) < 8 {
+			return io.ErrUnexpectedEOF
+		}
+		if len(data) > 8 {
+			return fmt.Errorf("%w: %d bytes", errTrailingBytes, len(data)-8)
+		}
+		if v.Kind() == reflect.Int {
+			v.SetInt(int64(binary.LittleEndian.Uint64(data)))
+		} else {
+			v.SetUint(binary.LittleEndian.Uint64(data))
+		}
+		return nil
+	}
+
+	n, err := binary.Decode(data, binary.LittleEndian, p)
+	if err == nil && n < len(data) {
+		err = fmt.Errorf("%w: %d bytes", errTrailingBytes, len(data)-n)
+	}
+	return err
+}
@@ -253,6 +253,71 @@ func testClear(t *testing.T, imp Geche[string, string]) {
 	}
 }
 
+func testIterable(t *testing.T, imp Geche[string, string]) {
+	it, ok := imp.(Iterable[string, string])
+	if !ok {
+		t.Skip("cache does not implement Iterable")
+	}
+
+	expected := map[string]string{}
+	for i := 0; i < 50; i++ {
+		s := strconv.Itoa(i)
+		imp.Set(s, "v"+s)
+		expected[s] = "v" + s
+	}
+	for _, i := range []int{0, 7, 42} {
+		s := strconv.Itoa(i)
+		_ = imp.Del(s)
+		delete(expected, s)
+	}
+
+	got := map[string]string{}
+	for k, v := range it.All() {
+		if _, ok := got[k]; ok {
+			t.Errorf("key %q yielded twice", k)
+		}
+		got[k] = v
+	}
+
+	keys := map[string]struct{}{}
+	for k := range it.Keys() {
+		keys[k] = struct{}{}
+	}
+
+	values := map[string]struct{}{}
+	for v := range it.Values() {
+		values[v] = struct{}{}
+	}
+
+	if len(got) != len(expected) || len(keys) != len(expected) || len(values) != len(expected) {
+		t.Fatalf("expected %d records, got %d pairs, %d keys, %d values",
+			len(expected), len(got), len(keys), len(values))
+	}
+
+	for k, v := range expected {
+		if got[k] != v {
+			t.Errorf("expected value %q for key %q, got %q", v, k, got[k])
+		}
+		if _, ok := keys[k]; !ok {
+			t.Errorf("key %q not found in Keys", k)
+		}
+		if _, ok := values[v]; !ok {
+			t.Errorf("value %q not found in Values", v)
+		}
+	}
+
+	n := 0
+	for range it.All() {
+		n++
+		if n == 5 {
+			break
+		}
+	}
+	if n != 5 {
+		t.Errorf("expected iteration to stop after 5 records, got %d", n)
+	}
+}
+
 // TestCommon runs a common set of tests on all implementations of Geche interface.
 func TestCommon(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -300,6 +365,31 @@ func TestCommon(t *testing.T) {
 		{"LockerKVCache", func() Geche[string, string] {
 			return NewLocker(NewKVCache[string, string]()).Lock()
 		}},
+		{"OptimisticMapCache", func() Geche[string, string] {
+			return NewOptimistic(NewMapCache[string, string]())
+		}},
+		{"DiskCache", func() Geche[string, string] {
+			c, err := NewDiskCache(ctx, t.TempDir(), NewBinaryCodec[string, string](), DiskCacheOptions{SegmentSize: 256})
+			if err != nil {
+				t.Fatalf("unexpected error in NewDiskCache: %v", err)
+			}
+			return c
+		}},
+		{"Tiered", func() Geche[string, string] {
+			c, err := NewTiered(ctx, NewRingBuffer[string, string](10), t.TempDir(), NewBinaryCodec[string, string](), DiskCacheOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error in NewTiered: %v", err)
+			}
+			return c
+		}},
+		{"TaggedRingBuffer", func() Geche[string, string] { return NewTagged(NewRingBuffer[string, string](100)) }},
+		{"WatchedRingBuffer", func() Geche[string, string] { return NewWatched(NewRingBuffer[string, string](100)) }},
+		{"Chain", func() Geche[string, string] {
+			return NewChain(WriteAll, NewMapCache[string, string](), NewMapCache[string, string]())
+		}},
+		{"ChainWriteLast", func() Geche[string, string] {
+			return NewChain[string, string](WriteLast, NewRingBuffer[string, string](10), NewMapCache[string, string]())
+		}},
 		{
 			"ShardedKVCache", func() Geche[string, string] {
 				return NewSharded(
@@ -325,6 +415,7 @@ func TestCommon(t *testing.T) {
 		{"SetSetIfAbsentGet", testSetThenSetIfAbsentThenGet},
 		{"SetIfAbsentGet", testSetIfAbsentThenGet},
 		{"Clear", testClear},
+		{"Iterable", testIterable},
 	}
 	for _, ci := range caches {
 		for _, tc := range tab {
@@ -355,6 +446,17 @@ func TestConcurrentFuzz(t *testing.T) {
 		{"LockerMapCache", func() Geche[string, string] {
 			return NewLocker(NewMapCache[string, string]()).Lock()
 		}},
+		{"OptimisticMapCache", func() Geche[string, string] {
+			return NewOptimistic(NewMapCache[string, string]())
+		}},
+		{"TaggedMapCache", func() Geche[string, string] { return NewTagged(NewMapCache[string, string]()) }},
+		{"WatchedMapCache", func() Geche[string, string] { return NewWatched(NewMapCache[string, string]()) }},
+		{"WriteThrough", func() Geche[string, string] {
+			return NewWriteThrough[string, string](NewMapCache[string, string](), newTestStore(), numWorkers)
+		}},
+		{"WriteBehind", func() Geche[string, string] {
+			return NewWriteBehind[string, string](t.Context(), NewMapCache[string, string](), newTestStore(), WriteBehindOptions[string]{})
+		}},
 		{
 			"ShardedMapCache", func() Geche[string, string] {
 				return NewSharded(
@@ -0,0 +1,694 @@
+package geche
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	diskSegmentPrefix = "disk-"
+	diskSegmentSuffix = ".seg"
+
+	defaultDiskSegmentSize = 64 << 20
+	defaultDiskGCInterval  = time.Minute
+	defaultDiskGCRatio     = 0.5
+)
+
+var errDiskCacheClosed = errors.New("disk cache is closed")
+
+// DiskCacheOptions configures DiskCache. Zero value is valid.
+type DiskCacheOptions struct {
+	// SegmentSize is the size of the segment file, after which
+	// the next segment is started. Default is 64MiB.
+	SegmentSize int64
+	// MaxSize limits the total size of segment files. When it is exceeded,
+	// the oldest segment is removed along with all its records, so the cache
+	// can't be smaller than one segment. Zero means no limit.
+	MaxSize int64
+	// GCInterval is the interval of background garbage collection
+	// (see DiskCache.GC). Default is 1 minute, negative value disables it.
+	GCInterval time.Duration
+	// GCRatio is the share of overwritten and deleted records in the segment,
+	// after which the segment is garbage collected. Default is 0.5.
+	GCRatio float64
+}
+
+// diskLoc is the location of the record in the segment files.
+type diskLoc struct {
+	seg  uint64
+	off  int64
+	size int64
+}
+
+type diskSegment struct {
+	f    *os.File
+	size int64
+	// live is the total size of the records that are still in the index.
+	live int64
+}
+
+// diskDropped is a segment removed from the cache
+// with records that were still alive in it.
+type diskDropped[K comparable] struct {
+	num  uint64
+	seg  *diskSegment
+	keys []K
+	locs []diskLoc
+}
+
+// DiskCache stores records in the local files, so it can hold
+// much more data than fits into memory. Only the index of keys
+// is kept in memory. Records are appended to segment files (using the same
+// record format as Durable log), and segments where most records were
+// overwritten or deleted are garbage collected in the background: their live
+// records are moved to the current segment, and the files are removed.
+// DiskCache is not persistent: segment files left by the previous run in dir
+// are removed when the cache is created, and Close removes all files.
+// Every Get reads and decodes the record, so it is much slower than in-memory
+// caches and is intended to be used as the second level of Tiered cache.
+// If writing to the disk fails, records are not stored anymore, and the error
+// is returned by Err and Close. Records that can't be encoded by the codec
+// are not stored as well.
+type DiskCache[K comparable, V any] struct {
+	codec Codec[K, V]
+	opts  DiskCacheOptions
+	dir   string
+
+	mux      sync.RWMutex
+	index    map[K]diskLoc
+	segments map[uint64]*diskSegment
+	head     uint64
+	size     int64
+	buf      []byte
+	payload  []byte
+	err      error
+	removals removals[K, V]
+
+	// gcMux allows only one garbage collection at a time.
+	gcMux sync.Mutex
+}
+
+// NewDiskCache creates the directory if needed, removes segment files
+// left there by the previous run, and returns an empty DiskCache.
+// Codec is used to serialize keys and values.
+// Background goroutine that garbage collects segments runs until ctx is canceled.
+func NewDiskCache[K comparable, V any](
+	ctx context.Context,
+	dir string,
+	codec Codec[K, V],
+	opts DiskCacheOptions,
+) (*DiskCache[K, V], error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultDiskSegmentSize
+	}
+	if opts.GCInterval == 0 {
+		opts.GCInterval = defaultDiskGCInterval
+	}
+	if opts.GCRatio <= 0 {
+		opts.GCRatio = defaultDiskGCRatio
+	}
+
+	c := DiskCache[K, V]{
+		codec:    codec,
+		opts:     opts,
+		dir:      dir,
+		index:    make(map[K]diskLoc),
+		segments: make(map[uint64]*diskSegment),
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := removeDiskSegments(dir); err != nil {
+		return nil, err
+	}
+	if err := c.openSegment(0); err != nil {
+		return nil, err
+	}
+
+	if opts.GCInterval > 0 {
+		go func(ctx context.Context) {
+			t := time.NewTicker(opts.GCInterval)
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					_ = c.GC()
+				}
+			}
+		}(ctx)
+	}
+
+	return &c, nil
+}
+
+func diskSegmentName(n uint64) string {
+	return fmt.Sprintf("%s%020d%s", diskSegmentPrefix, n, diskSegmentSuffix)
+}
+
+// removeDiskSegments removes all segment files in the directory.
+func removeDiskSegments(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, diskSegmentPrefix) && strings.HasSuffix(name, diskSegmentSuffix) {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// OnEvict adds a callback function that will be called when a record is
+// removed because the total size of segments exceeded MaxSize.
+// The callback is called outside of the cache lock.
+// Note that the eviction callback is not called for Del and Clear operations.
+func (c *DiskCache[K, V]) OnEvict(f func(key K, value V)) {
+	c.listenEvict(f)
+}
+
+func (c *DiskCache[K, V]) listenEvict(f func(key K, value V)) {
+	c.mux.Lock()
+	c.removals.listenEvict(f)
+	c.mux.Unlock()
+}
+
+// OnRemove adds a callback function that will be called when a record is
+// removed from the cache: evicted because of MaxSize, replaced by Set
+// or SetIfPresent, deleted, cleared or removed by Close.
+// Removed values are read from the disk, records that can't be read are skipped.
+// The callback is called outside of the cache lock.
+func (c *DiskCache[K, V]) OnRemove(f func(key K, value V, cause RemovalCause)) {
+	c.mux.Lock()
+	c.removals.listenAll(f)
+	c.mux.Unlock()
+}
+
+// unlock releases the write lock, notifies listeners about records
+// removed while it was held, and releases dropped segments.
+func (c *DiskCache[K, V]) unlock(dropped []diskDropped[K]) {
+	removed := c.removals.take()
+	c.mux.Unlock()
+	c.release(dropped, removed)
+}
+
+// removed reads the value of the key removed for the cause
+// and collects it for listeners. Caller must hold the lock.
+func (c *DiskCache[K, V]) removed(key K, cause RemovalCause) {
+	if !c.removals.wants(cause) {
+		return
+	}
+
+	if value, err := c.get(key); err == nil {
+		c.removals.add(key, value, cause)
+	}
+}
+
+// openSegment creates a new segment and makes it current.
+// Caller must hold the lock.
+func (c *DiskCache[K, V]) openSegment(n uint64) error {
+	f, err := os.OpenFile(filepath.Join(c.dir, diskSegmentName(n)), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	c.segments[n] = &diskSegment{f: f}
+	c.head = n
+
+	return nil
+}
+
+// removeSegment closes and removes the segment file.
+func (c *DiskCache[K, V]) removeSegment(n uint64, seg *diskSegment) error {
+	_ = seg.f.Close()
+	return os.Remove(filepath.Join(c.dir, diskSegmentName(n)))
+}
+
+// drop removes the segment and all its records from the index.
+// Caller must hold the lock.
+func (c *DiskCache[K, V]) drop(n uint64) diskDropped[K] {
+	seg := c.segments[n]
+	delete(c.segments, n)
+	c.size -= seg.size
+
+	d := diskDropped[K]{num: n, seg: seg}
+	for key, loc := range c.index {
+		if loc.seg == n {
+			d.keys = append(d.keys, key)
+			d.locs = append(d.locs, loc)
+			delete(c.index, key)
+		}
+	}
+
+	return d
+}
+
+// release notifies listeners about removed records and records of dropped segments,
+// and removes segment files. Must be called without holding the lock.
+func (c *DiskCache[K, V]) release(dropped []diskDropped[K], removed removalBatch[K, V]) {
+	removed.notify()
+
+	for _, d := range dropped {
+		if removed.wants(RemovalEvicted) {
+			// Read records in the order they were written.
+			order := make([]int, len(d.keys))
+			for i := range order {
+				order[i] = i
+			}
+			slices.SortFunc(order, func(a, b int) int {
+				return cmp.Compare(d.locs[a].off, d.locs[b].off)
+			})
+
+			for _, i := range order {
+				value, err := c.read(d.seg, d.locs[i])
+				if err != nil {
+					continue
+				}
+				removed.call(d.keys[i], value, RemovalEvicted)
+			}
+		}
+
+		if err := c.removeSegment(d.num, d.seg); err != nil {
+			c.mux.Lock()
+			if c.err == nil {
+				c.err = err
+			}
+			c.mux.Unlock()
+		}
+	}
+}
+
+// read reads and decodes the value of the record at loc.
+func (c *DiskCache[K, V]) read(seg *diskSegment, loc diskLoc) (V, error) {
+	var zeroV V
+
+	b := make([]byte, loc.size)
+	if _, err := seg.f.ReadAt(b, loc.off); err != nil {
+		return zeroV, err
+	}
+
+	size := binary.LittleEndian.Uint32(b[0:])
+	sum := binary.LittleEndian.Uint32(b[4:])
+	payload := b[8:]
+	if int(size) != len(payload) || crc32.Checksum(payload, crcTable) != sum {
+		return zeroV, fmt.Errorf("%w: checksum mismatch", ErrCorruptLog)
+	}
+
+	_, payload, ok := readChunk(payload)
+	if !ok {
+		return zeroV, fmt.Errorf("%w: malformed record", ErrCorruptLog)
+	}
+	vb, _, ok := readChunk(payload)
+	if !ok {
+		return zeroV, fmt.Errorf("%w: malformed record", ErrCorruptLog)
+	}
+
+	return c.codec.DecodeValue(vb)
+}
+
+// get reads the value of the key. Caller must hold the lock.
+func (c *DiskCache[K, V]) get(key K) (V, error) {
+	loc, ok := c.index[key]
+	if !ok {
+		var zeroV V
+		return zeroV, ErrNotFound
+	}
+
+	return c.read(c.segments[loc.seg], loc)
+}
+
+// del removes the key from the index. Caller must hold the lock.
+func (c *DiskCache[K, V]) del(key K) {
+	loc, ok := c.index[key]
+	if !ok {
+		return
+	}
+
+	delete(c.index, key)
+	c.segments[loc.seg].live -= loc.size
+}
+
+// set writes the record to the current segment. Caller must hold the lock.
+// Returns segments dropped because MaxSize was exceeded.
+func (c *DiskCache[K, V]) set(key K, value V) []diskDropped[K] {
+	c.removed(key, RemovalReplaced)
+
+	if c.err != nil {
+		c.del(key)
+		return nil
+	}
+
+	var err error
+	c.payload, err = appendKeyChunk(c.payload[:0], c.codec, key)
+	if err == nil {
+		c.payload, err = appendValueChunk(c.payload, c.codec, value)
+	}
+	if err != nil {
+		c.del(key)
+		return nil
+	}
+
+	c.buf = appendWALRecord(c.buf[:0], c.payload)
+	return c.write(key, c.buf)
+}
+
+// write appends the framed record of the key to the current segment.
+// Caller must hold the lock.
+func (c *DiskCache[K, V]) write(key K, rec []byte) []diskDropped[K] {
+	c.del(key)
+
+	head := c.segments[c.head]
+	if head.size > 0 && head.size+int64(len(rec)) > c.opts.SegmentSize {
+		if err := c.openSegment(c.head + 1); err != nil {
+			c.err = err
+			return nil
+		}
+		head = c.segments[c.head]
+	}
+
+	if _, err := head.f.WriteAt(rec, head.size); err != nil {
+		c.err = err
+		return nil
+	}
+
+	loc := diskLoc{seg: c.head, off: head.size, size: int64(len(rec))}
+	c.index[key] = loc
+	head.size += loc.size
+	head.live += loc.size
+	c.size += loc.size
+
+	var dropped []diskDropped[K]
+	for c.opts.MaxSize > 0 && c.size > c.opts.MaxSize && len(c.segments) > 1 {
+		dropped = append(dropped, c.drop(c.oldest()))
+	}
+
+	return dropped
+}
+
+// oldest returns the number of the oldest segment. Caller must hold the lock.
+func (c *DiskCache[K, V]) oldest() uint64 {
+	n := c.head
+	for s := range c.segments {
+		n = min(n, s)
+	}
+
+	return n
+}
+
+// Set writes the record to the disk.
+func (c *DiskCache[K, V]) Set(key K, value V) {
+	c.mux.Lock()
+	c.unlock(c.set(key, value))
+}
+
+// SetIfPresent sets the value only if the key already exists.
+func (c *DiskCache[K, V]) SetIfPresent(key K, value V) (V, bool) {
+	c.mux.Lock()
+	old, err := c.get(key)
+	if err != nil {
+		c.mux.Unlock()
+		return old, false
+	}
+
+	c.unlock(c.set(key, value))
+	return old, true
+}
+
+// SetIfAbsent sets the value only if the key does not exist yet.
+// Records that can't be read are overwritten.
+func (c *DiskCache[K, V]) SetIfAbsent(key K, value V) (V, bool) {
+	c.mux.Lock()
+	old, err := c.get(key)
+	if err == nil {
+		c.mux.Unlock()
+		return old, false
+	}
+
+	c.unlock(c.set(key, value))
+	return old, true
+}
+
+// Get reads the value from the disk. Returns ErrNotFound if the key
+// does not exist, and ErrCorruptLog if the record is corrupted.
+func (c *DiskCache[K, V]) Get(key K) (V, error) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	return c.get(key)
+}
+
+// Del removes the record from the index. Disk space is
+// reclaimed when the segment is garbage collected.
+func (c *DiskCache[K, V]) Del(key K) error {
+	c.mux.Lock()
+	defer c.unlock(nil)
+
+	c.removed(key, RemovalDeleted)
+	c.del(key)
+	return nil
+}
+
+// Snapshot reads all records from the disk, so it is a slow operation.
+// Records that can't be read are skipped.
+func (c *DiskCache[K, V]) Snapshot() map[K]V {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	snapshot := make(map[K]V, len(c.index))
+	for key, loc := range c.index {
+		if value, err := c.read(c.segments[loc.seg], loc); err == nil {
+			snapshot[key] = value
+		}
+	}
+
+	return snapshot
+}
+
+// Len returns the number of records in the cache.
+func (c *DiskCache[K, V]) Len() int {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	return len(c.index)
+}
+
+// Clear removes all records and segment files.
+func (c *DiskCache[K, V]) Clear() {
+	c.mux.Lock()
+	defer c.unlock(nil)
+
+	c.clear()
+	if c.err == nil {
+		c.err = c.openSegment(c.head + 1)
+	}
+}
+
+// clear removes all segments. Caller must hold the lock.
+func (c *DiskCache[K, V]) clear() {
+	if c.removals.wants(RemovalCleared) {
+		for key := range c.index {
+			c.removed(key, RemovalCleared)
+		}
+	}
+
+	for n, seg := range c.segments {
+		if err := c.removeSegment(n, seg); err != nil && c.err == nil {
+			c.err = err
+		}
+	}
+
+	clear(c.segments)
+	clear(c.index)
+	c.size = 0
+}
+
+// All is an iterator over all key-value pairs in the cache.
+// Every value is read from the disk, and records that can't be read are skipped.
+// Iteration order is not specified.
+// Iterator holds read lock for the whole iteration.
+func (c *DiskCache[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c.mux.RLock()
+		defer c.mux.RUnlock()
+
+		for key, loc := range c.index {
+			value, err := c.read(c.segments[loc.seg], loc)
+			if err != nil {
+				continue
+			}
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// Keys is an iterator over all keys in the cache.
+// It does not read the disk.
+// Iterator holds read lock for the whole iteration.
+func (c *DiskCache[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		c.mux.RLock()
+		defer c.mux.RUnlock()
+
+		for key := range c.index {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// Values is an iterator over all values in the cache.
+// Same rules as for All apply.
+func (c *DiskCache[K, V]) Values() iter.Seq[V] {
+	return valuesOf(c.All())
+}
+
+// Size returns the total size of segment files in bytes.
+func (c *DiskCache[K, V]) Size() int64 {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	return c.size
+}
+
+// Err returns the error that stopped writing to the disk, if any.
+func (c *DiskCache[K, V]) Err() error {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	return c.err
+}
+
+// GC moves live records from the segments, where the share of overwritten
+// and deleted records is at least GCRatio, to the current segment
+// and removes those segments. It is called periodically by
+// the background goroutine, but can be called manually as well.
+// Segment is read without holding the lock, and each moved record
+// is locked separately, so GC does not block the cache for long.
+func (c *DiskCache[K, V]) GC() error {
+	c.gcMux.Lock()
+	defer c.gcMux.Unlock()
+
+	c.mux.RLock()
+	var candidates []uint64
+	for n, seg := range c.segments {
+		if n != c.head && float64(seg.size-seg.live) >= c.opts.GCRatio*float64(seg.size) {
+			candidates = append(candidates, n)
+		}
+	}
+	err := c.err
+	c.mux.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	slices.Sort(candidates)
+	for _, n := range candidates {
+		if err := c.collect(n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collect moves live records of the segment to the current
+// segment and removes the segment file.
+func (c *DiskCache[K, V]) collect(n uint64) error {
+	c.mux.RLock()
+	seg, ok := c.segments[n]
+	c.mux.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	// Segments other than the current one are not modified,
+	// so it is safe to read it without the lock.
+	var off int64
+	_, err := readWALSegment(bufio.NewReader(io.NewSectionReader(seg.f, 0, seg.size)), func(payload []byte) error {
+		loc := diskLoc{seg: n, off: off, size: int64(len(payload)) + 8}
+		off += loc.size
+
+		kb, _, ok := readChunk(payload)
+		if !ok {
+			return fmt.Errorf("%w: malformed record", ErrCorruptLog)
+		}
+		key, err := c.codec.DecodeKey(kb)
+		if err != nil {
+			return err
+		}
+
+		c.mux.Lock()
+		var dropped []diskDropped[K]
+		if c.err == nil && c.index[key] == loc {
+			c.buf = appendWALRecord(c.buf[:0], payload)
+			dropped = c.write(key, c.buf)
+		}
+		c.unlock(dropped)
+		return nil
+	})
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.segments[n] != seg {
+		// Segment was removed by eviction or Clear while it was collected.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if seg.live == 0 {
+		delete(c.segments, n)
+		c.size -= seg.size
+		return c.removeSegment(n, seg)
+	}
+
+	return c.err
+}
+
+// Close removes all records and segment files.
+// The cache does not store records after Close.
+// Background goroutine is stopped by canceling the context passed to NewDiskCache.
+func (c *DiskCache[K, V]) Close() error {
+	c.mux.Lock()
+	defer c.unlock(nil)
+
+	if errors.Is(c.err, errDiskCacheClosed) {
+		return nil
+	}
+
+	err := c.err
+	c.clear()
+	if err == nil {
+		err = c.err
+	}
+	c.err = errDiskCacheClosed
+
+	return err
+}
@@ -0,0 +1,142 @@
+package geche
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func newTestDiskCache(t *testing.T, opts DiskCacheOptions) *DiskCache[string, string] {
+	t.Helper()
+
+	c, err := NewDiskCache(t.Context(), t.TempDir(), NewBinaryCodec[string, string](), opts)
+	if err != nil {
+		t.Fatalf("unexpected error in NewDiskCache: %v", err)
+	}
+
+	return c
+}
+
+func TestDiskCacheGC(t *testing.T) {
+	c := newTestDiskCache(t, DiskCacheOptions{SegmentSize: 256, GCInterval: -1})
+
+	for i := 0; i < 100; i++ {
+		c.Set(strconv.Itoa(i%10), fmt.Sprintf("value %d", i))
+	}
+	_ = c.Del("0")
+
+	before := c.Size()
+	if err := c.GC(); err != nil {
+		t.Fatalf("unexpected error in GC: %v", err)
+	}
+	if c.Size() >= before/2 {
+		t.Errorf("expected GC to reclaim most of %d bytes, got %d", before, c.Size())
+	}
+
+	c.mux.RLock()
+	segments := len(c.segments)
+	c.mux.RUnlock()
+	files, _ := os.ReadDir(c.dir)
+	if len(files) != segments {
+		t.Errorf("expected %d segment files, got %d", segments, len(files))
+	}
+
+	if c.Len() != 9 {
+		t.Errorf("expected 9 records, got %d", c.Len())
+	}
+	for i := 1; i < 10; i++ {
+		v, err := c.Get(strconv.Itoa(i))
+		if err != nil || v != fmt.Sprintf("value %d", 90+i) {
+			t.Errorf("unexpected value of %d after GC: %q, %v", i, v, err)
+		}
+	}
+}
+
+func TestDiskCacheMaxSize(t *testing.T) {
+	c := newTestDiskCache(t, DiskCacheOptions{SegmentSize: 100, MaxSize: 300, GCInterval: -1})
+
+	var evicted []string
+	c.OnEvict(func(key, value string) {
+		if key != value {
+			t.Errorf("unexpected evicted record %q: %q", key, value)
+		}
+		evicted = append(evicted, key)
+	})
+
+	for i := 0; i < 100; i++ {
+		s := fmt.Sprintf("%03d", i)
+		c.Set(s, s)
+	}
+
+	if c.Size() > 300 {
+		t.Errorf("expected size to be at most 300, got %d", c.Size())
+	}
+	if len(evicted)+c.Len() != 100 {
+		t.Fatalf("expected %d evicted records, got %d", 100-c.Len(), len(evicted))
+	}
+	for i, key := range evicted {
+		if key != fmt.Sprintf("%03d", i) {
+			t.Fatalf("expected oldest records to be evicted first, got %v", evicted)
+		}
+		if _, err := c.Get(key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected evicted key %q to be removed, got %v", key, err)
+		}
+	}
+}
+
+func TestDiskCacheCorrupt(t *testing.T) {
+	c := newTestDiskCache(t, DiskCacheOptions{GCInterval: -1})
+	c.Set("key", "value")
+
+	name := filepath.Join(c.dir, diskSegmentName(c.head))
+	b, _ := os.ReadFile(name)
+	b[len(b)-1] ^= 1
+	_ = os.WriteFile(name, b, 0o644)
+
+	if _, err := c.Get("key"); !errors.Is(err, ErrCorruptLog) {
+		t.Errorf("expected ErrCorruptLog, got %v", err)
+	}
+
+	// Corrupted record is overwritten.
+	if _, ok := c.SetIfAbsent("key", "new"); !ok {
+		t.Error("expected SetIfAbsent to overwrite corrupted record")
+	}
+	if v, err := c.Get("key"); err != nil || v != "new" {
+		t.Errorf("unexpected value %q, %v", v, err)
+	}
+}
+
+func TestDiskCacheClose(t *testing.T) {
+	dir := t.TempDir()
+	// Leftover from the previous run.
+	_ = os.WriteFile(filepath.Join(dir, diskSegmentName(7)), []byte("garbage"), 0o644)
+
+	c, err := NewDiskCache(t.Context(), dir, NewBinaryCodec[string, string](), DiskCacheOptions{SegmentSize: 64})
+	if err != nil {
+		t.Fatalf("unexpected error in NewDiskCache: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), "value")
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected error in Close: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("expected second Close to succeed, got %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected all files to be removed, got %d", len(files))
+	}
+
+	c.Set("a", "b")
+	if _, err := c.Get("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected record not to be stored after Close, got %v", err)
+	}
+	if !errors.Is(c.Err(), errDiskCacheClosed) {
+		t.Errorf("expected errDiskCacheClosed, got %v", c.Err())
+	}
+}
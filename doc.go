@@ -2,7 +2,10 @@
 // using Go generics (requires go 1.18+).
 package geche
 
-import "errors"
+import (
+	"errors"
+	"iter"
+)
 
 var ErrNotFound = errors.New("not found")
 
@@ -20,3 +23,38 @@ type Geche[K comparable, V any] interface {
 	// Clear removes all elements from the cache.
 	Clear()
 }
+
+// Iterable is an optional interface implemented by caches and wrappers
+// that can iterate over their records without copying the whole cache
+// (unlike Snapshot). Unless stated otherwise, iterators hold the read lock
+// for the whole iteration, so attempt to modify the cache while iterating
+// will lead to a deadlock.
+type Iterable[K comparable, V any] interface {
+	// All returns an iterator over key-value pairs.
+	All() iter.Seq2[K, V]
+	// Keys returns an iterator over keys.
+	Keys() iter.Seq[K]
+	// Values returns an iterator over values.
+	Values() iter.Seq[V]
+}
+
+// EvictionNotifier is an optional interface implemented by caches
+// that can remove records on their own (e.g. on TTL expiration or when
+// capacity is exceeded). Wrappers like KV subscribe to it to keep their
+// own indexes consistent with the underlying cache.
+type EvictionNotifier[K comparable, V any] interface {
+	// OnEvict registers a callback function that will be called
+	// outside of the cache lock for each evicted record.
+	// MapTTLCache replaces the previous callback, other caches add callbacks.
+	OnEvict(f func(key K, value V))
+}
+
+// RemovalNotifier is an optional interface implemented by caches
+// that report every removed record along with the cause of removal:
+// expiration, eviction, replacement by the new value, Del or Clear.
+// It allows to release resources held by values (e.g. close files or connections).
+type RemovalNotifier[K comparable, V any] interface {
+	// OnRemove adds a callback function that will be called
+	// outside of the cache lock for each removed record.
+	OnRemove(f func(key K, value V, cause RemovalCause))
+}
@@ -0,0 +1,604 @@
+package geche
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SyncPolicy controls how often Durable calls fsync on the log file.
+type SyncPolicy int
+
+const (
+	// SyncAlways calls fsync after every write. Acknowledged writes survive
+	// both process and machine crash, but it is the slowest policy.
+	SyncAlways SyncPolicy = iota
+	// SyncPeriodic calls fsync every DurableOptions.SyncInterval,
+	// so writes of the last interval can be lost if the machine crashes.
+	SyncPeriodic
+	// SyncNever leaves flushing to the OS. Writes survive process crash,
+	// but not the machine crash.
+	SyncNever
+)
+
+const (
+	defaultWALSyncInterval = 100 * time.Millisecond
+	defaultWALSegmentSize  = 64 << 20
+)
+
+// DurableOptions configures Durable. Zero value is valid.
+type DurableOptions struct {
+	// Sync is the fsync policy, SyncAlways by default.
+	Sync SyncPolicy
+	// SyncInterval is the fsync interval for SyncPeriodic policy.
+	// Default is 100ms.
+	SyncInterval time.Duration
+	// SegmentSize is the size of the log segment, after which
+	// the next segment is started. Default is 64MiB.
+	SegmentSize int64
+	// CompactInterval is the interval of automatic log compaction
+	// (see Durable.Compact). Zero disables automatic compaction.
+	CompactInterval time.Duration
+}
+
+var errDurableClosed = errors.New("durable cache is closed")
+
+// Durable is a wrapper for any Geche interface implementation that makes
+// the cache survive crashes. Every Set, Del and Clear is appended to
+// the write-ahead log in dir before it is applied to the cache, and
+// the log is replayed when Durable is created. Log is split into segments,
+// and Compact writes a snapshot of the cache (see SaveTo) and removes
+// segments included in it, so the log does not grow forever.
+// Records evicted or expired by the underlying cache are not logged:
+// replay reproduces evictions, and records of MapTTLCache keep their
+// original write time.
+// If writing to the log fails, the cache is still updated, but nothing is
+// logged anymore, and the error is returned by Err, Del, Sync, Compact and Close.
+type Durable[K comparable, V any] struct {
+	cache Geche[K, V]
+	codec Codec[K, V]
+	opts  DurableOptions
+	dir   string
+
+	// mux serializes writes to the cache and to the log,
+	// so they are applied in the same order.
+	mux     sync.Mutex
+	seg     *os.File
+	segNum  uint64
+	segSize int64
+	dirty   bool
+	buf     []byte
+	payload []byte
+	err     error
+
+	// compactMux allows only one compaction at a time.
+	compactMux sync.Mutex
+}
+
+// timedSetter is implemented by caches which records expire (MapTTLCache),
+// so records replayed from the log keep their original write time.
+type timedSetter[K comparable, V any] interface {
+	setAt(key K, value V, ts time.Time)
+}
+
+// NewDurable creates the log directory if needed, replays the latest snapshot
+// and the log into the cache, and returns the cache wrapped with Durable.
+// Cache should be empty. Codec is used to serialize keys and values.
+// Background goroutine that syncs (for SyncPeriodic) and compacts
+// (if CompactInterval is set) the log runs until ctx is canceled.
+// Incomplete record at the end of the last segment (e.g. if the process
+// crashed in the middle of the write) is discarded, but corruption anywhere
+// else causes ErrCorruptLog.
+func NewDurable[K comparable, V any](
+	ctx context.Context,
+	dir string,
+	cache Geche[K, V],
+	codec Codec[K, V],
+	opts DurableOptions,
+) (*Durable[K, V], error) {
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = defaultWALSyncInterval
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultWALSegmentSize
+	}
+
+	d := Durable[K, V]{
+		cache: cache,
+		codec: codec,
+		opts:  opts,
+		dir:   dir,
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	if err := d.replay(); err != nil {
+		return nil, err
+	}
+
+	if err := d.openSegment(d.segNum); err != nil {
+		return nil, err
+	}
+
+	if opts.Sync == SyncPeriodic || opts.CompactInterval > 0 {
+		go d.background(ctx)
+	}
+
+	return &d, nil
+}
+
+// replay loads the latest snapshot and applies log segments written after it.
+// Sets the number of the next segment.
+func (d *Durable[K, V]) replay() error {
+	segments, snapshots, err := walFiles(d.dir)
+	if err != nil {
+		return err
+	}
+
+	var from uint64
+	if len(snapshots) > 0 {
+		from = snapshots[len(snapshots)-1]
+		if err := d.loadSnapshot(from); err != nil {
+			return err
+		}
+		d.segNum = from
+	}
+
+	for i, n := range segments {
+		if n < from {
+			continue
+		}
+
+		last := i == len(segments)-1
+		if err := d.replaySegment(n, last); err != nil {
+			return err
+		}
+		d.segNum = n + 1
+	}
+
+	return nil
+}
+
+func (d *Durable[K, V]) loadSnapshot(n uint64) error {
+	f, err := os.Open(filepath.Join(d.dir, walSnapshotName(n)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := LoadFrom(bufio.NewReader(f), d.cache, d.codec); err != nil {
+		return fmt.Errorf("loading %s: %w", walSnapshotName(n), err)
+	}
+
+	return nil
+}
+
+// replaySegment applies records of the segment to the cache.
+// Incomplete or corrupted tail of the last segment is truncated.
+func (d *Durable[K, V]) replaySegment(n uint64, last bool) error {
+	name := filepath.Join(d.dir, walSegmentName(n))
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ts, _ := d.cache.(timedSetter[K, V])
+	valid, err := readWALSegment(bufio.NewReader(f), func(payload []byte) error {
+		return d.apply(payload, ts)
+	})
+	if errors.Is(err, ErrCorruptLog) && last {
+		return os.Truncate(name, valid)
+	}
+	if err != nil {
+		return fmt.Errorf("replaying %s: %w", walSegmentName(n), err)
+	}
+
+	return nil
+}
+
+// apply applies the log record to the cache.
+func (d *Durable[K, V]) apply(payload []byte, ts timedSetter[K, V]) error {
+	if len(payload) == 0 {
+		return fmt.Errorf("%w: empty record", ErrCorruptLog)
+	}
+
+	op, payload := walOp(payload[0]), payload[1:]
+	if op == walOpClear {
+		d.cache.Clear()
+		return nil
+	}
+	if op != walOpSet && op != walOpDel {
+		return fmt.Errorf("%w: unknown operation %d", ErrCorruptLog, op)
+	}
+
+	kb, payload, ok := readChunk(payload)
+	if !ok {
+		return fmt.Errorf("%w: malformed record", ErrCorruptLog)
+	}
+	key, err := d.codec.DecodeKey(kb)
+	if err != nil {
+		return err
+	}
+
+	if op == walOpDel {
+		return d.cache.Del(key)
+	}
+
+	vb, payload, ok := readChunk(payload)
+	if !ok {
+		return fmt.Errorf("%w: malformed record", ErrCorruptLog)
+	}
+	value, err := d.codec.DecodeValue(vb)
+	if err != nil {
+		return err
+	}
+	written, l := binary.Varint(payload)
+	if l <= 0 {
+		return fmt.Errorf("%w: malformed record", ErrCorruptLog)
+	}
+
+	if ts != nil {
+		ts.setAt(key, value, time.Unix(0, written))
+	} else {
+		d.cache.Set(key, value)
+	}
+
+	return nil
+}
+
+// openSegment creates a new segment and makes it current.
+func (d *Durable[K, V]) openSegment(n uint64) error {
+	f, err := os.OpenFile(filepath.Join(d.dir, walSegmentName(n)), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(d.dir); err != nil {
+		f.Close()
+		return err
+	}
+
+	d.seg = f
+	d.segNum = n
+	d.segSize = 0
+	d.dirty = false
+
+	return nil
+}
+
+// rotate syncs and closes the current segment and starts the next one.
+func (d *Durable[K, V]) rotate() error {
+	if err := d.closeSegment(); err != nil {
+		return err
+	}
+
+	return d.openSegment(d.segNum + 1)
+}
+
+func (d *Durable[K, V]) closeSegment() error {
+	err := d.seg.Sync()
+	if cerr := d.seg.Close(); err == nil {
+		err = cerr
+	}
+	d.seg = nil
+
+	return err
+}
+
+func (d *Durable[K, V]) background(ctx context.Context) {
+	var syncC, compactC <-chan time.Time
+	if d.opts.Sync == SyncPeriodic {
+		t := time.NewTicker(d.opts.SyncInterval)
+		defer t.Stop()
+		syncC = t.C
+	}
+	if d.opts.CompactInterval > 0 {
+		t := time.NewTicker(d.opts.CompactInterval)
+		defer t.Stop()
+		compactC = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncC:
+			_ = d.Sync()
+		case <-compactC:
+			_ = d.Compact()
+		}
+	}
+}
+
+// write appends the record built by the payload
+// function to the log. Caller must hold the lock.
+func (d *Durable[K, V]) write(op walOp, payload func(dst []byte) ([]byte, error)) {
+	if d.err != nil {
+		return
+	}
+
+	var err error
+	d.payload, err = payload(append(d.payload[:0], byte(op)))
+	if err != nil {
+		d.err = err
+		return
+	}
+
+	d.buf = appendWALRecord(d.buf[:0], d.payload)
+	if _, err := d.seg.Write(d.buf); err != nil {
+		d.err = err
+		return
+	}
+	d.segSize += int64(len(d.buf))
+
+	if d.opts.Sync == SyncAlways {
+		if err := d.seg.Sync(); err != nil {
+			d.err = err
+			return
+		}
+	} else {
+		d.dirty = true
+	}
+
+	if d.segSize >= d.opts.SegmentSize {
+		d.err = d.rotate()
+	}
+}
+
+func (d *Durable[K, V]) logSet(key K, value V) {
+	d.write(walOpSet, func(dst []byte) ([]byte, error) {
+		dst, err := appendKeyChunk(dst, d.codec, key)
+		if err != nil {
+			return dst, err
+		}
+		dst, err = appendValueChunk(dst, d.codec, value)
+		if err != nil {
+			return dst, err
+		}
+
+		return binary.AppendVarint(dst, time.Now().UnixNano()), nil
+	})
+}
+
+func (d *Durable[K, V]) logDel(key K) {
+	d.write(walOpDel, func(dst []byte) ([]byte, error) {
+		return appendKeyChunk(dst, d.codec, key)
+	})
+}
+
+func (d *Durable[K, V]) logClear() {
+	d.write(walOpClear, func(dst []byte) ([]byte, error) {
+		return dst, nil
+	})
+}
+
+// Set logs the record and sets it to the cache.
+func (d *Durable[K, V]) Set(key K, value V) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.logSet(key, value)
+	d.cache.Set(key, value)
+}
+
+// SetIfPresent sets the value only if the key already exists.
+// Only performed writes are logged.
+func (d *Durable[K, V]) SetIfPresent(key K, value V) (V, bool) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	old, ok := d.cache.SetIfPresent(key, value)
+	if ok {
+		d.logSet(key, value)
+	}
+
+	return old, ok
+}
+
+// SetIfAbsent sets the value only if the key does not exist yet.
+// Only performed writes are logged.
+func (d *Durable[K, V]) SetIfAbsent(key K, value V) (V, bool) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	old, ok := d.cache.SetIfAbsent(key, value)
+	if ok {
+		d.logSet(key, value)
+	}
+
+	return old, ok
+}
+
+// Get returns the value from the underlying cache.
+func (d *Durable[K, V]) Get(key K) (V, error) {
+	return d.cache.Get(key)
+}
+
+// Del logs the deletion and deletes the key from the cache.
+// Returns the log error, if any, or the error of the underlying cache.
+func (d *Durable[K, V]) Del(key K) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.logDel(key)
+	if err := d.cache.Del(key); err != nil {
+		return err
+	}
+
+	return d.err
+}
+
+// Clear logs the operation and removes all records from the cache.
+func (d *Durable[K, V]) Clear() {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.logClear()
+	d.cache.Clear()
+}
+
+// Snapshot returns a shallow copy of the underlying cache.
+func (d *Durable[K, V]) Snapshot() map[K]V {
+	return d.cache.Snapshot()
+}
+
+// Len returns the number of records in the underlying cache.
+func (d *Durable[K, V]) Len() int {
+	return d.cache.Len()
+}
+
+// All is a (read-only) iterator over all key-value pairs of the underlying cache.
+// Ordering and locking rules of the underlying cache apply.
+func (d *Durable[K, V]) All() iter.Seq2[K, V] {
+	return all(d.cache)
+}
+
+// Keys is a (read-only) iterator over all keys of the underlying cache.
+func (d *Durable[K, V]) Keys() iter.Seq[K] {
+	return keysOf(d.All())
+}
+
+// Values is a (read-only) iterator over all values of the underlying cache.
+func (d *Durable[K, V]) Values() iter.Seq[V] {
+	return valuesOf(d.All())
+}
+
+// Err returns the error that stopped logging, if any.
+func (d *Durable[K, V]) Err() error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	return d.err
+}
+
+// Sync calls fsync on the current log segment.
+// It is useful with SyncNever policy to make writes durable at specific points.
+func (d *Durable[K, V]) Sync() error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.err != nil {
+		return d.err
+	}
+	if !d.dirty {
+		return nil
+	}
+
+	if err := d.seg.Sync(); err != nil {
+		d.err = err
+		return err
+	}
+	d.dirty = false
+
+	return nil
+}
+
+// Compact starts a new log segment, writes the snapshot of the cache
+// and removes older segments and snapshots, that are included in it.
+// Writes are blocked only while the segment is switched, but the cache is
+// iterated to write the snapshot (see locking rules of the underlying cache).
+func (d *Durable[K, V]) Compact() error {
+	d.compactMux.Lock()
+	defer d.compactMux.Unlock()
+
+	d.mux.Lock()
+	if d.err == nil {
+		d.err = d.rotate()
+	}
+	err, n := d.err, d.segNum
+	d.mux.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err := d.writeSnapshot(n); err != nil {
+		return err
+	}
+
+	segments, snapshots, err := walFiles(d.dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if s < n {
+			if err := os.Remove(filepath.Join(d.dir, walSegmentName(s))); err != nil {
+				return err
+			}
+		}
+	}
+	for _, s := range snapshots {
+		if s < n {
+			if err := os.Remove(filepath.Join(d.dir, walSnapshotName(s))); err != nil {
+				return err
+			}
+		}
+	}
+
+	return syncDir(d.dir)
+}
+
+// writeSnapshot atomically writes snapshot of the cache
+// that includes all segments before n.
+func (d *Durable[K, V]) writeSnapshot(n uint64) error {
+	name := filepath.Join(d.dir, walSnapshotName(n))
+	tmp := name + walTmpSuffix
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	err = SaveTo(w, d.cache, d.codec)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(d.dir)
+}
+
+// Close syncs and closes the log. Writes after Close are applied
+// to the cache, but not logged. Background goroutine is stopped
+// by canceling the context passed to NewDurable.
+func (d *Durable[K, V]) Close() error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.seg == nil {
+		if errors.Is(d.err, errDurableClosed) {
+			return nil
+		}
+		return d.err
+	}
+
+	err := d.closeSegment()
+	if d.err == nil {
+		d.err = errDurableClosed
+		return err
+	}
+
+	return d.err
+}
@@ -0,0 +1,287 @@
+package geche
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func ExampleNewDurable() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, _ := os.MkdirTemp("", "geche")
+	defer os.RemoveAll(dir)
+
+	c, _ := NewDurable(ctx, dir, NewMapCache[string, int](), NewBinaryCodec[string, int](), DurableOptions{})
+	c.Set("a", 1)
+	c.Set("b", 2)
+	_ = c.Del("a")
+	_ = c.Close()
+
+	// Restart.
+	c, _ = NewDurable(ctx, dir, NewMapCache[string, int](), NewBinaryCodec[string, int](), DurableOptions{})
+	fmt.Println(c.Snapshot())
+	// Output: map[b:2]
+}
+
+func openDurable(t *testing.T, dir string, opts DurableOptions) *Durable[string, int] {
+	t.Helper()
+
+	c, err := NewDurable(t.Context(), dir, NewMapCache[string, int](), NewBinaryCodec[string, int](), opts)
+	if err != nil {
+		t.Fatalf("unexpected error in NewDurable: %v", err)
+	}
+
+	return c
+}
+
+func TestDurableReplay(t *testing.T) {
+	dir := t.TempDir()
+	for _, policy := range []SyncPolicy{SyncAlways, SyncPeriodic, SyncNever} {
+		c := openDurable(t, dir, DurableOptions{Sync: policy})
+		for i := 0; i < 100; i++ {
+			k := fmt.Sprintf("k%d", i%17)
+			switch i % 7 {
+			case 0:
+				_ = c.Del(k)
+			case 1:
+				c.SetIfAbsent(k, i)
+			case 2:
+				c.SetIfPresent(k, i)
+			default:
+				c.Set(k, i)
+			}
+		}
+		model := c.Snapshot()
+
+		// Process crash: log is not closed.
+		c = openDurable(t, dir, DurableOptions{})
+		if !maps.Equal(model, c.Snapshot()) {
+			t.Fatalf("policy %d: expected %v after replay, got %v", policy, model, c.Snapshot())
+		}
+		if err := c.Close(); err != nil {
+			t.Fatalf("unexpected error in Close: %v", err)
+		}
+	}
+
+	c := openDurable(t, dir, DurableOptions{})
+	c.Clear()
+	c.Set("x", 1)
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected error in Close: %v", err)
+	}
+
+	c = openDurable(t, dir, DurableOptions{})
+	if !maps.Equal(map[string]int{"x": 1}, c.Snapshot()) {
+		t.Errorf("expected only x after Clear, got %v", c.Snapshot())
+	}
+}
+
+func TestDurableTornTail(t *testing.T) {
+	dir := t.TempDir()
+	c := openDurable(t, dir, DurableOptions{})
+	c.Set("a", 1)
+	c.Set("b", 2)
+	seg := filepath.Join(dir, walSegmentName(c.segNum))
+	_ = c.Close()
+
+	info, err := os.Stat(seg)
+	if err != nil {
+		t.Fatalf("unexpected error in Stat: %v", err)
+	}
+
+	// Half-written record.
+	f, err := os.OpenFile(seg, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("unexpected error in OpenFile: %v", err)
+	}
+	_, _ = f.Write([]byte{20, 0, 0, 0, 1, 2})
+	_ = f.Close()
+
+	c = openDurable(t, dir, DurableOptions{})
+	if !maps.Equal(map[string]int{"a": 1, "b": 2}, c.Snapshot()) {
+		t.Errorf("unexpected records after replay: %v", c.Snapshot())
+	}
+	if info2, _ := os.Stat(seg); info2.Size() != info.Size() {
+		t.Errorf("expected torn record to be truncated, size %d, expected %d", info2.Size(), info.Size())
+	}
+}
+
+func TestDurableCorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+	c := openDurable(t, dir, DurableOptions{SegmentSize: 64})
+	for i := 0; i < 20; i++ {
+		c.Set(fmt.Sprintf("key%d", i), i)
+	}
+	_ = c.Close()
+
+	segments, _, err := walFiles(dir)
+	if err != nil || len(segments) < 3 {
+		t.Fatalf("expected several segments, got %v, %v", segments, err)
+	}
+
+	name := filepath.Join(dir, walSegmentName(segments[0]))
+	b, _ := os.ReadFile(name)
+	b[len(b)-1] ^= 1
+	_ = os.WriteFile(name, b, 0o644)
+
+	_, err = NewDurable(context.Background(), dir, NewMapCache[string, int](), NewBinaryCodec[string, int](), DurableOptions{})
+	if !errors.Is(err, ErrCorruptLog) {
+		t.Errorf("expected ErrCorruptLog, got %v", err)
+	}
+}
+
+func TestDurableCompact(t *testing.T) {
+	dir := t.TempDir()
+	c := openDurable(t, dir, DurableOptions{Sync: SyncNever, SegmentSize: 1024})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := fmt.Sprintf("w%d:%d", w, i%100)
+				if i%5 == 0 {
+					_ = c.Del(k)
+				} else {
+					c.Set(k, i)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if err := c.Compact(); err != nil {
+			t.Errorf("unexpected error in Compact: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if err := c.Compact(); err != nil {
+		t.Fatalf("unexpected error in Compact: %v", err)
+	}
+	c.Set("after", 1)
+	model := c.Snapshot()
+	_ = c.Close()
+
+	segments, snapshots, err := walFiles(dir)
+	if err != nil {
+		t.Fatalf("unexpected error in walFiles: %v", err)
+	}
+	if len(segments) != 1 || len(snapshots) != 1 || segments[0] != snapshots[0] {
+		t.Errorf("expected one segment and one snapshot, got %v and %v", segments, snapshots)
+	}
+
+	c = openDurable(t, dir, DurableOptions{})
+	if !maps.Equal(model, c.Snapshot()) {
+		t.Errorf("expected %d records after replay, got %d", len(model), c.Len())
+	}
+}
+
+func TestDurableTTL(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	open := func() *Durable[string, int] {
+		c, err := NewDurable(ctx, dir, NewMapTTLCache[string, int](ctx, 100*time.Millisecond, time.Hour), NewBinaryCodec[string, int](), DurableOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error in NewDurable: %v", err)
+		}
+		return c
+	}
+
+	c := open()
+	c.Set("old", 1)
+	time.Sleep(150 * time.Millisecond)
+	c.Set("new", 2)
+	_ = c.Close()
+
+	c = open()
+	if _, err := c.Get("old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected old record to stay expired after replay, got %v", err)
+	}
+	if v, err := c.Get("new"); err != nil || v != 2 {
+		t.Errorf("expected new record after replay, got %v, %v", v, err)
+	}
+
+	// Snapshot keeps expiration time too.
+	if err := c.Compact(); err != nil {
+		t.Fatalf("unexpected error in Compact: %v", err)
+	}
+	_ = c.Close()
+	time.Sleep(150 * time.Millisecond)
+
+	c = open()
+	if _, err := c.Get("new"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected record to expire after restart, got %v", err)
+	}
+}
+
+func TestDurableBackground(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, err := NewDurable(ctx, dir, NewMapCache[string, int](), NewBinaryCodec[string, int](), DurableOptions{
+		Sync:            SyncPeriodic,
+		SyncInterval:    time.Millisecond,
+		CompactInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error in NewDurable: %v", err)
+	}
+	c.Set("a", 1)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, snapshots, _ := walFiles(dir)
+		c.mux.Lock()
+		dirty := c.dirty
+		c.mux.Unlock()
+		if len(snapshots) > 0 && !dirty {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected background sync and compaction")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	_ = c.Close()
+}
+
+func TestDurableClosed(t *testing.T) {
+	c := openDurable(t, t.TempDir(), DurableOptions{})
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected error in Close: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("expected second Close to succeed, got %v", err)
+	}
+
+	c.Set("a", 1)
+	if v, _ := c.Get("a"); v != 1 {
+		t.Error("expected cache to be updated after Close")
+	}
+	if err := c.Del("a"); !errors.Is(err, errDurableClosed) {
+		t.Errorf("expected errDurableClosed, got %v", err)
+	}
+	if err := c.Compact(); !errors.Is(err, errDurableClosed) {
+		t.Errorf("expected errDurableClosed, got %v", err)
+	}
+}
+
+func TestInsertUvarint(t *testing.T) {
+	b := insertUvarint([]byte("abcdef"), 2, 300)
+	if string(b) != "ab\xac\x02cdef" {
+		t.Errorf("unexpected result %q", b)
+	}
+}
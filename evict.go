@@ -0,0 +1,74 @@
+package geche
+
+import "sync"
+
+// evictionListener is implemented by caches that allow wrappers
+// to subscribe to evictions without affecting callbacks set by OnEvict.
+type evictionListener[K comparable, V any] interface {
+	listenEvict(f func(key K, value V))
+}
+
+// subscribeEvict subscribes the wrapper to evictions of the cache.
+// Returns false if the cache does not implement EvictionNotifier.
+func subscribeEvict[K comparable, V any](cache Geche[K, V], f func(key K, value V)) bool {
+	if l, ok := cache.(evictionListener[K, V]); ok {
+		l.listenEvict(f)
+		return true
+	}
+	if n, ok := cache.(EvictionNotifier[K, V]); ok {
+		n.OnEvict(f)
+		return true
+	}
+
+	return false
+}
+
+// evictQueue collects keys reported by EvictionNotifier callbacks
+// until the wrapper can process them under its own lock.
+type evictQueue[K any] struct {
+	mux  sync.Mutex
+	keys []K
+}
+
+func (q *evictQueue[K]) push(key K) {
+	q.mux.Lock()
+	q.keys = append(q.keys, key)
+	q.mux.Unlock()
+}
+
+// tryLocker is a lock that can be acquired without blocking.
+type tryLocker interface {
+	TryLock() bool
+	Unlock()
+}
+
+// add is called from the eviction callback of the wrapper.
+// Evictions can happen while the wrapper lock is held (e.g. RingBuffer
+// evicts synchronously in Set), so callbacks must not block on it: the key
+// is queued and fn processes the queue now only if the lock is free.
+// Otherwise the wrapper should drain the queue in its next write operation.
+func (q *evictQueue[K]) add(key K, l tryLocker, fn func(key K)) {
+	q.push(key)
+	if l.TryLock() {
+		q.drain(fn)
+		l.Unlock()
+	}
+}
+
+// drain calls fn for each queued key and empties the queue.
+func (q *evictQueue[K]) drain(fn func(key K)) {
+	q.mux.Lock()
+	keys := q.keys
+	q.keys = nil
+	q.mux.Unlock()
+
+	for _, key := range keys {
+		fn(key)
+	}
+}
+
+func (q *evictQueue[K]) reset() {
+	q.mux.Lock()
+	q.keys = nil
+	q.mux.Unlock()
+}
@@ -0,0 +1,124 @@
+package geche
+
+import "slices"
+
+// FuzzyMatch is a result of the fuzzy search.
+type FuzzyMatch[K byteSlice, V any] struct {
+	Key   K
+	Value V
+	// Distance is Levenshtein distance between the key and the query.
+	Distance int
+}
+
+// fuzzySearch walks the trie in key order computing Levenshtein distance
+// between query and the path of every node (one dynamic programming row per node),
+// and returns keys starting with prefix within maxDist of the query, ordered by distance
+// and then by key. Subtrees where all row values exceed the distance threshold are pruned.
+// Once limit matches are found, the threshold is lowered to only accept better ones.
+// limit <= 0 means no limit.
+func fuzzySearch[K byteSlice, N trieWalkNode[N], V any](
+	root N,
+	prefix, query string,
+	maxDist, limit int,
+	value func(node N) V,
+) []FuzzyMatch[K, V] {
+	type stackEntry struct {
+		node    N
+		pathLen int
+	}
+
+	var res []FuzzyMatch[K, V]
+	if maxDist < 0 {
+		return res
+	}
+
+	threshold := maxDist
+	w := len(query) + 1
+	// rows holds the DP row before the node segment for every stack entry.
+	rows := make([]int, w, 64*w)
+	for j := range rows {
+		rows[j] = j
+	}
+	cur := make([]int, w)
+	tmp := make([]int, w)
+
+	path := make([]byte, 0, max(len(prefix), maxKeyLength))
+	stack := make([]stackEntry, 0, 64)
+	stack = append(stack, stackEntry{node: root})
+
+	var children []N
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		copy(cur, rows[len(stack)*w:])
+		rows = rows[:len(stack)*w]
+
+		seg := e.node.segment()
+		path = append(path[:e.pathLen], seg...)
+
+		alive := true
+		for i := 0; i < len(seg); i++ {
+			c := seg[i]
+			if p := e.pathLen + i; p < len(prefix) && prefix[p] != c {
+				alive = false
+				break
+			}
+
+			tmp[0] = cur[0] + 1
+			rowMin := tmp[0]
+			for j := 1; j < w; j++ {
+				cost := 1
+				if query[j-1] == c {
+					cost = 0
+				}
+				tmp[j] = min(cur[j]+1, tmp[j-1]+1, cur[j-1]+cost)
+				rowMin = min(rowMin, tmp[j])
+			}
+			cur, tmp = tmp, cur
+
+			if rowMin > threshold {
+				alive = false
+				break
+			}
+		}
+		if !alive {
+			continue
+		}
+
+		if d := cur[w-1]; e.node.isTerminal() && len(path) >= len(prefix) && d <= threshold {
+			m := FuzzyMatch[K, V]{Key: stringToKey[K](string(path)), Value: value(e.node), Distance: d}
+			if limit <= 0 {
+				res = append(res, m)
+			} else {
+				// Keep res sorted by distance. Keys come in lexicographical order,
+				// so a new key goes after the ones with the same distance.
+				i := len(res)
+				for i > 0 && res[i-1].Distance > d {
+					i--
+				}
+				res = slices.Insert(res, i, m)
+				if len(res) > limit {
+					res = res[:limit]
+				}
+				if len(res) == limit {
+					// Only strictly better matches can get into the result now.
+					threshold = res[limit-1].Distance - 1
+				}
+			}
+		}
+
+		children = e.node.appendChildren(children[:0])
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, stackEntry{node: children[i], pathLen: len(path)})
+			rows = append(rows, cur...)
+		}
+	}
+
+	if limit <= 0 {
+		slices.SortStableFunc(res, func(a, b FuzzyMatch[K, V]) int {
+			return a.Distance - b.Distance
+		})
+	}
+
+	return res
+}
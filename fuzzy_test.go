@@ -0,0 +1,110 @@
+package geche
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func ExampleKVCache_FuzzySearch() {
+	cache := NewKVCache[string, int]()
+	for i, k := range []string{"apple", "apply", "ample", "maple", "banana"} {
+		cache.Set(k, i)
+	}
+
+	for _, m := range cache.FuzzySearch("appel", 2, 3) {
+		fmt.Println(m.Key, m.Distance)
+	}
+	// Output:
+	// apple 2
+	// apply 2
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func TestFuzzySearch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(13))
+	randKey := func() string {
+		b := make([]byte, rnd.Intn(7))
+		for j := range b {
+			b[j] = "abcd"[rnd.Intn(4)]
+		}
+		return string(b)
+	}
+
+	cache := NewKVCache[string, int]()
+	set := map[string]int{}
+	for i := 0; i < 500; i++ {
+		k := randKey()
+		set[k] = i
+		cache.Set(k, i)
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for i := 0; i < 300; i++ {
+		query := randKey()
+		prefix := randKey()
+		prefix = prefix[:len(prefix)/3]
+		maxDist := rnd.Intn(4)
+		limit := rnd.Intn(6)
+
+		var expected []FuzzyMatch[string, int]
+		for _, k := range keys {
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			if d := levenshtein(k, query); d <= maxDist {
+				expected = append(expected, FuzzyMatch[string, int]{Key: k, Value: set[k], Distance: d})
+			}
+		}
+		slices.SortStableFunc(expected, func(a, b FuzzyMatch[string, int]) int {
+			return a.Distance - b.Distance
+		})
+		if limit > 0 && len(expected) > limit {
+			expected = expected[:limit]
+		}
+
+		got := cache.FuzzySearchByPrefix(prefix, query, maxDist, limit)
+		if !slices.Equal(expected, got) {
+			t.Fatalf("FuzzySearchByPrefix(%q, %q, %d, %d): expected %v, got %v",
+				prefix, query, maxDist, limit, expected, got)
+		}
+	}
+}
+
+func TestFuzzySearchNegativeDistance(t *testing.T) {
+	cache := NewKVCache[string, int]()
+	cache.Set("foo", 1)
+
+	if res := cache.FuzzySearch("foo", -1, 0); len(res) != 0 {
+		t.Errorf("expected no matches, got %v", res)
+	}
+	if res := cache.FuzzySearch("foo", 0, 0); len(res) != 1 || res[0].Key != "foo" {
+		t.Errorf("expected exact match, got %v", res)
+	}
+}
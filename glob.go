@@ -0,0 +1,264 @@
+package geche
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// ErrBadPattern is returned by Match when the glob pattern is malformed.
+var ErrBadPattern = errors.New("syntax error in pattern")
+
+type globKind uint8
+
+const (
+	globLiteral globKind = iota
+	globAny
+	globStar
+	globClass
+)
+
+type globToken struct {
+	kind globKind
+	b    byte
+	// class is a bitset of bytes matched by the character class.
+	class [4]uint64
+}
+
+func (t *globToken) matches(c byte) bool {
+	switch t.kind {
+	case globLiteral:
+		return t.b == c
+	case globAny:
+		return true
+	case globClass:
+		return t.class[c>>6]&(1<<(c&63)) != 0
+	}
+
+	return false
+}
+
+// glob is a compiled glob pattern. It is matched as a nondeterministic
+// finite automaton, where state i means that first i tokens were matched.
+// State sets are represented as bitsets of len(tokens)+1 bits.
+type glob struct {
+	tokens []globToken
+	words  int
+}
+
+// compileGlob parses the pattern. Supported syntax:
+//
+//	'*'     matches any sequence of bytes, including empty one
+//	'?'     matches any single byte
+//	[abc]   matches any byte in the set
+//	[a-z]   matches any byte in the range
+//	[!a-z]  or [^a-z] matches any byte not in the range
+//	\c      matches byte c literally
+//
+// Matching is done on the byte level, same as ordering in the trie.
+func compileGlob(pattern string) (*glob, error) {
+	var tokens []globToken
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			// Consecutive stars are the same as one.
+			if len(tokens) == 0 || tokens[len(tokens)-1].kind != globStar {
+				tokens = append(tokens, globToken{kind: globStar})
+			}
+		case '?':
+			tokens = append(tokens, globToken{kind: globAny})
+		case '\\':
+			i++
+			if i == len(pattern) {
+				return nil, ErrBadPattern
+			}
+			tokens = append(tokens, globToken{kind: globLiteral, b: pattern[i]})
+		case '[':
+			t, n, err := parseGlobClass(pattern[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, t)
+			i += n
+		default:
+			tokens = append(tokens, globToken{kind: globLiteral, b: c})
+		}
+	}
+
+	return &glob{
+		tokens: tokens,
+		words:  (len(tokens) + 1 + 63) / 64,
+	}, nil
+}
+
+// parseGlobClass parses character class following the opening bracket.
+// Returns the token and the number of bytes consumed, including the closing bracket.
+func parseGlobClass(s string) (globToken, int, error) {
+	t := globToken{kind: globClass}
+
+	i := 0
+	negate := false
+	if i < len(s) && (s[i] == '!' || s[i] == '^') {
+		negate = true
+		i++
+	}
+
+	// next returns the next (possibly escaped) byte of the class.
+	next := func() (byte, error) {
+		if i < len(s) && s[i] == '\\' {
+			i++
+		}
+		if i == len(s) {
+			return 0, ErrBadPattern
+		}
+		c := s[i]
+		i++
+		return c, nil
+	}
+
+	empty := true
+	for {
+		if i == len(s) {
+			return t, 0, ErrBadPattern
+		}
+		if s[i] == ']' && !empty {
+			i++
+			break
+		}
+
+		lo, err := next()
+		if err != nil {
+			return t, 0, err
+		}
+		hi := lo
+		if i+1 < len(s) && s[i] == '-' && s[i+1] != ']' {
+			i++
+			if hi, err = next(); err != nil {
+				return t, 0, err
+			}
+			if hi < lo {
+				return t, 0, ErrBadPattern
+			}
+		}
+
+		for c := int(lo); c <= int(hi); c++ {
+			t.class[c>>6] |= 1 << (c & 63)
+		}
+		empty = false
+	}
+
+	if negate {
+		for j := range t.class {
+			t.class[j] = ^t.class[j]
+		}
+	}
+
+	return t, i, nil
+}
+
+// add adds state i and all states reachable from it without consuming input
+// (star can match empty sequence) to the set.
+func (g *glob) add(set []uint64, i int) {
+	for {
+		set[i>>6] |= 1 << (i & 63)
+		if i == len(g.tokens) || g.tokens[i].kind != globStar {
+			return
+		}
+		i++
+	}
+}
+
+// start writes the initial state set to set.
+func (g *glob) start(set []uint64) {
+	clear(set)
+	g.add(set, 0)
+}
+
+// step writes the set of states reachable from src by consuming c to dst.
+// Returns false if dst is empty, which means that no continuation can match.
+func (g *glob) step(dst, src []uint64, c byte) bool {
+	clear(dst)
+	nonEmpty := false
+	for w, word := range src {
+		for word != 0 {
+			i := w<<6 + bits.TrailingZeros64(word)
+			word &= word - 1
+			if i == len(g.tokens) {
+				continue
+			}
+			t := &g.tokens[i]
+			if t.kind == globStar {
+				g.add(dst, i)
+				nonEmpty = true
+			} else if t.matches(c) {
+				g.add(dst, i+1)
+				nonEmpty = true
+			}
+		}
+	}
+
+	return nonEmpty
+}
+
+// accepts returns true if the set contains the final state.
+func (g *glob) accepts(set []uint64) bool {
+	n := len(g.tokens)
+	return set[n>>6]&(1<<(n&63)) != 0
+}
+
+// matchTrie traverses the trie in key order, calling fn for every terminal node
+// which key matches the pattern. Subtrees that cannot match are not visited.
+// Path slice is reused, so fn should copy it if it needs to keep it.
+// Stops as soon as fn returns false.
+func matchTrie[N trieWalkNode[N]](root N, g *glob, fn func(path []byte, node N) bool) {
+	type stackEntry struct {
+		node    N
+		pathLen int
+	}
+
+	w := g.words
+	// states holds the state set before the node segment
+	// for every stack entry (w words each).
+	states := make([]uint64, w, 64*w)
+	g.start(states)
+	cur := make([]uint64, w)
+	tmp := make([]uint64, w)
+
+	path := make([]byte, 0, maxKeyLength)
+	stack := make([]stackEntry, 0, 64)
+	stack = append(stack, stackEntry{node: root})
+
+	var children []N
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		copy(cur, states[len(stack)*w:])
+		states = states[:len(stack)*w]
+
+		seg := e.node.segment()
+		path = append(path[:e.pathLen], seg...)
+
+		alive := true
+		for i := 0; i < len(seg); i++ {
+			if !g.step(tmp, cur, seg[i]) {
+				alive = false
+				break
+			}
+			cur, tmp = tmp, cur
+		}
+		if !alive {
+			continue
+		}
+
+		if e.node.isTerminal() && g.accepts(cur) {
+			if !fn(path, e.node) {
+				return
+			}
+		}
+
+		children = e.node.appendChildren(children[:0])
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, stackEntry{node: children[i], pathLen: len(path)})
+			states = append(states, cur...)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package geche
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func ExampleKVCache_Match() {
+	cache := NewKVCache[string, int]()
+	cache.Set("user:1:session", 1)
+	cache.Set("user:1:profile", 2)
+	cache.Set("user:2:session", 3)
+
+	seq, _ := cache.Match("user:*:session")
+	for k, v := range seq {
+		fmt.Println(k, v)
+	}
+	// Output:
+	// user:1:session 1
+	// user:2:session 3
+}
+
+// refMatch is a straightforward backtracking glob matcher
+// used as a reference in tests. It supports *, ? and [ab] / [!ab] classes
+// without ranges and escapes.
+func refMatch(pattern, s string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(s); i++ {
+			if refMatch(pattern[1:], s[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return s != "" && refMatch(pattern[1:], s[1:])
+	case '[':
+		end := 1
+		for pattern[end] != ']' {
+			end++
+		}
+		class := pattern[1:end]
+		negate := class[0] == '!'
+		if negate {
+			class = class[1:]
+		}
+		if s == "" {
+			return false
+		}
+		in := false
+		for i := 0; i < len(class); i++ {
+			if class[i] == s[0] {
+				in = true
+			}
+		}
+		return in != negate && refMatch(pattern[end+1:], s[1:])
+	default:
+		return s != "" && s[0] == pattern[0] && refMatch(pattern[1:], s[1:])
+	}
+}
+
+func TestGlobSyntax(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"a*", "a", true},
+		{"a*b", "axxb", true},
+		{"a*b", "axxbc", false},
+		{"a**b", "ab", true},
+		{"metrics.?.cpu", "metrics.1.cpu", true},
+		{"metrics.?.cpu", "metrics.10.cpu", false},
+		{"[a-c]x", "bx", true},
+		{"[a-c]x", "dx", false},
+		{"[!a-c]x", "dx", true},
+		{"[^a-c]x", "ax", false},
+		{"[]]", "]", true},
+		{"[a-]", "-", true},
+		{`[\]]`, "]", true},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`a\?`, "a?", true},
+		{"\xff*", "\xff\x00", true},
+		{"[\x80-\xff]", "\x90", true},
+	}
+
+	for _, tt := range tests {
+		g, err := compileGlob(tt.pattern)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tt.pattern, err)
+		}
+
+		set := make([]uint64, g.words)
+		tmp := make([]uint64, g.words)
+		g.start(set)
+		alive := true
+		for i := 0; i < len(tt.key) && alive; i++ {
+			alive = g.step(tmp, set, tt.key[i])
+			set, tmp = tmp, set
+		}
+
+		if got := alive && g.accepts(set); got != tt.match {
+			t.Errorf("pattern %q key %q: expected %v, got %v", tt.pattern, tt.key, tt.match, got)
+		}
+	}
+}
+
+func TestGlobBadPattern(t *testing.T) {
+	for _, p := range []string{"[", "[]", "[a", "[!]", `a\`, "[b-a]", `[\`} {
+		if _, err := compileGlob(p); !errors.Is(err, ErrBadPattern) {
+			t.Errorf("expected ErrBadPattern for %q, got %v", p, err)
+		}
+	}
+
+	if _, err := NewKVCache[string, int]().Match("[a"); !errors.Is(err, ErrBadPattern) {
+		t.Errorf("expected ErrBadPattern, got %v", err)
+	}
+}
+
+type globMatcher interface {
+	Set(string, int)
+	Match(pattern string) (iter.Seq2[string, int], error)
+}
+
+func testMatch(t *testing.T, c globMatcher) {
+	rnd := rand.New(rand.NewSource(9))
+	set := map[string]int{}
+	for i := 0; i < 300; i++ {
+		b := make([]byte, rnd.Intn(8))
+		for j := range b {
+			b[j] = "abc:"[rnd.Intn(4)]
+		}
+		set[string(b)] = i
+		c.Set(string(b), i)
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	parts := []string{"a", "b", ":", "*", "?", "[ab]", "[!a]"}
+	for i := 0; i < 500; i++ {
+		pattern := ""
+		for n := rnd.Intn(6); n > 0; n-- {
+			pattern += parts[rnd.Intn(len(parts))]
+		}
+
+		var expected []string
+		for _, k := range keys {
+			if refMatch(pattern, k) {
+				expected = append(expected, k)
+			}
+		}
+
+		seq, err := c.Match(pattern)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", pattern, err)
+		}
+		var got []string
+		for k, v := range seq {
+			if v != set[k] {
+				t.Fatalf("expected value %d for key %q, got %d", set[k], k, v)
+			}
+			got = append(got, k)
+		}
+
+		if !slices.Equal(expected, got) {
+			t.Fatalf("Match(%q): expected %q, got %q", pattern, expected, got)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	t.Run("KV", func(t *testing.T) {
+		testMatch(t, NewKV[int](NewMapCache[string, int]()))
+	})
+	t.Run("KVCache", func(t *testing.T) {
+		testMatch(t, NewKVCache[string, int]())
+	})
+}
+
+func TestMatchLongPattern(t *testing.T) {
+	// More than 64 tokens to use multi-word state sets.
+	key := ""
+	pattern := ""
+	for i := 0; i < 100; i++ {
+		key += "ab"
+		pattern += "a?"
+	}
+
+	cache := NewKVCache[string, int]()
+	cache.Set(key, 1)
+	cache.Set(key+"c", 2)
+
+	seq, _ := cache.Match(pattern)
+	n := 0
+	for range seq {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("expected 1 match, got %d", n)
+	}
+
+	seq, _ = cache.Match(pattern + "*")
+	n = 0
+	for range seq {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("expected 2 matches, got %d", n)
+	}
+}
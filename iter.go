@@ -0,0 +1,45 @@
+package geche
+
+import (
+	"iter"
+	"maps"
+)
+
+// all returns an iterator over all records of the cache.
+// Caches implementing Iterable are iterated directly,
+// others are iterated over their Snapshot.
+func all[K comparable, V any](c Geche[K, V]) iter.Seq2[K, V] {
+	if it, ok := c.(Iterable[K, V]); ok {
+		return it.All()
+	}
+
+	return func(yield func(K, V) bool) {
+		for k, v := range maps.All(c.Snapshot()) {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// keysOf turns key-value iterator into the iterator over keys.
+func keysOf[K, V any](seq iter.Seq2[K, V]) iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for k := range seq {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// valuesOf turns key-value iterator into the iterator over values.
+func valuesOf[K, V any](seq iter.Seq2[K, V]) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, v := range seq {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package geche
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// snapshotOnly hides all methods of the cache except Geche interface.
+type snapshotOnly struct {
+	Geche[string, string]
+}
+
+func TestIterableFallback(t *testing.T) {
+	c := NewMapCache[string, string]()
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), strconv.Itoa(i))
+	}
+
+	u := NewCacheUpdater[string, string](snapshotOnly{c}, updateFn, 1)
+	keys := slices.Sorted(u.Keys())
+	compareSlice(t, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}, keys)
+}
+
+func TestMapTTLCacheAllSkipsExpired(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewMapTTLCache[string, string](ctx, time.Second, time.Hour)
+	ts := time.Now()
+
+	c.now = func() time.Time { return ts }
+	c.Set("a", "1")
+	c.Set("b", "2")
+
+	c.now = func() time.Time { return ts.Add(700 * time.Millisecond) }
+	c.Set("c", "3")
+	c.Set("a", "4")
+
+	c.now = func() time.Time { return ts.Add(1500 * time.Millisecond) }
+
+	// "b" is expired, "a" was set again, so it goes last.
+	var keys, values []string
+	for k, v := range c.All() {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+
+	compareSlice(t, []string{"c", "a"}, keys)
+	compareSlice(t, []string{"3", "4"}, values)
+	compareSlice(t, []string{"c", "a"}, slices.Collect(c.Keys()))
+	compareSlice(t, []string{"3", "4"}, slices.Collect(c.Values()))
+}
+
+func TestKVAllOrdered(t *testing.T) {
+	kv := NewKV[string](NewMapCache[string, string]())
+	for _, k := range []string{"foo2", "", "foo", "bar", "foo1", "fo"} {
+		kv.Set(k, "v"+k)
+	}
+
+	expected := []string{"", "bar", "fo", "foo", "foo1", "foo2"}
+	compareSlice(t, expected, slices.Collect(kv.Keys()))
+
+	var values []string
+	for _, k := range expected {
+		values = append(values, "v"+k)
+	}
+	compareSlice(t, values, slices.Collect(kv.Values()))
+}
+
+func TestKVCacheAllOrdered(t *testing.T) {
+	kv := NewKVCache[[]byte, string]()
+	for _, k := range []string{"foo2", "", "foo", "bar", "foo1", "fo"} {
+		kv.Set([]byte(k), "v"+k)
+	}
+
+	var keys []string
+	for k := range kv.Keys() {
+		keys = append(keys, string(k))
+	}
+
+	compareSlice(t, []string{"", "bar", "fo", "foo", "foo1", "foo2"}, keys)
+	compareSlice(t, []string{"v", "vbar", "vfo", "vfoo", "vfoo1", "vfoo2"}, slices.Collect(kv.Values()))
+}
+
+func TestRingBufferKeysValues(t *testing.T) {
+	c := NewRingBuffer[int, string](3)
+	for i := 0; i < 5; i++ {
+		c.Set(i, strconv.Itoa(i))
+	}
+
+	if got := slices.Collect(c.Keys()); !slices.Equal(got, []int{2, 3, 4}) {
+		t.Errorf("expected keys %v, got %v", []int{2, 3, 4}, got)
+	}
+	compareSlice(t, []string{"2", "3", "4"}, slices.Collect(c.Values()))
+}
+
+func TestTxAllUnlockedPanics(t *testing.T) {
+	tx := NewLocker[string, string](NewMapCache[string, string]()).RLock()
+	seq := tx.All()
+	tx.Unlock()
+
+	if !panics(func() {
+		for range seq {
+		}
+	}) {
+		t.Error("expected iteration over unlocked Tx to panic")
+	}
+}
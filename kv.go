@@ -2,6 +2,9 @@ package geche
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"iter"
 	"sync"
 )
 
@@ -25,6 +28,9 @@ type trieNode struct {
 	// Fastpath to first node on the next level for DFS.
 	nextLevelHead *trieNode
 
+	// Number of terminal nodes in the subtree of this node (including itself).
+	count int
+
 	terminal bool
 }
 
@@ -95,28 +101,81 @@ func (n *trieNode) removeFromList(c byte) (*trieNode, bool) {
 }
 
 type KV[V any] struct {
-	data Geche[string, V]
-	trie *trieNode
-	mux  sync.RWMutex
+	data    Geche[string, V]
+	trie    *trieNode
+	mux     sync.RWMutex
+	evicted evictQueue[string]
+
+	watch     watchHub[string, V]
+	evictType EventType
 }
 
+// NewKV creates a new KV wrapper over the cache.
+// If the cache implements EvictionNotifier (e.g. MapTTLCache or RingBuffer),
+// KV subscribes to its evictions and removes evicted keys from the trie.
 func NewKV[V any](
 	cache Geche[string, V],
 ) *KV[V] {
-	kv := KV[V]{
+	kv := &KV[V]{
 		data: cache,
 		trie: &trieNode{
 			down: make(map[byte]*trieNode),
 		},
+		evictType: evictEventType(cache),
 	}
 
-	return &kv
+	subscribeEvict(cache, kv.onEvict)
+
+	return kv
+}
+
+// onEvict is called by the underlying cache when the key is evicted.
+// The trie is pruned via the eviction queue (see evictQueue.add),
+// subscribers are notified right away.
+func (kv *KV[V]) onEvict(key string, value V) {
+	kv.evicted.add(key, &kv.mux, kv.pruneKey)
+
+	if kv.watch.active() {
+		kv.watch.add(Event[string, V]{Type: kv.evictType, Key: key, Old: value, HasOld: true})
+		kv.watch.flush()
+	}
+}
+
+// Watch subscribes to changes of the cache. Events are sent to the returned
+// channel until ctx is done, then the channel is closed.
+// If the underlying cache implements EvictionNotifier, evictions are sent
+// as EventExpire for MapTTLCache and as EventEvict for other caches.
+// DeleteByPrefix sends EventDel for every deleted key.
+func (kv *KV[V]) Watch(ctx context.Context, filter WatchFilter[string]) <-chan Event[string, V] {
+	return kv.watch.watch(ctx, filter)
+}
+
+// WatchPrefix is like Watch, but only events of keys starting
+// with the prefix are sent (and EventClear).
+func (kv *KV[V]) WatchPrefix(ctx context.Context, prefix string, filter WatchFilter[string]) <-chan Event[string, V] {
+	return kv.watch.watch(ctx, prefixFilter(filter, prefix))
+}
+
+// pruneEvicted removes queued evicted keys from the trie.
+// Keys that were set again after eviction are kept.
+// Should be called with the write lock held.
+func (kv *KV[V]) pruneEvicted() {
+	kv.evicted.drain(kv.pruneKey)
+}
+
+func (kv *KV[V]) pruneKey(key string) {
+	if _, err := kv.data.Get(key); errors.Is(err, ErrNotFound) {
+		kv.deleteFromTrie(key)
+	}
 }
 
 func (kv *KV[V]) SetIfPresent(key string, value V) (V, bool) {
 	kv.mux.Lock()
+	defer kv.watch.flush()
 	defer kv.mux.Unlock()
 
+	defer kv.pruneEvicted()
+
 	previousVal, err := kv.data.Get(key)
 	if err == nil {
 		kv.set(key, value)
@@ -128,8 +187,11 @@ func (kv *KV[V]) SetIfPresent(key string, value V) (V, bool) {
 
 func (kv *KV[V]) SetIfAbsent(key string, value V) (V, bool) {
 	kv.mux.Lock()
+	defer kv.watch.flush()
 	defer kv.mux.Unlock()
 
+	defer kv.pruneEvicted()
+
 	previousVal, err := kv.data.Get(key)
 	if err == nil {
 		return previousVal, false
@@ -143,9 +205,11 @@ func (kv *KV[V]) SetIfAbsent(key string, value V) (V, bool) {
 // Panics if key is empty.
 func (kv *KV[V]) Set(key string, value V) {
 	kv.mux.Lock()
+	defer kv.watch.flush()
 	defer kv.mux.Unlock()
 
 	kv.set(key, value)
+	kv.pruneEvicted()
 }
 
 func commonPrefixLen(a, b []byte) int {
@@ -161,23 +225,49 @@ func commonPrefixLen(a, b []byte) int {
 
 // Depth First Search starts with last node of the key prefix and traverses the trie,
 // appending all terminal nodes to the result.
+// Keys not found in the underlying cache (evicted, but not pruned yet) are skipped.
 func (kv *KV[V]) dfs(node *trieNode, prefix []byte) ([]V, error) {
 	res := []V{}
-	key := make([]byte, len(prefix), maxKeyLength)
+	var err error
+	kv.walk(node, prefix, func(key []byte) bool {
+		var val V
+		val, err = kv.data.Get(string(key))
+		if errors.Is(err, ErrNotFound) {
+			err = nil
+			return true
+		}
+		if err != nil {
+			return false
+		}
+		res = append(res, val)
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// walk starts with last node of the key prefix and traverses the trie
+// in key order, calling fn with the key of each terminal node.
+// Key slice is reused, so fn should copy it if it needs to keep it.
+// Stops and returns false as soon as fn returns false.
+func (kv *KV[V]) walk(node *trieNode, prefix []byte, fn func(key []byte) bool) bool {
+	key := make([]byte, len(prefix), max(len(prefix), maxKeyLength))
 	copy(key, prefix)
 
-	// If last node of the prefix is terminal, add it to the result.
+	// If last node of the prefix is terminal, it goes first.
 	if node.terminal {
-		val, err := kv.data.Get(string(prefix))
-		if err != nil {
-			return nil, err
+		if !fn(key) {
+			return false
 		}
-		res = append(res, val)
 	}
 
 	// If the node does not contain any descendants, return.
 	if node.nextLevelHead == nil {
-		return res, nil
+		return true
 	}
 
 	// Instead of recursive DFS, we use stack-based approach.
@@ -186,8 +276,6 @@ func (kv *KV[V]) dfs(node *trieNode, prefix []byte) ([]V, error) {
 	var (
 		top       *trieNode
 		prevDepth int
-		err       error
-		val       V
 	)
 	for len(stack) > 0 {
 		// Pop the top node from the stack.
@@ -214,11 +302,9 @@ func (kv *KV[V]) dfs(node *trieNode, prefix []byte) ([]V, error) {
 		prevDepth = top.d
 
 		if top.terminal {
-			val, err = kv.data.Get(string(key))
-			if err != nil {
-				return nil, err
+			if !fn(key) {
+				return false
 			}
-			res = append(res, val)
 		}
 
 		// Appending next node of the level to the stack.
@@ -232,7 +318,7 @@ func (kv *KV[V]) dfs(node *trieNode, prefix []byte) ([]V, error) {
 		}
 	}
 
-	return res, nil
+	return true
 }
 
 func (kv *KV[V]) ListByPrefix(prefix string) ([]V, error) {
@@ -250,7 +336,13 @@ func (kv *KV[V]) ListByPrefix(prefix string) ([]V, error) {
 		if len(next.b) > 1 && len(next.b) >= len(prefix)-i {
 			if bytes.Equal(next.b[:len(prefix)-i], []byte(prefix)[i:]) {
 				v, err := kv.data.Get(prefix + string(next.b[len(prefix)-i:]))
-				return []V{v}, err
+				if errors.Is(err, ErrNotFound) {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				return []V{v}, nil
 			}
 		}
 		node = next
@@ -267,7 +359,42 @@ func (kv *KV[V]) Get(key string) (V, error) {
 // Del key from the underlying cache.
 func (kv *KV[V]) Del(key string) error {
 	kv.mux.Lock()
+	defer kv.watch.flush()
 	defer kv.mux.Unlock()
+	defer kv.pruneEvicted()
+
+	kv.deleteFromTrie(key)
+	return kv.del(key)
+}
+
+// del deletes the key from the underlying cache and sends EventDel
+// if the key existed. Should be called with the write lock held.
+func (kv *KV[V]) del(key string) error {
+	if !kv.watch.active() {
+		return kv.data.Del(key)
+	}
+
+	old, err := kv.data.Get(key)
+	if delErr := kv.data.Del(key); delErr != nil {
+		return delErr
+	}
+	if err == nil {
+		kv.watch.add(Event[string, V]{Type: EventDel, Key: key, Old: old, HasOld: true})
+	}
+
+	return nil
+}
+
+// deleteFromTrie removes the key from the trie
+// along with the nodes left with no descendants.
+func (kv *KV[V]) deleteFromTrie(key string) {
+	if key == "" {
+		if kv.trie.terminal {
+			kv.trie.terminal = false
+			kv.trie.count--
+		}
+		return
+	}
 
 	node := kv.trie
 	stack := []*trieNode{}
@@ -276,7 +403,7 @@ func (kv *KV[V]) Del(key string) error {
 		next := node.down[key[i]]
 		if next == nil {
 			// If we are here, the key does not exist.
-			return kv.data.Del(key)
+			return
 		}
 
 		stack = append(stack, node)
@@ -291,9 +418,10 @@ func (kv *KV[V]) Del(key string) error {
 
 	if !found {
 		// If we are here, the key does not exist.
-		return kv.data.Del(key)
+		return
 	}
 
+	kv.addCount(key, -1)
 	node.terminal = false
 
 	// Go back the stack removing nodes with no descendants.
@@ -314,8 +442,103 @@ func (kv *KV[V]) Del(key string) error {
 
 		node = prev
 	}
+}
+
+// DeleteByPrefix removes all keys starting with the given prefix from the trie
+// and the underlying cache, and returns the number of removed keys.
+// The whole subtree is detached from the trie in one operation.
+func (kv *KV[V]) DeleteByPrefix(prefix string) int {
+	kv.mux.Lock()
+	defer kv.watch.flush()
+	defer kv.mux.Unlock()
+	defer kv.pruneEvicted()
+
+	node, path, stack := kv.findPrefix(prefix)
+	if node == nil || node.count == 0 {
+		return 0
+	}
+
+	n := node.count
+	kv.walk(node, path, func(key []byte) bool {
+		_ = kv.del(string(key))
+		return true
+	})
+
+	if node == kv.trie {
+		kv.trie = &trieNode{
+			down: make(map[byte]*trieNode),
+		}
+		return n
+	}
+
+	for _, prev := range stack {
+		prev.count -= n
+	}
 
-	return kv.data.Del(key)
+	// Detach the subtree and remove ancestors left with no descendants.
+	for i := len(stack) - 1; i >= 0; i-- {
+		prev := stack[i]
+		head, empty := prev.nextLevelHead.removeFromList(node.b[0])
+		if head != nil || empty {
+			prev.nextLevelHead = head
+		}
+		delete(prev.down, node.b[0])
+
+		if prev == kv.trie || prev.terminal || prev.nextLevelHead != nil {
+			break
+		}
+		node = prev
+	}
+
+	return n
+}
+
+// CountByPrefix returns the number of keys starting with the given prefix.
+// Subtree counts are maintained in the trie nodes, so it does not
+// traverse the subtree. Keys evicted from the underlying cache are
+// not counted once KV has been notified (see EvictionNotifier).
+// Keys that disappear without notification are still counted
+// until they are deleted through KV.
+func (kv *KV[V]) CountByPrefix(prefix string) int {
+	kv.mux.RLock()
+	defer kv.mux.RUnlock()
+
+	node, _, _ := kv.findPrefix(prefix)
+	if node == nil {
+		return 0
+	}
+
+	return node.count
+}
+
+// findPrefix returns the topmost node which subtree contains all keys
+// starting with the prefix, the full path of that node, and its ancestors.
+// Returns nil node if there are no keys with the prefix.
+func (kv *KV[V]) findPrefix(prefix string) (*trieNode, []byte, []*trieNode) {
+	var (
+		path  []byte
+		stack []*trieNode
+	)
+
+	node := kv.trie
+	for i := 0; i < len(prefix); {
+		next := node.down[prefix[i]]
+		if next == nil {
+			return nil, nil, nil
+		}
+
+		common := commonPrefixLen(next.b, []byte(prefix[i:]))
+		if common < len(next.b) && common < len(prefix)-i {
+			return nil, nil, nil
+		}
+
+		stack = append(stack, node)
+		path = append(path, next.b...)
+		node = next
+		i += len(next.b)
+	}
+
+	return node, path, stack
 }
 
 // Snapshot returns a shallow copy of the cache data.
@@ -333,17 +556,72 @@ func (kv *KV[V]) Len() int {
 // Clear removes all elements from the cache and resets the trie.
 func (kv *KV[V]) Clear() {
 	kv.mux.Lock()
+	defer kv.watch.flush()
 	defer kv.mux.Unlock()
 
 	kv.data.Clear()
 	kv.trie = &trieNode{
 		down: make(map[byte]*trieNode),
 	}
+	kv.evicted.reset()
+
+	if kv.watch.active() {
+		kv.watch.add(Event[string, V]{Type: EventClear})
+	}
 }
 
 func (kv *KV[V]) set(key string, value V) {
+	if kv.watch.active() {
+		// Event is queued after the value is set.
+		old, err := kv.data.Get(key)
+		defer kv.watch.add(Event[string, V]{Type: EventSet, Key: key, Old: old, HasOld: err == nil, New: value})
+	}
+
 	kv.data.Set(key, value)
 
+	if kv.find(key) != nil {
+		// Key is already in the trie.
+		return
+	}
+
+	kv.insert(key)
+	kv.addCount(key, 1)
+}
+
+// find returns the terminal node of the key or nil if there is no such key in the trie.
+func (kv *KV[V]) find(key string) *trieNode {
+	node := kv.trie
+	for i := 0; i < len(key); {
+		next := node.down[key[i]]
+		if next == nil || len(next.b) > len(key)-i || string(next.b) != key[i:i+len(next.b)] {
+			return nil
+		}
+		i += len(next.b)
+		node = next
+	}
+
+	if !node.terminal {
+		return nil
+	}
+
+	return node
+}
+
+// addCount adds delta to subtree counts of all nodes on the path of the key.
+// Key must be present in the trie.
+func (kv *KV[V]) addCount(key string, delta int) {
+	node := kv.trie
+	node.count += delta
+	for i := 0; i < len(key); {
+		node = node.down[key[i]]
+		node.count += delta
+		i += len(node.b)
+	}
+}
+
+// insert adds the key to the trie. Subtree counts are not updated,
+// except for the new nodes that replace existing ones.
+func (kv *KV[V]) insert(key string) {
 	if key == "" {
 		kv.trie.terminal = true
 		return
@@ -391,9 +669,10 @@ func (kv *KV[V]) set(key string, value V) {
 			for i := 0; i < commonPrefixLen; i++ {
 				// Creating new single-byte node.
 				newNode := &trieNode{
-					b:    []byte{keyb[i]},
-					d:    node.d + 1,
-					down: make(map[byte]*trieNode),
+					b:     []byte{keyb[i]},
+					d:     node.d + 1,
+					down:  make(map[byte]*trieNode),
+					count: next.count,
 				}
 				node.down[keyb[i]] = newNode
 				if node.nextLevelHead == nil {
@@ -420,6 +699,7 @@ func (kv *KV[V]) set(key string, value V) {
 					b:        next.b[commonPrefixLen:],
 					d:        node.d + 1,
 					terminal: true,
+					count:    next.count,
 				}
 				node.down[next.b[commonPrefixLen]] = newNode
 				node.nextLevelHead = newNode
@@ -455,3 +735,39 @@ func (kv *KV[V]) set(key string, value V) {
 
 	node.terminal = true
 }
+
+// All is a (read-only) iterator over all key-value pairs in the cache
+// in lexicographical order of the keys.
+// Keys that are in the trie, but not found in the underlying cache
+// (e.g. expired), are skipped.
+// Attempt to modify the cache (Set/Del, etc.) while iterating will lead to
+// a deadlock.
+func (kv *KV[V]) All() iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		kv.mux.RLock()
+		defer kv.mux.RUnlock()
+
+		kv.walk(kv.trie, nil, func(key []byte) bool {
+			k := string(key)
+			v, err := kv.data.Get(k)
+			if err != nil {
+				return true
+			}
+			return yield(k, v)
+		})
+	}
+}
+
+// Keys is a (read-only) iterator over all keys in the cache
+// in lexicographical order.
+// Same locking rules as for All apply.
+func (kv *KV[V]) Keys() iter.Seq[string] {
+	return keysOf(kv.All())
+}
+
+// Values is a (read-only) iterator over all values in the cache
+// in lexicographical order of the keys.
+// Same locking rules as for All apply.
+func (kv *KV[V]) Values() iter.Seq[V] {
+	return valuesOf(kv.All())
+}
@@ -21,6 +21,15 @@ type trieCacheNode[K byteSlice] struct {
 	// index of the value in the values slice of the KVCache.
 	// Only valid if terminal is true.
 	valueIndex int
+	// count is the number of terminal nodes in the subtree of this node (including itself).
+	count int
+	// maxScore is the maximum score of the values in the subtree of this node.
+	// Only maintained when scoring is enabled (see SetWithScore).
+	maxScore float64
+	// gen is the generation in which children slice was allocated.
+	// While iterators are pinned, slices from the older generations
+	// are shared with pinned versions and must be copied before modification.
+	gen uint64
 	// b0 is the first byte of the path segment b.
 	b0 byte
 	// terminal indicates if this node represents the end of a valid key.
@@ -35,6 +44,28 @@ type KVCache[K byteSlice, V any] struct {
 	trie     *trieCacheNode[K]
 	mux      sync.RWMutex
 	zero     V
+
+	// Scores of the values (parallel to values slice) and score function.
+	// Scores are nil until scoring is enabled by SetWithScore or SetScoreFunc.
+	scores    []float64
+	scoreFunc func(V) float64
+
+	// Number of iterators that use pinned versions of the trie and current generation.
+	// See kv_cache_version.go.
+	pins int
+	gen  uint64
+	// Indices of the values deleted while some versions were pinned.
+	// They are returned to the freelist when the last version is unpinned.
+	pendingFree []int
+
+	// Share of free slots that triggers automatic compaction.
+	// See kv_cache_compact.go.
+	compactRatio float64
+
+	// Subscribers of the changes and removal listeners.
+	// See kv_cache_watch.go and kv_cache_notify.go.
+	watch    watchHub[K, V]
+	removals removals[K, V]
 }
 
 // NewKVCache creates a new KVCache.
@@ -47,18 +78,18 @@ func NewKVCache[K byteSlice, V any]() *KVCache[K, V] {
 // Set sets the value for the key.
 func (kv *KVCache[K, V]) Set(key K, value V) {
 	kv.mux.Lock()
-	defer kv.mux.Unlock()
+	defer kv.unlock()
 
-	kv.insert(key, value)
+	kv.set(key, value)
 }
 
 // SetIfPresent sets the value only if the key already exists.
 func (kv *KVCache[K, V]) SetIfPresent(key K, value V) (V, bool) {
 	kv.mux.Lock()
-	defer kv.mux.Unlock()
+	defer kv.unlock()
 
 	if old, found := kv.get(key); found {
-		kv.insert(key, value)
+		kv.set(key, value)
 		return old, true
 	}
 
@@ -67,14 +98,14 @@ func (kv *KVCache[K, V]) SetIfPresent(key K, value V) (V, bool) {
 
 func (kv *KVCache[K, V]) SetIfAbsent(key K, value V) (V, bool) {
 	kv.mux.Lock()
-	defer kv.mux.Unlock()
+	defer kv.unlock()
 
 	old, found := kv.get(key)
 	if found {
 		return old, false
 	}
 
-	kv.insert(key, value)
+	kv.set(key, value)
 	return kv.zero, true
 }
 
@@ -93,22 +124,24 @@ func (kv *KVCache[K, V]) Get(key K) (V, error) {
 
 // Del removes the record by key.
 // Return value is always nil.
-func (kv *KVCache[K, V]) Del(key string) error {
+func (kv *KVCache[K, V]) Del(key K) error {
 	kv.mux.Lock()
-	defer kv.mux.Unlock()
+	defer kv.unlock()
 
-	_ = kv.delete(stringToKey[K](key))
+	kv.beforeDel(key)
+	_ = kv.delete(key)
+	kv.maybeCompact()
 
 	return nil
 }
 
 // ListByPrefix returns all values with keys starting with the given prefix.
-func (kv *KVCache[K, V]) ListByPrefix(prefix string) ([]V, error) {
+func (kv *KVCache[K, V]) ListByPrefix(prefix K) ([]V, error) {
 	kv.mux.RLock()
 	defer kv.mux.RUnlock()
 
 	node := kv.trie
-	searchKey := stringToKey[K](prefix)
+	searchKey := prefix
 
 	for len(searchKey) > 0 {
 		idx, found := node.findChild(searchKey[0])
@@ -135,23 +168,95 @@ func (kv *KVCache[K, V]) ListByPrefix(prefix string) ([]V, error) {
 	return kv.dfs(kv.trie)
 }
 
+// DeleteByPrefix removes all keys starting with the given prefix
+// and returns the number of removed keys.
+// The whole subtree is detached from the trie in one operation.
+func (kv *KVCache[K, V]) DeleteByPrefix(prefix K) int {
+	kv.mux.Lock()
+	defer kv.unlock()
+
+	path, ok := kv.findPrefixOwned(prefix)
+	if !ok {
+		return 0
+	}
+	kv.beforeRemovePrefix(prefix, RemovalDeleted)
+
+	if len(path) == 0 {
+		n := kv.len()
+		kv.clear()
+		return n
+	}
+
+	target := path[len(path)-1]
+	n := target.node.count
+
+	// Return values of the subtree to the freelist.
+	stack := []*trieCacheNode[K]{target.node}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.terminal {
+			kv.deleteValueAtIndex(top.valueIndex)
+		}
+		for i := range top.children {
+			stack = append(stack, &top.children[i])
+		}
+	}
+
+	kv.trie.count -= n
+	for _, e := range path[:len(path)-1] {
+		e.node.count -= n
+	}
+
+	// Mark the target as empty, so cleanup will remove it.
+	target.node.children = nil
+	target.node.terminal = false
+	target.node.count = 0
+	if kv.scores != nil {
+		kv.updateMaxScores(path)
+	}
+	cleanupPath(path)
+	kv.maybeCompact()
+
+	return n
+}
+
+// CountByPrefix returns the number of keys starting with the given prefix.
+// Subtree counts are maintained in the trie nodes, so it does not
+// traverse the subtree.
+func (kv *KVCache[K, V]) CountByPrefix(prefix K) int {
+	kv.mux.RLock()
+	defer kv.mux.RUnlock()
+
+	path, ok := kv.findPrefix(prefix)
+	if !ok {
+		return 0
+	}
+
+	if len(path) == 0 {
+		return kv.trie.count
+	}
+
+	return path[len(path)-1].node.count
+}
+
 // AllByPrefix returns an (read only) iterator over values with keys starting with the given prefix.
 // The iterator yields key-value pairs.
-// Attempting to modify the cache while iterating will lead to a deadlock.
-// Iterator holds RLock on the cache for the whole iteration, so it is not recommended
-// to use it for long-running loops if cache can be accessed concurrently.
-func (kv *KVCache[K, V]) AllByPrefix(prefix string) iter.Seq2[string, V] {
-	return func(yield func(string, V) bool) {
-		kv.mux.RLock()
-		defer kv.mux.RUnlock()
-
-		node := kv.trie
+// Iterator pins a point-in-time version of the cache and does not hold the lock
+// while iterating, so it does not block writers and does not observe changes made
+// after the iteration has started. Cache can be modified inside the loop body.
+// When K is a byte slice, yielded keys are not copied: the key slice is only valid
+// until the next iteration and must not be modified. Use bytes.Clone to retain it.
+func (kv *KVCache[K, V]) AllByPrefix(prefix K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		node, values := kv.pin()
+		defer kv.unpin()
 
 		// path is the reconstructed key for the DFS traversal starting node.
 		var path []byte
 
 		if len(prefix) > 0 {
-			searchKey := stringToKey[K](prefix)
+			searchKey := prefix
 			var pathPrefix []byte
 			for len(searchKey) > 0 {
 				idx, found := node.findChild(searchKey[0])
@@ -183,7 +288,7 @@ func (kv *KVCache[K, V]) AllByPrefix(prefix string) iter.Seq2[string, V] {
 
 		// 2. Stack-based DFS from the found node.
 		if node.terminal {
-			if !yield(string(path), kv.values[node.valueIndex]) {
+			if !yield(bytesToKey[K](path), values[node.valueIndex]) {
 				return
 			}
 		}
@@ -211,7 +316,7 @@ func (kv *KVCache[K, V]) AllByPrefix(prefix string) iter.Seq2[string, V] {
 			path = append(path, keyToString(top.node.b)...)
 
 			if top.node.terminal {
-				if !yield(string(path), kv.values[top.node.valueIndex]) {
+				if !yield(bytesToKey[K](path), values[top.node.valueIndex]) {
 					return
 				}
 			}
@@ -226,22 +331,43 @@ func (kv *KVCache[K, V]) AllByPrefix(prefix string) iter.Seq2[string, V] {
 	}
 }
 
+// All is a (read-only) iterator over all key-value pairs in the cache
+// in lexicographical order of the keys.
+// Same rules as for AllByPrefix apply.
+func (kv *KVCache[K, V]) All() iter.Seq2[K, V] {
+	var prefix K
+	return kv.AllByPrefix(prefix)
+}
+
+// Keys is a (read-only) iterator over all keys in the cache
+// in lexicographical order.
+// Same rules as for AllByPrefix apply.
+func (kv *KVCache[K, V]) Keys() iter.Seq[K] {
+	return keysOf(kv.All())
+}
+
+// Values is a (read-only) iterator over all values in the cache
+// in lexicographical order of the keys.
+// Same rules as for AllByPrefix apply.
+func (kv *KVCache[K, V]) Values() iter.Seq[V] {
+	return valuesOf(kv.All())
+}
+
 // Snapshot returns a copy of the cache.
+// Keys of the map are strings, since byte slices can't be used as map keys.
 func (kv *KVCache[K, V]) Snapshot() map[string]V {
 	kv.mux.RLock()
 	res := make(map[string]V, kv.len())
 	kv.mux.RUnlock()
 
-	seq := kv.AllByPrefix("")
-	seq(func(k string, v V) bool {
-		res[k] = v
-		return true
-	})
+	for k, v := range kv.All() {
+		res[string(k)] = v
+	}
 	return res
 }
 
 func (kv *KVCache[K, V]) len() int {
-	return max(0, len(kv.values)-len(kv.freelist))
+	return max(0, len(kv.values)-len(kv.freelist)-len(kv.pendingFree))
 }
 
 // Len returns the number of the values in the cache.
@@ -253,9 +379,31 @@ func (kv *KVCache[K, V]) Len() int {
 }
 
 // Clear removes all elements from the cache while preserving allocated capacities.
+// Call Compact after Clear to release the memory.
 func (kv *KVCache[K, V]) Clear() {
 	kv.mux.Lock()
-	defer kv.mux.Unlock()
+	defer kv.unlock()
+
+	var all K
+	kv.beforeRemovePrefix(all, RemovalCleared)
+	kv.clear()
+	if kv.watch.active() {
+		kv.watch.add(Event[K, V]{Type: EventClear})
+	}
+}
+
+func (kv *KVCache[K, V]) clear() {
+	if kv.pins > 0 {
+		// Pinned versions still use the data, so it is replaced instead.
+		kv.values = nil
+		kv.freelist = nil
+		kv.pendingFree = nil
+		kv.trie = &trieCacheNode[K]{gen: kv.gen}
+		if kv.scores != nil {
+			kv.scores = []float64{}
+		}
+		return
+	}
 
 	clear(kv.values)
 	kv.values = kv.values[:0]
@@ -267,6 +415,13 @@ func (kv *KVCache[K, V]) Clear() {
 	kv.trie.children = kv.trie.children[:0]
 	kv.trie.terminal = false
 	kv.trie.valueIndex = 0
+	kv.trie.count = 0
+	kv.trie.maxScore = 0
+
+	clear(kv.scores)
+	if kv.scores != nil {
+		kv.scores = kv.scores[:0]
+	}
 }
 
 // --- Internal Trie Helpers ---
@@ -300,6 +455,65 @@ func (kv *KVCache[K, V]) get(key K) (V, bool) {
 	return kv.zero, false
 }
 
+// findPrefix returns the path from the root to the topmost node
+// which subtree contains all keys starting with the prefix.
+// Empty path means that it is the root node.
+// Returns false if there are no keys with the prefix.
+func (kv *KVCache[K, V]) findPrefix(prefix K) ([]trieCachePathEntry[K], bool) {
+	return kv.findPath(prefix, false)
+}
+
+// findPrefixOwned is like findPrefix, but also makes the nodes
+// on the path safe to modify (see ownChildren).
+func (kv *KVCache[K, V]) findPrefixOwned(prefix K) ([]trieCachePathEntry[K], bool) {
+	if kv.pins > 0 {
+		// Avoid copying the path if there are no keys with the prefix.
+		if _, ok := kv.findPath(prefix, false); !ok {
+			return nil, false
+		}
+	}
+
+	return kv.findPath(prefix, true)
+}
+
+func (kv *KVCache[K, V]) findPath(prefix K, own bool) ([]trieCachePathEntry[K], bool) {
+	var path []trieCachePathEntry[K]
+
+	if own {
+		kv.ownRoot()
+	}
+	node := kv.trie
+	for len(prefix) > 0 {
+		if own {
+			kv.ownChildren(node)
+		}
+		idx, found := node.findChild(prefix[0])
+		if !found {
+			return nil, false
+		}
+
+		child := &node.children[idx]
+		common := commonPrefixLenK(child.b, prefix)
+		if common < len(prefix) && common < len(child.b) {
+			return nil, false
+		}
+
+		path = append(path, trieCachePathEntry[K]{
+			node:     child,
+			parent:   node,
+			childIdx: idx,
+		})
+		if common == len(prefix) {
+			break
+		}
+
+		node = child
+		prefix = prefix[common:]
+	}
+
+	return path, true
+}
+
 func (kv *KVCache[K, V]) addValue(value V) int {
 	if len(kv.freelist) > 0 {
 		idx := kv.freelist[len(kv.freelist)-1]
@@ -312,21 +526,37 @@ func (kv *KVCache[K, V]) addValue(value V) int {
 	return len(kv.values) - 1
 }
 
+// incCounts increments subtree counts of the nodes on the path.
+func incCounts[K byteSlice](path []*trieCacheNode[K]) {
+	for _, n := range path {
+		n.count++
+	}
+}
+
 func (kv *KVCache[K, V]) insert(key K, value V) {
+	kv.ownRoot()
 	node := kv.trie
 
+	// Nodes on the path to the key, their subtree counts are incremented
+	// if a new key is added. Pointers are stable, since only children
+	// of the last node can be reallocated.
+	var pathBuf [32]*trieCacheNode[K]
+	path := append(pathBuf[:0], node)
+
 	searchKey := key
 	if len(searchKey) == 0 {
 		if !node.terminal {
 			node.valueIndex = kv.addValue(value)
 			node.terminal = true
+			node.count++
 		} else {
-			kv.values[node.valueIndex] = value
+			kv.replaceValue(node, value)
 		}
 		return
 	}
 
 	for len(searchKey) > 0 {
+		kv.ownChildren(node)
 		idx, found := node.findChild(searchKey[0])
 
 		if !found {
@@ -335,8 +565,10 @@ func (kv *KVCache[K, V]) insert(key K, value V) {
 				b:          searchKey,
 				terminal:   true,
 				valueIndex: kv.addValue(value),
+				count:      1,
 			}
 			node.addChildAt(newNode, idx)
+			incCounts(path)
 			return
 		}
 
@@ -351,14 +583,16 @@ func (kv *KVCache[K, V]) insert(key K, value V) {
 		if common == len(child.b) {
 			searchKey = searchKey[common:]
 			node = child
+			path = append(path, node)
 			if len(searchKey) == 0 {
 				// We found the full key, update value if node is terminal,
 				// otherwise mark node as terminal and insert value.
 				if !node.terminal {
 					node.valueIndex = kv.addValue(value)
 					node.terminal = true
+					incCounts(path)
 				} else {
-					kv.values[node.valueIndex] = value
+					kv.replaceValue(node, value)
 				}
 				return
 			}
@@ -377,11 +611,17 @@ func (kv *KVCache[K, V]) insert(key K, value V) {
 			children:   child.children,
 			terminal:   child.terminal,
 			valueIndex: child.valueIndex,
+			count:      child.count,
+			maxScore:   child.maxScore,
+			gen:        child.gen,
 		}
 
 		// Reset current child to be the branch.
 		child.b = child.b[:common]
 		child.terminal = false
+		child.count++
+		child.gen = kv.gen
+		incCounts(path)
 
 		if len(newSuffix) == 0 {
 			child.terminal = true
@@ -393,6 +633,7 @@ func (kv *KVCache[K, V]) insert(key K, value V) {
 				b:          newSuffix,
 				terminal:   true,
 				valueIndex: kv.addValue(value),
+				count:      1,
 			}
 			// Pre-build 2-element child slice directly in sorted order.
 			if origSuffix[0] < newSuffix[0] {
@@ -406,22 +647,73 @@ func (kv *KVCache[K, V]) insert(key K, value V) {
 }
 
 func (kv *KVCache[K, V]) deleteValueAtIndex(idx int) {
+	if kv.pins > 0 {
+		// Value can still be used by pinned versions.
+		kv.pendingFree = append(kv.pendingFree, idx)
+		return
+	}
+
 	// Clear the value, so if it is a pointer or contains pointers,
 	// GC can collect the memory.
 	kv.values[idx] = kv.zero
+	if idx < len(kv.scores) {
+		kv.scores[idx] = 0
+	}
 	// Add index to the freelist, so it can be reused.
 	kv.freelist = append(kv.freelist, idx)
 }
 
+// trieCachePathEntry is a step of the path from the root to the node.
+type trieCachePathEntry[K byteSlice] struct {
+	node     *trieCacheNode[K]
+	parent   *trieCacheNode[K]
+	childIdx int
+}
+
+// cleanupPath walks back the path removing childless non-terminal nodes
+// and merging non-terminal nodes having a single child with that child.
+func cleanupPath[K byteSlice](path []trieCachePathEntry[K]) {
+	for i := len(path) - 1; i >= 0; i-- {
+		pNode := path[i].node
+		pParent := path[i].parent
+		childIdx := path[i].childIdx
+
+		if len(pNode.children) == 0 && !pNode.terminal {
+			// Case 1: Delete empty non-terminal node
+			// Remove child from slice
+			copy(pParent.children[childIdx:], pParent.children[childIdx+1:])
+			pParent.children[len(pParent.children)-1] = trieCacheNode[K]{}
+			pParent.children = pParent.children[:len(pParent.children)-1]
+		} else if len(pNode.children) == 1 && !pNode.terminal {
+			// Case 2: Merge node with its single child
+			child := pNode.children[0]
+
+			pNode.b = concatKeys(pNode.b, child.b)
+			pNode.terminal = child.terminal
+			pNode.valueIndex = child.valueIndex
+			pNode.children = child.children
+			pNode.count = child.count
+			pNode.maxScore = child.maxScore
+			pNode.gen = child.gen
+		} else {
+			// Node is stable (has >1 children or is terminal), stop cleanup
+			break
+		}
+	}
+}
+
 func (kv *KVCache[K, V]) delete(key K) error {
-	// Track path for cleanup phase
-	type pathEntry struct {
-		node     *trieCacheNode[K]
-		parent   *trieCacheNode[K]
-		childIdx int
+	if kv.pins > 0 {
+		// Avoid copying the path if there is nothing to delete.
+		if _, ok := kv.get(key); !ok {
+			return nil
+		}
 	}
-	var path []pathEntry
 
+	// Track path for cleanup phase
+	var path []trieCachePathEntry[K]
+
+	kv.ownRoot()
 	node := kv.trie
 	keyPart := key
 
@@ -433,35 +725,21 @@ func (kv *KVCache[K, V]) delete(key K) error {
 				node.terminal = false
 				kv.deleteValueAtIndex(node.valueIndex)
 
-				// Phase 2: Cleanup - walk back and remove childless non-terminal nodes
-				for i := len(path) - 1; i >= 0; i-- {
-					pNode := path[i].node
-					pParent := path[i].parent
-					childIdx := path[i].childIdx
-
-					if len(pNode.children) == 0 && !pNode.terminal {
-						// Case 1: Delete empty non-terminal node
-						// Remove child from slice
-						copy(pParent.children[childIdx:], pParent.children[childIdx+1:])
-						pParent.children[len(pParent.children)-1] = trieCacheNode[K]{}
-						pParent.children = pParent.children[:len(pParent.children)-1]
-					} else if len(pNode.children) == 1 && !pNode.terminal {
-						// Case 2: Merge node with its single child
-						child := pNode.children[0]
-
-						pNode.b = concatKeys(pNode.b, child.b)
-						pNode.terminal = child.terminal
-						pNode.valueIndex = child.valueIndex
-						pNode.children = child.children
-					} else {
-						// Node is stable (has >1 children or is terminal), stop cleanup
-						break
-					}
+				kv.trie.count--
+				for _, e := range path {
+					e.node.count--
+				}
+				if kv.scores != nil {
+					kv.updateMaxScores(path)
 				}
+
+				// Phase 2: Cleanup - walk back and remove childless non-terminal nodes
+				cleanupPath(path)
 			}
 			return nil
 		}
 
+		kv.ownChildren(node)
 		idx, found := node.findChild(keyPart[0])
 		if !found {
 			// Key doesn't exist, nothing to delete
@@ -477,7 +755,7 @@ func (kv *KVCache[K, V]) delete(key K) error {
 		}
 
 		// Record path for cleanup
-		path = append(path, pathEntry{
+		path = append(path, trieCachePathEntry[K]{
 			node:     child,
 			parent:   node,
 			childIdx: idx,
@@ -575,6 +853,17 @@ func stringToKey[K byteSlice](s string) (k K) {
 	return k
 }
 
+// bytesToKey converts a byte slice to K. When K is a byte slice,
+// it is returned as is without copying, otherwise it is copied to a new string.
+func bytesToKey[K byteSlice](b []byte) (k K) {
+	if unsafe.Sizeof(k) == unsafe.Sizeof("") {
+		*(*string)(unsafe.Pointer(&k)) = string(b)
+	} else {
+		*(*[]byte)(unsafe.Pointer(&k)) = b
+	}
+	return k
+}
+
 // keyToString converts K to a string representation.
 func keyToString[K byteSlice](k K) string {
 	return *(*string)(unsafe.Pointer(&k))
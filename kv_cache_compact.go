@@ -0,0 +1,103 @@
+package geche
+
+// Values of KVCache are stored in a single slice and trie nodes refer to them
+// by index. Deleted slots are kept in the freelist to be reused by next
+// insertions, so the values slice never shrinks on its own. Compact rebuilds
+// the trie and the values slice, so memory of deleted records is released.
+
+// minAutoCompactLen is the minimal length of the values slice
+// for automatic compaction to kick in. Small caches are not worth compacting.
+const minAutoCompactLen = 1024
+
+// Compact renumbers live values into a new dense slice, rewriting value indices
+// in the trie nodes, and trims children slices of the nodes to their length.
+// The freelist is emptied and memory occupied by deleted records is released.
+// Compaction copies the whole trie, so it takes O(n) time under the write lock.
+// Versions pinned by running iterators are not affected.
+func (kv *KVCache[K, V]) Compact() {
+	kv.mux.Lock()
+	defer kv.mux.Unlock()
+
+	kv.compact()
+}
+
+// SetAutoCompact enables automatic compaction when the share of free slots
+// in the values slice exceeds the ratio (e.g. 0.5) after a deletion.
+// Caches with less than 1024 slots are never compacted automatically.
+// Zero or negative ratio disables automatic compaction (default).
+func (kv *KVCache[K, V]) SetAutoCompact(ratio float64) {
+	kv.mux.Lock()
+	defer kv.mux.Unlock()
+
+	kv.compactRatio = ratio
+	kv.maybeCompact()
+}
+
+// maybeCompact compacts the cache if automatic compaction is enabled
+// and the share of free slots exceeds the threshold.
+// Compaction is postponed while there are pinned versions,
+// since slots deleted meanwhile are not in the freelist yet.
+func (kv *KVCache[K, V]) maybeCompact() {
+	if kv.compactRatio <= 0 || kv.pins > 0 || len(kv.values) < minAutoCompactLen {
+		return
+	}
+
+	if float64(len(kv.freelist)) > kv.compactRatio*float64(len(kv.values)) {
+		kv.compact()
+	}
+}
+
+func (kv *KVCache[K, V]) compact() {
+	n := kv.len()
+	values := make([]V, 0, n)
+	var scores []float64
+	if kv.scores != nil {
+		scores = make([]float64, 0, n)
+	}
+
+	// New nodes belong to the current generation, so writers can modify them
+	// in place, while pinned versions keep using the old ones.
+	root := &trieCacheNode[K]{}
+
+	type stackEntry struct {
+		src *trieCacheNode[K]
+		dst *trieCacheNode[K]
+	}
+
+	// Nodes are visited in key order, so values end up sorted by key.
+	stack := []stackEntry{{src: kv.trie, dst: root}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		*top.dst = *top.src
+		top.dst.gen = kv.gen
+		top.dst.children = nil
+		if top.src.terminal {
+			top.dst.valueIndex = len(values)
+			values = append(values, kv.values[top.src.valueIndex])
+			if scores != nil {
+				scores = append(scores, kv.score(top.src.valueIndex))
+			}
+		}
+
+		if len(top.src.children) == 0 {
+			continue
+		}
+
+		top.dst.children = make([]trieCacheNode[K], len(top.src.children))
+		for i := len(top.src.children) - 1; i >= 0; i-- {
+			stack = append(stack, stackEntry{
+				src: &top.src.children[i],
+				dst: &top.dst.children[i],
+			})
+		}
+	}
+
+	kv.trie = root
+	kv.values = values
+	kv.scores = scores
+	kv.freelist = nil
+	// Slots deleted while versions are pinned belong to the old values slice.
+	kv.pendingFree = nil
+}
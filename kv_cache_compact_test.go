@@ -0,0 +1,170 @@
+package geche
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func ExampleKVCache_Compact() {
+	cache := NewKVCache[string, int]()
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("%03d", i), i)
+	}
+	cache.DeleteByPrefix("0")
+
+	cache.Compact()
+	fmt.Println(cache.Len(), len(cache.values), len(cache.freelist))
+	// Output: 900 900 0
+}
+
+// checkCompacted verifies that values slice is dense and sorted by key,
+// and children slices of all nodes are trimmed.
+func checkCompacted(t *testing.T, kv *KVCache[string, int]) {
+	t.Helper()
+
+	if len(kv.freelist) != 0 || len(kv.pendingFree) != 0 {
+		t.Fatalf("expected no free slots, got %d free and %d pending", len(kv.freelist), len(kv.pendingFree))
+	}
+	if len(kv.values) != kv.Len() || cap(kv.values) != kv.Len() {
+		t.Fatalf("expected %d values, got len %d cap %d", kv.Len(), len(kv.values), cap(kv.values))
+	}
+
+	i := 0
+	walkRange(kv.trie, keyRange{}, func(path []byte, node *trieCacheNode[string]) bool {
+		if node.valueIndex != i {
+			t.Fatalf("key %q has value index %d, expected %d", path, node.valueIndex, i)
+		}
+		i++
+		return true
+	})
+
+	stack := []*trieCacheNode[string]{kv.trie}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if cap(n.children) != len(n.children) {
+			t.Fatalf("node %q has children len %d cap %d", n.b, len(n.children), cap(n.children))
+		}
+		for i := range n.children {
+			stack = append(stack, &n.children[i])
+		}
+	}
+}
+
+func TestKVCacheCompact(t *testing.T) {
+	cache := NewKVCache[string, int]()
+	model := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		k := fmt.Sprintf("k%x", i*7919%10007)
+		cache.Set(k, i)
+		model[k] = i
+		if i%10 != 0 {
+			_ = cache.Del(k)
+			delete(model, k)
+		}
+	}
+	cache.SetWithScore("k1", 1, 10)
+	model["k1"] = 1
+
+	top := cache.TopByPrefix("k", 5)
+	cache.Compact()
+	checkCompacted(t, cache)
+	checkCounts(t, cache.trie, func(n *trieCacheNode[string]) int { return n.count })
+	checkMaxScores(t, cache, cache.trie)
+
+	if !maps.Equal(model, cache.Snapshot()) {
+		t.Fatal("cache content changed after compaction")
+	}
+	if got := cache.TopByPrefix("k", 5); !slices.Equal(top, got) {
+		t.Errorf("expected top %v, got %v", top, got)
+	}
+
+	// Compacted cache is still usable.
+	cache.Set("k1", 2)
+	cache.Set("new", 3)
+	_ = cache.Del("k0")
+	delete(model, "k0")
+	model["k1"], model["new"] = 2, 3
+	if !maps.Equal(model, cache.Snapshot()) {
+		t.Fatal("unexpected cache content after modification of compacted cache")
+	}
+}
+
+func TestKVCacheCompactPinned(t *testing.T) {
+	cache := NewKVCache[string, int]()
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("%02d", i), i)
+	}
+
+	n := 0
+	for k, v := range cache.All() {
+		if k != fmt.Sprintf("%02d", v) {
+			t.Fatalf("key %q has value %d", k, v)
+		}
+		if n == 0 {
+			// Pinned version is not affected by compaction.
+			cache.DeleteByPrefix("5")
+			cache.Set("00", -1)
+			cache.Compact()
+			checkCompacted(t, cache)
+		}
+		n++
+	}
+	if n != 100 {
+		t.Errorf("expected 100 records in pinned version, got %d", n)
+	}
+
+	if len(cache.pendingFree) != 0 || len(cache.freelist) != 0 {
+		t.Errorf("expected no free slots after unpin, got %d free and %d pending", len(cache.freelist), len(cache.pendingFree))
+	}
+	if v, _ := cache.Get("00"); v != -1 || cache.Len() != 90 {
+		t.Errorf("unexpected cache content after compaction: %v", cache.Snapshot())
+	}
+}
+
+func TestKVCacheAutoCompact(t *testing.T) {
+	cache := NewKVCache[string, int]()
+	cache.SetAutoCompact(0.5)
+	for i := 0; i < 2000; i++ {
+		cache.Set(fmt.Sprintf("%04d", i), i)
+	}
+
+	for i := 0; i < 1000; i++ {
+		_ = cache.Del(fmt.Sprintf("%04d", i))
+	}
+	if len(cache.values) != 2000 {
+		t.Fatalf("expected no compaction at 50%% free slots, got %d values", len(cache.values))
+	}
+
+	_ = cache.Del("1000")
+	checkCompacted(t, cache)
+	if cache.Len() != 999 {
+		t.Errorf("expected 999 records, got %d", cache.Len())
+	}
+
+	// Compaction is postponed until iteration is finished.
+	for i := 1001; i < 2000; i++ {
+		cache.Set(fmt.Sprintf("%04d", i+1000), i)
+	}
+	for range cache.All() {
+		cache.DeleteByPrefix("1")
+		_ = cache.Del("2001")
+		if len(cache.values) != 1998 {
+			t.Fatalf("expected no compaction while iterating, got %d values", len(cache.values))
+		}
+		break
+	}
+	checkCompacted(t, cache)
+
+	// Small caches are not compacted.
+	small := NewKVCache[string, int]()
+	small.SetAutoCompact(0.1)
+	small.Set("a", 1)
+	small.Set("b", 2)
+	_ = small.Del("a")
+	if len(small.freelist) != 1 {
+		t.Errorf("expected small cache not to be compacted")
+	}
+}
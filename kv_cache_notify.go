@@ -0,0 +1,93 @@
+package geche
+
+import "strings"
+
+// Writers collect changes for Watch subscribers and removed records
+// for OnRemove listeners while the write lock is held, and deliver them
+// after the lock is released. Nothing is collected if there are no
+// subscribers or listeners. Keys are copied, since byte slice keys
+// can be modified by the caller after the operation.
+
+// OnRemove adds a callback function that will be called when a record is
+// removed from the cache: replaced by Set, SetIfPresent or SetWithScore,
+// deleted by Del or DeleteByPrefix, or cleared.
+// The callback is called outside of the cache lock.
+// Multiple callbacks can be added, they are called in the order they were added.
+func (kv *KVCache[K, V]) OnRemove(f func(key K, value V, cause RemovalCause)) {
+	kv.mux.Lock()
+	kv.removals.listenAll(f)
+	kv.mux.Unlock()
+}
+
+// unlock releases the write lock, notifies listeners about records
+// removed while it was held and sends events to subscribers.
+func (kv *KVCache[K, V]) unlock() {
+	removed := kv.removals.take()
+	kv.mux.Unlock()
+	removed.notify()
+	kv.watch.flush()
+}
+
+// beforeSet collects the change of the key that is about to be set.
+// Should be called with the write lock held.
+func (kv *KVCache[K, V]) beforeSet(key K, value V) {
+	watched := kv.watch.active()
+	if !watched && !kv.removals.wants(RemovalReplaced) {
+		return
+	}
+
+	old, ok := kv.get(key)
+	key = cloneKey(key)
+	if watched {
+		kv.watch.add(Event[K, V]{Type: EventSet, Key: key, Old: old, HasOld: ok, New: value})
+	}
+	if ok {
+		kv.removals.add(key, old, RemovalReplaced)
+	}
+}
+
+// beforeDel collects the removal of the key that is about to be deleted, if it exists.
+// Should be called with the write lock held.
+func (kv *KVCache[K, V]) beforeDel(key K) {
+	watched := kv.watch.active()
+	if !watched && !kv.removals.wants(RemovalDeleted) {
+		return
+	}
+
+	old, ok := kv.get(key)
+	if !ok {
+		return
+	}
+
+	key = cloneKey(key)
+	if watched {
+		kv.watch.add(Event[K, V]{Type: EventDel, Key: key, Old: old, HasOld: true})
+	}
+	kv.removals.add(key, old, RemovalDeleted)
+}
+
+// beforeRemovePrefix collects removals of all keys starting with the prefix
+// that are about to be deleted or cleared. Subscribers are sent EventDel
+// for deleted keys, cleared keys are reported with a single EventClear.
+// Should be called with the write lock held.
+func (kv *KVCache[K, V]) beforeRemovePrefix(prefix K, cause RemovalCause) {
+	watched := cause == RemovalDeleted && kv.watch.active()
+	if !watched && !kv.removals.wants(cause) {
+		return
+	}
+
+	p := keyToString(prefix)
+	walkRange(kv.trie, keyRange{from: p}, func(path []byte, node *trieCacheNode[K]) bool {
+		if !strings.HasPrefix(string(path), p) {
+			return false
+		}
+
+		key := cloneKey(bytesToKey[K](path))
+		value := kv.values[node.valueIndex]
+		if watched {
+			kv.watch.add(Event[K, V]{Type: EventDel, Key: key, Old: value, HasOld: true})
+		}
+		kv.removals.add(key, value, cause)
+		return true
+	})
+}
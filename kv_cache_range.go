@@ -0,0 +1,241 @@
+package geche
+
+import "iter"
+
+// Range returns a (read-only) iterator over key-value pairs with keys
+// in [from, to) range in lexicographical order.
+// Empty to means that range has no upper bound.
+// Same as AllByPrefix, iterator works with a point-in-time version of the cache,
+// so it does not block writers, and cache can be modified inside the loop body.
+// When K is a byte slice, yielded keys are only valid until the next iteration.
+func (kv *KVCache[K, V]) Range(from, to K) iter.Seq2[K, V] {
+	return kv.RangeWith(from, to, RangeOptions{})
+}
+
+// RangeWith is like Range, but inclusiveness of the bounds and direction
+// of iteration are controlled by opts.
+// Empty to means that range has no upper bound.
+func (kv *KVCache[K, V]) RangeWith(from, to K, opts RangeOptions) iter.Seq2[K, V] {
+	return kv.rangeSeq(keyRange{
+		from:         string(from),
+		to:           string(to),
+		hasTo:        len(to) > 0,
+		RangeOptions: opts,
+	})
+}
+
+// Seek returns a (read-only) iterator over key-value pairs in lexicographical
+// order starting from the first key that is greater or equal to the key.
+// Same rules as for Range apply.
+func (kv *KVCache[K, V]) Seek(key K) iter.Seq2[K, V] {
+	return kv.rangeSeq(keyRange{from: string(key)})
+}
+
+// SeekReverse returns a (read-only) iterator over key-value pairs in reverse
+// lexicographical order starting from the last key that is less or equal to the key.
+// Same rules as for Range apply.
+func (kv *KVCache[K, V]) SeekReverse(key K) iter.Seq2[K, V] {
+	return kv.rangeSeq(keyRange{
+		to:           string(key),
+		hasTo:        true,
+		RangeOptions: RangeOptions{ToInclusive: true, Descending: true},
+	})
+}
+
+// First returns the record with the smallest key.
+// Returns false if the cache is empty.
+func (kv *KVCache[K, V]) First() (K, V, bool) {
+	return kv.first(keyRange{})
+}
+
+// Last returns the record with the greatest key.
+// Returns false if the cache is empty.
+func (kv *KVCache[K, V]) Last() (K, V, bool) {
+	return kv.first(keyRange{RangeOptions: RangeOptions{Descending: true}})
+}
+
+// Floor returns the record with the greatest key less than or equal to the key.
+// Returns false if there is no such record.
+func (kv *KVCache[K, V]) Floor(key K) (K, V, bool) {
+	return kv.first(keyRange{
+		to:           string(key),
+		hasTo:        true,
+		RangeOptions: RangeOptions{ToInclusive: true, Descending: true},
+	})
+}
+
+// Ceiling returns the record with the least key greater than or equal to the key.
+// Returns false if there is no such record.
+func (kv *KVCache[K, V]) Ceiling(key K) (K, V, bool) {
+	return kv.first(keyRange{from: string(key)})
+}
+
+func (kv *KVCache[K, V]) rangeSeq(r keyRange) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		root, values := kv.pin()
+		defer kv.unpin()
+
+		walkRange(root, r, func(path []byte, node *trieCacheNode[K]) bool {
+			return yield(bytesToKey[K](path), values[node.valueIndex])
+		})
+	}
+}
+
+// first returns the first record of the range.
+func (kv *KVCache[K, V]) first(r keyRange) (K, V, bool) {
+	kv.mux.RLock()
+	defer kv.mux.RUnlock()
+
+	var (
+		key   K
+		value V
+		found bool
+	)
+	walkRange(kv.trie, r, func(path []byte, node *trieCacheNode[K]) bool {
+		key = stringToKey[K](string(path))
+		value = kv.values[node.valueIndex]
+		found = true
+		return false
+	})
+
+	return key, value, found
+}
+
+// ListByPrefixPage returns up to limit records with keys starting with prefix
+// and greater than afterKey in lexicographical order.
+// Pass empty afterKey to get the first page and the returned next cursor
+// to get the following ones. Empty next means there are no more records.
+// Empty key, if stored, is returned on the first page in addition to limit records,
+// since it can't be used as a cursor.
+// Unlike ListByPrefix, it holds the read lock only while collecting
+// a single page. Panics if limit is not positive.
+func (kv *KVCache[K, V]) ListByPrefixPage(
+	prefix, afterKey K,
+	limit int,
+) (keys []K, values []V, next K) {
+	var noDelimiter K
+	page := kv.ListByPrefixPageDelimited(prefix, noDelimiter, afterKey, limit)
+	return page.Keys, page.Values, page.Next
+}
+
+// ListByPrefixPageDelimited is like ListByPrefixPage, but if delimiter is not empty,
+// keys that contain delimiter after the prefix are grouped into CommonPrefixes
+// (like S3 ListObjectsV2 does).
+func (kv *KVCache[K, V]) ListByPrefixPageDelimited(
+	prefix, delimiter, afterKey K,
+	limit int,
+) ListPage[K, V] {
+	kv.mux.RLock()
+	defer kv.mux.RUnlock()
+
+	return listPage[K](kv.trie, keyToString(prefix), keyToString(delimiter), keyToString(afterKey), limit,
+		func(_ []byte, node *trieCacheNode[K]) (V, bool) {
+			return kv.values[node.valueIndex], true
+		})
+}
+
+// ListChildren returns immediate children of the prefix, similar to listing
+// a directory. Records with keys that do not contain delimiter after the prefix
+// are returned as is, and keys that do are collapsed into sub-prefixes ending
+// with the delimiter, along with the number of keys under each of them.
+// Collapsed subtrees are not traversed, since subtree counts are stored in the trie nodes.
+func (kv *KVCache[K, V]) ListChildren(prefix, delimiter K) Children[K, V] {
+	kv.mux.RLock()
+	defer kv.mux.RUnlock()
+
+	var res Children[K, V]
+	walkChildren(kv.trie, keyToString(prefix), keyToString(delimiter),
+		func(key []byte, node *trieCacheNode[K]) {
+			res.Keys = append(res.Keys, stringToKey[K](string(key)))
+			res.Values = append(res.Values, kv.values[node.valueIndex])
+		},
+		func(p []byte, node *trieCacheNode[K]) {
+			res.Prefixes = append(res.Prefixes, PrefixCount[K]{
+				Prefix: stringToKey[K](string(p)),
+				Count:  node.count,
+			})
+		})
+
+	return res
+}
+
+// LongestPrefix returns the record which key is the longest prefix of s.
+// Returns false if none of the keys is a prefix of s.
+// When K is a byte slice, returned key is a subslice of s and shares memory with it.
+func (kv *KVCache[K, V]) LongestPrefix(s K) (K, V, bool) {
+	kv.mux.RLock()
+	defer kv.mux.RUnlock()
+
+	var (
+		n     int
+		value V
+		found bool
+	)
+	walkPrefixesOf(kv.trie, keyToString(s), func(i int, node *trieCacheNode[K]) bool {
+		n, value, found = i, kv.values[node.valueIndex], true
+		return true
+	})
+
+	return s[:n], value, found
+}
+
+// AllPrefixesOf returns a (read-only) iterator over records which keys
+// are prefixes of s, from the shortest key to the longest.
+// When K is a byte slice, yielded keys are subslices of s and share memory with it,
+// so they are modified if s is modified. Use bytes.Clone to keep them independent.
+// Same rules as for Range apply.
+func (kv *KVCache[K, V]) AllPrefixesOf(s K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		root, values := kv.pin()
+		defer kv.unpin()
+
+		walkPrefixesOf(root, keyToString(s), func(i int, node *trieCacheNode[K]) bool {
+			return yield(s[:i], values[node.valueIndex])
+		})
+	}
+}
+
+// Match returns a (read-only) iterator over records which keys match
+// the glob pattern, in lexicographical order of the keys.
+// Pattern supports * (any sequence of bytes), ? (any single byte),
+// character classes like [abc], [a-z] and [!a-z], and \ to escape special characters.
+// Subtrees that cannot match the pattern are not visited.
+// Returns ErrBadPattern if the pattern is malformed.
+// Same rules as for Range apply.
+func (kv *KVCache[K, V]) Match(pattern K) (iter.Seq2[K, V], error) {
+	g, err := compileGlob(keyToString(pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(yield func(K, V) bool) {
+		root, values := kv.pin()
+		defer kv.unpin()
+
+		matchTrie(root, g, func(path []byte, node *trieCacheNode[K]) bool {
+			return yield(bytesToKey[K](path), values[node.valueIndex])
+		})
+	}, nil
+}
+
+// FuzzySearch returns up to limit records with keys within Levenshtein
+// distance maxDist of the query, ordered by distance and then by key.
+// limit <= 0 means no limit.
+// Distance is computed while walking the trie, and subtrees that cannot
+// contain close enough keys are not visited.
+func (kv *KVCache[K, V]) FuzzySearch(query K, maxDist, limit int) []FuzzyMatch[K, V] {
+	var noPrefix K
+	return kv.FuzzySearchByPrefix(noPrefix, query, maxDist, limit)
+}
+
+// FuzzySearchByPrefix is like FuzzySearch, but only keys starting with
+// the prefix are considered. Distance is computed between the query and the whole key.
+func (kv *KVCache[K, V]) FuzzySearchByPrefix(prefix, query K, maxDist, limit int) []FuzzyMatch[K, V] {
+	kv.mux.RLock()
+	defer kv.mux.RUnlock()
+
+	return fuzzySearch[K](kv.trie, keyToString(prefix), keyToString(query), maxDist, limit,
+		func(node *trieCacheNode[K]) V {
+			return kv.values[node.valueIndex]
+		})
+}
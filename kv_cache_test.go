@@ -1,9 +1,11 @@
 package geche
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"testing"
@@ -1966,7 +1968,7 @@ func TestKVCacheByteKeys(t *testing.T) {
 		"000", "001", "002", "003", "004", "005", "006", "007", "008", "009",
 	}
 
-	got, err := cache.ListByPrefix("00")
+	got, err := cache.ListByPrefix([]byte("00"))
 	if err != nil {
 		t.Fatalf("unexpected error in ListByPrefix: %v", err)
 	}
@@ -1976,7 +1978,7 @@ func TestKVCacheByteKeys(t *testing.T) {
 		"120", "121", "122", "123", "124", "125", "126", "127", "128", "129",
 	}
 
-	got, err = cache.ListByPrefix("12")
+	got, err = cache.ListByPrefix([]byte("12"))
 	if err != nil {
 		t.Fatalf("unexpected error in ListByPrefix: %v", err)
 	}
@@ -1984,14 +1986,14 @@ func TestKVCacheByteKeys(t *testing.T) {
 
 	expected = []string{"888"}
 
-	got, err = cache.ListByPrefix("888")
+	got, err = cache.ListByPrefix([]byte("888"))
 	if err != nil {
 		t.Fatalf("unexpected error in ListByPrefix: %v", err)
 	}
 	compareSlice(t, expected, got)
 
-	_ = cache.Del("777")
-	_ = cache.Del("779")
+	_ = cache.Del([]byte("777"))
+	_ = cache.Del([]byte("779"))
 
 	if _, err := cache.Get([]byte("777")); err != ErrNotFound {
 		t.Fatalf("expected error %v, got %v", ErrNotFound, err)
@@ -2001,7 +2003,7 @@ func TestKVCacheByteKeys(t *testing.T) {
 		"770", "771", "772", "773", "774", "775", "776", "778",
 	}
 
-	got, err = cache.ListByPrefix("77")
+	got, err = cache.ListByPrefix([]byte("77"))
 	if err != nil {
 		t.Fatalf("unexpected error in ListByPrefix: %v", err)
 	}
@@ -2015,7 +2017,7 @@ func TestKVCacheByteKeys(t *testing.T) {
 		"770", "771", "772", "773", "774", "775", "776", "777", "778", "779",
 	}
 
-	got, err = cache.ListByPrefix("77")
+	got, err = cache.ListByPrefix([]byte("77"))
 	if err != nil {
 		t.Fatalf("unexpected error in ListByPrefix: %v", err)
 	}
@@ -2028,7 +2030,7 @@ func TestKVCacheByteKeys(t *testing.T) {
 		"77", "770", "771", "772", "773", "774", "775", "776", "777", "778", "779",
 	}
 
-	got, err = cache.ListByPrefix("77")
+	got, err = cache.ListByPrefix([]byte("77"))
 	if err != nil {
 		t.Fatalf("unexpected error in ListByPrefix: %v", err)
 	}
@@ -2074,6 +2076,119 @@ func TestKVCacheByteKeys(t *testing.T) {
 	}
 }
 
+func TestKVCacheByteKeysTyped(t *testing.T) {
+	cache := NewKVCache[[]byte, int]()
+	for i := 0; i < 1000; i++ {
+		cache.Set([]byte(fmt.Sprintf("k%03d", i)), i)
+	}
+
+	// Yielded keys are only valid until the next iteration, so they are copied.
+	var keys [][]byte
+	for k, v := range cache.AllByPrefix([]byte("k01")) {
+		if string(k) != fmt.Sprintf("k%03d", v) {
+			t.Errorf("key %q has value %d", k, v)
+		}
+		keys = append(keys, bytes.Clone(k))
+	}
+	if len(keys) != 10 || string(keys[0]) != "k010" || string(keys[9]) != "k019" {
+		t.Errorf("expected keys k010..k019, got %q", keys)
+	}
+
+	if n := cache.CountByPrefix([]byte("k01")); n != 10 {
+		t.Errorf("expected 10 keys with prefix k01, got %d", n)
+	}
+	if n := cache.DeleteByPrefix([]byte("k01")); n != 10 {
+		t.Errorf("expected 10 keys to be deleted, got %d", n)
+	}
+	if err := cache.Del([]byte("k020")); err != nil {
+		t.Errorf("unexpected error in Del: %v", err)
+	}
+	got, err := cache.ListByPrefix([]byte("k02"))
+	if err != nil {
+		t.Fatalf("unexpected error in ListByPrefix: %v", err)
+	}
+	if len(got) != 9 || got[0] != 21 {
+		t.Errorf("expected values 21..29, got %v", got)
+	}
+
+	cache.Set([]byte("k"), -1)
+	k, v, ok := cache.LongestPrefix([]byte("k0999"))
+	if !ok || string(k) != "k099" || v != 99 {
+		t.Errorf("expected k099 to be the longest prefix, got %q %d %v", k, v, ok)
+	}
+	var prefixes []string
+	for k := range cache.AllPrefixesOf([]byte("k0999")) {
+		prefixes = append(prefixes, string(k))
+	}
+	if !slices.Equal(prefixes, []string{"k", "k099"}) {
+		t.Errorf("expected prefixes [k k099], got %q", prefixes)
+	}
+}
+
+func TestKVCacheByteKeysListing(t *testing.T) {
+	cache := NewKVCache[[]byte, int]()
+	for i, k := range []string{"a/1", "a/2", "b", "c/1"} {
+		cache.SetWithScore([]byte(k), i, float64(i))
+	}
+
+	keys, _, next := cache.ListByPrefixPage(nil, nil, 2)
+	if !slices.EqualFunc(keys, []string{"a/1", "a/2"}, func(k []byte, s string) bool { return string(k) == s }) ||
+		string(next) != "a/2" {
+		t.Fatalf("unexpected first page %q, next %q", keys, next)
+	}
+
+	page := cache.ListByPrefixPageDelimited(nil, []byte("/"), next, 2)
+	if len(page.Keys) != 1 || string(page.Keys[0]) != "b" ||
+		len(page.CommonPrefixes) != 1 || string(page.CommonPrefixes[0]) != "c/" || len(page.Next) != 0 {
+		t.Fatalf("unexpected second page %+v", page)
+	}
+
+	children := cache.ListChildren(nil, []byte("/"))
+	if len(children.Keys) != 1 || string(children.Keys[0]) != "b" ||
+		len(children.Prefixes) != 2 || string(children.Prefixes[0].Prefix) != "a/" || children.Prefixes[0].Count != 2 {
+		t.Fatalf("unexpected children %+v", children)
+	}
+
+	seq, err := cache.Match([]byte("?/*"))
+	if err != nil {
+		t.Fatalf("unexpected error in Match: %v", err)
+	}
+	var matched []string
+	for k := range seq {
+		matched = append(matched, string(k))
+	}
+	if !slices.Equal(matched, []string{"a/1", "a/2", "c/1"}) {
+		t.Errorf("unexpected matched keys %q", matched)
+	}
+
+	fuzzy := cache.FuzzySearchByPrefix([]byte("a"), []byte("a/3"), 1, 0)
+	if len(fuzzy) != 2 || string(fuzzy[0].Key) != "a/1" || string(fuzzy[1].Key) != "a/2" {
+		t.Errorf("unexpected fuzzy matches %+v", fuzzy)
+	}
+
+	top := cache.TopByPrefix([]byte("a/"), 1)
+	if len(top) != 1 || string(top[0].Key) != "a/2" || top[0].Value != 1 {
+		t.Errorf("unexpected top entries %+v", top)
+	}
+}
+
+func TestKVCacheByteKeysAllocs(t *testing.T) {
+	cache := NewKVCache[[]byte, int]()
+	for i := 0; i < 1000; i++ {
+		cache.Set([]byte(fmt.Sprintf("k%03d", i)), i)
+	}
+
+	prefix := []byte("k")
+	allocs := testing.AllocsPerRun(10, func() {
+		for range cache.AllByPrefix(prefix) {
+		}
+	})
+	// Keys are not copied, so allocations do not depend on the number of keys.
+	if allocs > 10 {
+		t.Errorf("expected iteration over byte keys not to allocate per key, got %v allocs", allocs)
+	}
+}
+
 func TestKVCacheByteKeys_Monkey(t *testing.T) {
 	seeds := []int64{0, 1, 42, 123, 1994, 2026}
 	prefixes := []string{"", "a", "b", "c", "ab", "abc"}
@@ -2089,7 +2204,7 @@ func TestKVCacheByteKeys_Monkey(t *testing.T) {
 					cache.Set([]byte(cmd.key), cmd.key)
 					golden[cmd.key] = struct{}{}
 				case "Del":
-					_ = cache.Del(cmd.key)
+					_ = cache.Del([]byte(cmd.key))
 					delete(golden, cmd.key)
 				case "Clear":
 					cache.Clear()
@@ -2107,9 +2222,9 @@ func TestKVCacheByteKeys_Monkey(t *testing.T) {
 
 			var gotValues []string
 			var gotKeys []string
-			seq := cache.AllByPrefix(prefix)
-			seq(func(k, v string) bool {
-				gotKeys = append(gotKeys, k)
+			seq := cache.AllByPrefix([]byte(prefix))
+			seq(func(k []byte, v string) bool {
+				gotKeys = append(gotKeys, string(k))
 				gotValues = append(gotValues, v)
 				return true
 			})
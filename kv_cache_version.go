@@ -0,0 +1,88 @@
+package geche
+
+import "slices"
+
+// Iterators of KVCache work with point-in-time versions of the trie instead of
+// holding the read lock for the whole iteration.
+//
+// When an iterator starts, it pins the current version: current root node and
+// values slice, and the generation counter is incremented. All children slices
+// allocated before that belong to older generations and are shared with the
+// pinned version. While there are pinned versions, writers copy such slices
+// (and the root node) before modifying them (path copying), overwritten values
+// are written to new indices, and indices of deleted values are kept in
+// pendingFree instead of the freelist. When the last iterator finishes,
+// pending indices are returned to the freelist.
+// If nothing is pinned, writers modify the trie in place, so there is no
+// overhead for caches that are not iterated.
+
+// pin returns the current version of the trie and values,
+// which stays immutable until unpin is called.
+func (kv *KVCache[K, V]) pin() (*trieCacheNode[K], []V) {
+	kv.mux.Lock()
+	defer kv.mux.Unlock()
+
+	kv.pins++
+	kv.gen++
+
+	return kv.trie, kv.values
+}
+
+// unpin releases the version pinned by pin.
+func (kv *KVCache[K, V]) unpin() {
+	kv.mux.Lock()
+	defer kv.mux.Unlock()
+
+	kv.pins--
+	if kv.pins > 0 {
+		return
+	}
+
+	for _, idx := range kv.pendingFree {
+		kv.deleteValueAtIndex(idx)
+	}
+	kv.pendingFree = kv.pendingFree[:0]
+	kv.maybeCompact()
+}
+
+// ownRoot makes the root node safe to modify.
+// Caller must hold the write lock.
+func (kv *KVCache[K, V]) ownRoot() {
+	if kv.pins == 0 || kv.trie.gen == kv.gen {
+		return
+	}
+
+	root := *kv.trie
+	root.children = slices.Clone(root.children)
+	root.gen = kv.gen
+	kv.trie = &root
+}
+
+// ownChildren makes children of the node safe to modify.
+// Node itself must be safe to modify. Caller must hold the write lock.
+func (kv *KVCache[K, V]) ownChildren(n *trieCacheNode[K]) {
+	if kv.pins == 0 || n.gen == kv.gen {
+		return
+	}
+
+	n.children = slices.Clone(n.children)
+	n.gen = kv.gen
+}
+
+// replaceValue overwrites the value of the terminal node.
+// While versions are pinned, value is written to a new index,
+// so pinned versions still see the old value.
+func (kv *KVCache[K, V]) replaceValue(node *trieCacheNode[K], value V) {
+	if kv.pins == 0 {
+		kv.values[node.valueIndex] = value
+		return
+	}
+
+	old := node.valueIndex
+	node.valueIndex = kv.addValue(value)
+	if kv.scores != nil {
+		kv.growScores()
+		kv.scores[node.valueIndex] = kv.scores[old]
+	}
+	kv.pendingFree = append(kv.pendingFree, old)
+}
@@ -0,0 +1,201 @@
+package geche
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func ExampleKVCache_AllByPrefix_modify() {
+	cache := NewKVCache[string, int]()
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+
+	// Iterator works with a point-in-time version of the cache,
+	// so it is safe to modify the cache inside the loop.
+	for k, v := range cache.AllByPrefix("") {
+		cache.Set(k, v*10)
+		cache.Set(k+k, v)
+	}
+
+	fmt.Println(cache.Snapshot())
+	// Output: map[a:10 aa:1 b:20 bb:2]
+}
+
+func TestKVCacheVersionIsolation(t *testing.T) {
+	rnd := rand.New(rand.NewSource(21))
+	randKey := func() string {
+		b := make([]byte, rnd.Intn(5))
+		for j := range b {
+			b[j] = "abc"[rnd.Intn(3)]
+		}
+		return string(b)
+	}
+
+	cache := NewKVCache[string, int]()
+	model := map[string]int{}
+	seq := 0
+
+	// randomOp applies the same random operation to the cache and the model.
+	randomOp := func() {
+		seq++
+		k := randKey()
+		switch rnd.Intn(20) {
+		case 0:
+			cache.Clear()
+			clear(model)
+		case 1, 2:
+			p := k[:len(k)/2]
+			cache.DeleteByPrefix(p)
+			for key := range model {
+				if strings.HasPrefix(key, p) {
+					delete(model, key)
+				}
+			}
+		case 3, 4, 5, 6:
+			_ = cache.Del(k)
+			delete(model, k)
+		case 7:
+			cache.SetWithScore(k, seq, float64(seq%7))
+			model[k] = seq
+		default:
+			cache.Set(k, seq)
+			model[k] = seq
+		}
+	}
+
+	// check compares iteration over the pinned version with the model at the time
+	// iteration started, while randomly modifying the cache in the loop body.
+	var check func(depth int)
+	check = func(depth int) {
+		expected := maps.Clone(model)
+		got := map[string]int{}
+		prev := ""
+		first := true
+		for k, v := range cache.All() {
+			if !first && k <= prev {
+				t.Fatalf("keys are not in order: %q after %q", k, prev)
+			}
+			first = false
+			prev = k
+			got[k] = v
+
+			for n := rnd.Intn(4); n > 0; n-- {
+				randomOp()
+			}
+			if depth < 2 && rnd.Intn(10) == 0 {
+				check(depth + 1)
+			}
+		}
+
+		if !maps.Equal(expected, got) {
+			t.Fatalf("iteration observed changes made after it started:\nexpected %v\ngot %v", expected, got)
+		}
+	}
+
+	for i := 0; i < 300; i++ {
+		for n := rnd.Intn(10); n > 0; n-- {
+			randomOp()
+		}
+		check(0)
+
+		if !maps.Equal(model, cache.Snapshot()) {
+			t.Fatalf("cache state diverged from the model")
+		}
+		if cache.Len() != len(model) {
+			t.Fatalf("expected Len %d, got %d", len(model), cache.Len())
+		}
+		if cache.pins != 0 || len(cache.pendingFree) != 0 {
+			t.Fatalf("versions are not released: %d pins, %d pending", cache.pins, len(cache.pendingFree))
+		}
+		checkCounts(t, cache.trie, func(n *trieCacheNode[string]) int { return n.count })
+		checkMaxScores(t, cache, cache.trie)
+	}
+}
+
+func TestKVCacheVersionReusesValues(t *testing.T) {
+	cache := NewKVCache[string, int]()
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("%03d", i), i)
+	}
+
+	for round := 0; round < 10; round++ {
+		for k, v := range cache.All() {
+			cache.Set(k, v+1)
+		}
+	}
+
+	// Overwrites during iteration use new indices, but old ones are reused
+	// once iteration is over, so values slice does not grow indefinitely.
+	if len(cache.values) > 200 {
+		t.Errorf("expected values to be reused, got %d values for 100 keys", len(cache.values))
+	}
+	for i := 0; i < 100; i++ {
+		v, err := cache.Get(fmt.Sprintf("%03d", i))
+		if err != nil || v != i+10 {
+			t.Fatalf("expected %d, got %d (%v)", i+10, v, err)
+		}
+	}
+}
+
+func TestKVCacheVersionConcurrent(t *testing.T) {
+	const window = 50
+
+	cache := NewKVCache[[]byte, int]()
+	key := func(i int) []byte { return []byte(fmt.Sprintf("k%06d", i)) }
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Writer maintains a sliding window of consecutive keys.
+		for i := 0; i < 5000; i++ {
+			cache.Set(key(i), i)
+			if i >= window {
+				_ = cache.Del(key(i - window))
+			}
+		}
+		close(done)
+	}()
+
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				// Point-in-time version must contain a gapless window of keys.
+				first, n := -1, 0
+				for k, v := range cache.All() {
+					if string(k) != string(key(v)) {
+						t.Errorf("key %s has value %d", k, v)
+						return
+					}
+					if first == -1 {
+						first = v
+					}
+					if v != first+n {
+						t.Errorf("expected key %d, got %d", first+n, v)
+						return
+					}
+					n++
+				}
+				if n > window+1 {
+					t.Errorf("expected at most %d keys, got %d", window+1, n)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,30 @@
+package geche
+
+import (
+	"context"
+	"unsafe"
+)
+
+// Watch subscribes to changes of the cache. Events are sent to the returned
+// channel until ctx is done, then the channel is closed.
+// DeleteByPrefix sends EventDel for every deleted key.
+// When K is a byte slice, keys of the events are copies and can be retained.
+func (kv *KVCache[K, V]) Watch(ctx context.Context, filter WatchFilter[K]) <-chan Event[K, V] {
+	return kv.watch.watch(ctx, filter)
+}
+
+// WatchPrefix is like Watch, but only events of keys starting
+// with the prefix are sent (and EventClear).
+func (kv *KVCache[K, V]) WatchPrefix(ctx context.Context, prefix K, filter WatchFilter[K]) <-chan Event[K, V] {
+	return kv.watch.watch(ctx, prefixFilter(filter, prefix))
+}
+
+// cloneKey returns a copy of the key that does not share memory with it.
+// Strings are immutable and returned as is.
+func cloneKey[K byteSlice](k K) K {
+	if unsafe.Sizeof(k) == unsafe.Sizeof("") {
+		return k
+	}
+
+	return bytesToKey[K]([]byte(keyToString(k)))
+}
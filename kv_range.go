@@ -0,0 +1,235 @@
+package geche
+
+import "iter"
+
+// Range returns a (read-only) iterator over key-value pairs with keys
+// in [from, to) range in lexicographical order.
+// Empty to means that range has no upper bound.
+// Keys that are in the trie, but not found in the underlying cache
+// (e.g. expired), are skipped.
+// Iterator holds RLock on the trie for the whole iteration,
+// attempt to modify the cache while iterating will lead to a deadlock.
+func (kv *KV[V]) Range(from, to string) iter.Seq2[string, V] {
+	return kv.RangeWith(from, to, RangeOptions{})
+}
+
+// RangeWith is like Range, but inclusiveness of the bounds and direction
+// of iteration are controlled by opts.
+// Empty to means that range has no upper bound.
+func (kv *KV[V]) RangeWith(from, to string, opts RangeOptions) iter.Seq2[string, V] {
+	return kv.rangeSeq(keyRange{
+		from:         from,
+		to:           to,
+		hasTo:        len(to) > 0,
+		RangeOptions: opts,
+	})
+}
+
+// Seek returns a (read-only) iterator over key-value pairs in lexicographical
+// order starting from the first key that is greater or equal to the key.
+// Same locking rules as for Range apply.
+func (kv *KV[V]) Seek(key string) iter.Seq2[string, V] {
+	return kv.rangeSeq(keyRange{from: key})
+}
+
+// SeekReverse returns a (read-only) iterator over key-value pairs in reverse
+// lexicographical order starting from the last key that is less or equal to the key.
+// Same locking rules as for Range apply.
+func (kv *KV[V]) SeekReverse(key string) iter.Seq2[string, V] {
+	return kv.rangeSeq(keyRange{
+		to:           key,
+		hasTo:        true,
+		RangeOptions: RangeOptions{ToInclusive: true, Descending: true},
+	})
+}
+
+// First returns the record with the smallest key.
+// Returns false if the cache is empty.
+func (kv *KV[V]) First() (string, V, bool) {
+	return kv.first(keyRange{})
+}
+
+// Last returns the record with the greatest key.
+// Returns false if the cache is empty.
+func (kv *KV[V]) Last() (string, V, bool) {
+	return kv.first(keyRange{RangeOptions: RangeOptions{Descending: true}})
+}
+
+// Floor returns the record with the greatest key less than or equal to the key.
+// Returns false if there is no such record.
+func (kv *KV[V]) Floor(key string) (string, V, bool) {
+	return kv.first(keyRange{
+		to:           key,
+		hasTo:        true,
+		RangeOptions: RangeOptions{ToInclusive: true, Descending: true},
+	})
+}
+
+// Ceiling returns the record with the least key greater than or equal to the key.
+// Returns false if there is no such record.
+func (kv *KV[V]) Ceiling(key string) (string, V, bool) {
+	return kv.first(keyRange{from: key})
+}
+
+func (kv *KV[V]) rangeSeq(r keyRange) iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		kv.mux.RLock()
+		defer kv.mux.RUnlock()
+
+		walkRange(kv.trie, r, func(path []byte, _ *trieNode) bool {
+			k := string(path)
+			v, err := kv.data.Get(k)
+			if err != nil {
+				return true
+			}
+			return yield(k, v)
+		})
+	}
+}
+
+// first returns the first record of the range that exists in the underlying cache.
+func (kv *KV[V]) first(r keyRange) (string, V, bool) {
+	for k, v := range kv.rangeSeq(r) {
+		return k, v, true
+	}
+
+	return "", zero[V](), false
+}
+
+// ListByPrefixPage returns up to limit records with keys starting with prefix
+// and greater than afterKey in lexicographical order.
+// Pass empty afterKey to get the first page and the returned next cursor
+// to get the following ones. Empty next means there are no more records.
+// Empty key, if stored, is returned on the first page in addition to limit records,
+// since it can't be used as a cursor.
+// Unlike ListByPrefix, it holds the read lock only while collecting
+// a single page. Panics if limit is not positive.
+func (kv *KV[V]) ListByPrefixPage(
+	prefix, afterKey string,
+	limit int,
+) (keys []string, values []V, next string) {
+	page := kv.ListByPrefixPageDelimited(prefix, "", afterKey, limit)
+	return page.Keys, page.Values, page.Next
+}
+
+// ListByPrefixPageDelimited is like ListByPrefixPage, but if delimiter is not empty,
+// keys that contain delimiter after the prefix are grouped into CommonPrefixes
+// (like S3 ListObjectsV2 does).
+func (kv *KV[V]) ListByPrefixPageDelimited(
+	prefix, delimiter, afterKey string,
+	limit int,
+) ListPage[string, V] {
+	kv.mux.RLock()
+	defer kv.mux.RUnlock()
+
+	return listPage[string](kv.trie, prefix, delimiter, afterKey, limit,
+		func(key []byte, _ *trieNode) (V, bool) {
+			v, err := kv.data.Get(string(key))
+			return v, err == nil
+		})
+}
+
+// ListChildren returns immediate children of the prefix, similar to listing
+// a directory. Records with keys that do not contain delimiter after the prefix
+// are returned as is, and keys that do are collapsed into sub-prefixes ending
+// with the delimiter, along with the number of keys under each of them.
+// Collapsed subtrees are not traversed, since subtree counts are stored in the trie nodes.
+// Keys missing in the underlying cache (e.g. expired) are skipped,
+// but they still may be included in the sub-prefix counts.
+func (kv *KV[V]) ListChildren(prefix, delimiter string) Children[string, V] {
+	kv.mux.RLock()
+	defer kv.mux.RUnlock()
+
+	var res Children[string, V]
+	walkChildren(kv.trie, prefix, delimiter,
+		func(key []byte, _ *trieNode) {
+			k := string(key)
+			v, err := kv.data.Get(k)
+			if err != nil {
+				return
+			}
+			res.Keys = append(res.Keys, k)
+			res.Values = append(res.Values, v)
+		},
+		func(p []byte, node *trieNode) {
+			res.Prefixes = append(res.Prefixes, PrefixCount[string]{
+				Prefix: string(p),
+				Count:  node.count,
+			})
+		})
+
+	return res
+}
+
+// LongestPrefix returns the record which key is the longest prefix of s.
+// Returns false if none of the keys is a prefix of s.
+// Keys missing in the underlying cache (e.g. expired) are skipped.
+func (kv *KV[V]) LongestPrefix(s string) (string, V, bool) {
+	kv.mux.RLock()
+	defer kv.mux.RUnlock()
+
+	// Collect candidates first, so the underlying cache is only
+	// queried starting from the longest one.
+	var lens []int
+	walkPrefixesOf(kv.trie, s, func(i int, _ *trieNode) bool {
+		lens = append(lens, i)
+		return true
+	})
+
+	for i := len(lens) - 1; i >= 0; i-- {
+		k := s[:lens[i]]
+		if v, err := kv.data.Get(k); err == nil {
+			return k, v, true
+		}
+	}
+
+	return "", zero[V](), false
+}
+
+// AllPrefixesOf returns a (read-only) iterator over records which keys
+// are prefixes of s, from the shortest key to the longest.
+// Keys missing in the underlying cache (e.g. expired) are skipped.
+// Same locking rules as for Range apply.
+func (kv *KV[V]) AllPrefixesOf(s string) iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		kv.mux.RLock()
+		defer kv.mux.RUnlock()
+
+		walkPrefixesOf(kv.trie, s, func(i int, _ *trieNode) bool {
+			v, err := kv.data.Get(s[:i])
+			if err != nil {
+				return true
+			}
+			return yield(s[:i], v)
+		})
+	}
+}
+
+// Match returns a (read-only) iterator over records which keys match
+// the glob pattern, in lexicographical order of the keys.
+// Pattern supports * (any sequence of bytes), ? (any single byte),
+// character classes like [abc], [a-z] and [!a-z], and \ to escape special characters.
+// Subtrees that cannot match the pattern are not visited.
+// Keys missing in the underlying cache (e.g. expired) are skipped.
+// Returns ErrBadPattern if the pattern is malformed.
+// Same locking rules as for Range apply.
+func (kv *KV[V]) Match(pattern string) (iter.Seq2[string, V], error) {
+	g, err := compileGlob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(yield func(string, V) bool) {
+		kv.mux.RLock()
+		defer kv.mux.RUnlock()
+
+		matchTrie(kv.trie, g, func(path []byte, _ *trieNode) bool {
+			k := string(path)
+			v, err := kv.data.Get(k)
+			if err != nil {
+				return true
+			}
+			return yield(k, v)
+		})
+	}, nil
+}
@@ -2,6 +2,7 @@ package geche
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -1007,3 +1008,127 @@ func randTask(seed int64) []command {
 
 	return task
 }
+
+func TestKVRingBufferEviction(t *testing.T) {
+	kv := NewKV[string](NewRingBuffer[string, string](3))
+
+	kv.Set("user:1", "a")
+	kv.Set("user:2", "b")
+	kv.Set("user:3", "c")
+	// Evicts user:1.
+	kv.Set("item:1", "d")
+	// Overwrites user:2 slot, but user:2 is set again, so it is not evicted.
+	kv.Set("user:2", "e")
+
+	got, err := kv.ListByPrefix("user:")
+	if err != nil {
+		t.Fatalf("unexpected error in ListByPrefix: %v", err)
+	}
+	compareSlice(t, []string{"e", "c"}, got)
+
+	if n := kv.CountByPrefix("user:"); n != 2 {
+		t.Errorf("expected 2 keys with prefix %q, got %d", "user:", n)
+	}
+	if n := kv.CountByPrefix(""); n != 3 {
+		t.Errorf("expected 3 keys total, got %d", n)
+	}
+
+	// Evicts user:3 and item:1.
+	kv.Set("x", "f")
+	kv.Set("y", "g")
+
+	got, err = kv.ListByPrefix("")
+	if err != nil {
+		t.Fatalf("unexpected error in ListByPrefix: %v", err)
+	}
+	compareSlice(t, []string{"e", "f", "g"}, got)
+
+	if n := kv.CountByPrefix(""); n != 3 {
+		t.Errorf("expected 3 keys total, got %d", n)
+	}
+	if kv.find("user:3") != nil || kv.find("item:1") != nil {
+		t.Error("expected evicted keys to be removed from the trie")
+	}
+}
+
+func TestKVMapTTLEviction(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewMapTTLCache[string, string](ctx, time.Second, time.Hour)
+	kv := NewKV[string](c)
+	ts := time.Now()
+
+	kv.Set("user:1", "a")
+	kv.Set("user:2", "b")
+	kv.Set("user:3", "c")
+
+	c.mux.Lock()
+	c.now = func() time.Time { return ts.Add(2 * time.Second) }
+	c.mux.Unlock()
+
+	kv.Set("user:4", "d")
+	if err := c.cleanup(); err != nil {
+		t.Fatalf("unexpected error in cleanup: %v", err)
+	}
+
+	got, err := kv.ListByPrefix("user:")
+	if err != nil {
+		t.Fatalf("unexpected error in ListByPrefix: %v", err)
+	}
+	compareSlice(t, []string{"d"}, got)
+
+	if n := kv.CountByPrefix("user:"); n != 1 {
+		t.Errorf("expected 1 key with prefix %q, got %d", "user:", n)
+	}
+
+	// Tail node of a single key.
+	got, err = kv.ListByPrefix("user:4")
+	if err != nil {
+		t.Fatalf("unexpected error in ListByPrefix: %v", err)
+	}
+	compareSlice(t, []string{"d"}, got)
+}
+
+func TestKVEvictionWhileIterating(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewMapTTLCache[string, string](ctx, time.Second, time.Hour)
+	kv := NewKV[string](c)
+	ts := time.Now()
+
+	kv.Set("a", "1")
+	kv.Set("b", "2")
+
+	c.mux.Lock()
+	c.now = func() time.Time { return ts.Add(2 * time.Second) }
+	c.mux.Unlock()
+
+	// Eviction happens while KV read lock is held (e.g. by an iterator),
+	// so the trie is pruned on the next write.
+	kv.mux.RLock()
+	if err := c.cleanup(); err != nil {
+		t.Fatalf("unexpected error in cleanup: %v", err)
+	}
+	kv.mux.RUnlock()
+
+	if n := kv.CountByPrefix(""); n != 2 {
+		t.Errorf("expected 2 keys before next write, got %d", n)
+	}
+
+	got, err := kv.ListByPrefix("")
+	if err != nil {
+		t.Fatalf("unexpected error in ListByPrefix: %v", err)
+	}
+	compareSlice(t, []string{}, got)
+
+	c.mux.Lock()
+	c.now = time.Now
+	c.mux.Unlock()
+
+	kv.Set("c", "3")
+	if n := kv.CountByPrefix(""); n != 1 {
+		t.Errorf("expected 1 key after write, got %d", n)
+	}
+}
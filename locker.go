@@ -1,6 +1,7 @@
 package geche
 
 import (
+	"iter"
 	"sync"
 	"sync/atomic"
 )
@@ -166,3 +167,31 @@ func (tx *Tx[K, V]) ListByPrefix(prefix string) ([]V, error) {
 
 	return kv.ListByPrefix(prefix)
 }
+
+// All is an iterator over all key-value pairs in the underlying locked cache.
+// If the underlying cache does not implement Iterable, its Snapshot is iterated.
+// Will panic if iteration is started after Tx was unlocked.
+func (tx *Tx[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if atomic.LoadInt32(&tx.unlocked) == 1 {
+			panic("cannot use unlocked transaction")
+		}
+		for k, v := range all(tx.cache) {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// Keys is an iterator over all keys in the underlying locked cache.
+// Same rules as for All apply.
+func (tx *Tx[K, V]) Keys() iter.Seq[K] {
+	return keysOf(tx.All())
+}
+
+// Values is an iterator over all values in the underlying locked cache.
+// Same rules as for All apply.
+func (tx *Tx[K, V]) Values() iter.Seq[V] {
+	return valuesOf(tx.All())
+}
@@ -1,6 +1,7 @@
 package geche
 
 import (
+	"iter"
 	"sync"
 )
 
@@ -8,8 +9,9 @@ import (
 // Does not have any limits or TTL, can grow indefinitely.
 // Should be used when number of distinct keys in the cache is fixed or grows very slow.
 type MapCache[K comparable, V any] struct {
-	data map[K]V
-	mux  sync.RWMutex
+	data     map[K]V
+	mux      sync.RWMutex
+	removals removals[K, V]
 }
 
 func NewMapCache[K comparable, V any]() *MapCache[K, V] {
@@ -18,20 +20,45 @@ func NewMapCache[K comparable, V any]() *MapCache[K, V] {
 	}
 }
 
+// OnRemove adds a callback function that will be called when a record is
+// removed from the cache: replaced by Set, SetIfPresent, deleted or cleared.
+// The callback is called outside of the cache lock.
+// Multiple callbacks can be added, they are called in the order they were added.
+func (c *MapCache[K, V]) OnRemove(f func(key K, value V, cause RemovalCause)) {
+	c.mux.Lock()
+	c.removals.listenAll(f)
+	c.mux.Unlock()
+}
+
+// unlock releases the write lock and notifies listeners
+// about records removed while it was held.
+func (c *MapCache[K, V]) unlock() {
+	removed := c.removals.take()
+	c.mux.Unlock()
+	removed.notify()
+}
+
 func (c *MapCache[K, V]) Set(key K, value V) {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
+
+	if c.removals.wants(RemovalReplaced) {
+		if old, ok := c.data[key]; ok {
+			c.removals.add(key, old, RemovalReplaced)
+		}
+	}
 
 	c.data[key] = value
 }
 
 func (c *MapCache[K, V]) SetIfPresent(key K, value V) (V, bool) {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
 
 	old, ok := c.data[key]
 	if ok {
 		c.data[key] = value
+		c.removals.add(key, old, RemovalReplaced)
 		return old, true
 	}
 
@@ -67,7 +94,13 @@ func (c *MapCache[K, V]) Get(key K) (V, error) {
 // Del removes key from the cache. Return value is always nil.
 func (c *MapCache[K, V]) Del(key K) error {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
+
+	if c.removals.wants(RemovalDeleted) {
+		if old, ok := c.data[key]; ok {
+			c.removals.add(key, old, RemovalDeleted)
+		}
+	}
 
 	delete(c.data, key)
 
@@ -99,7 +132,41 @@ func (c *MapCache[K, V]) Len() int {
 // Clear removes all items from the cache.
 func (c *MapCache[K, V]) Clear() {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
+
+	if c.removals.wants(RemovalCleared) {
+		for k, v := range c.data {
+			c.removals.add(k, v, RemovalCleared)
+		}
+	}
 
 	clear(c.data)
 }
+
+// All is a (read-only) iterator over all key-value pairs in the cache.
+// Attempt to modify the cache (Set/Del, etc.) while iterating will lead to
+// a deadlock.
+func (c *MapCache[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c.mux.RLock()
+		defer c.mux.RUnlock()
+
+		for k, v := range c.data {
+			if !yield(k, v) {
+				break
+			}
+		}
+	}
+}
+
+// Keys is a (read-only) iterator over all keys in the cache.
+// Same locking rules as for All apply.
+func (c *MapCache[K, V]) Keys() iter.Seq[K] {
+	return keysOf(c.All())
+}
+
+// Values is a (read-only) iterator over all values in the cache.
+// Same locking rules as for All apply.
+func (c *MapCache[K, V]) Values() iter.Seq[V] {
+	return valuesOf(c.All())
+}
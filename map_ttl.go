@@ -2,6 +2,7 @@ package geche
 
 import (
 	"context"
+	"iter"
 	"sync"
 	"time"
 )
@@ -23,20 +24,18 @@ func zero[T any]() T {
 	return z
 }
 
-type onEvictFunc[K comparable, V any] func(key K, value V)
-
 // MapTTLCache is the thread-safe map-based cache with TTL cache invalidation support.
 // MapTTLCache uses double linked list to maintain FIFO order of inserted values.
 type MapTTLCache[K comparable, V any] struct {
-	data    map[K]ttlRec[K, V]
-	mux     sync.RWMutex
-	ttl     time.Duration
+	data map[K]ttlRec[K, V]
+	mux  sync.RWMutex
+	ttl  time.Duration
 	// TODO: replace with sync.Test
-	now     func() time.Time
-	onEvict onEvictFunc[K, V]
-	tail    K
-	head    K
-	zero    K
+	now      func() time.Time
+	removals removals[K, V]
+	tail     K
+	head     K
+	zero     K
 }
 
 // NewMapTTLCache creates MapTTLCache instance and spawns background
@@ -76,23 +75,67 @@ func NewMapTTLCache[K comparable, V any](
 
 // OnEvict sets a callback function that will be called when an entry is evicted from the cache
 // due to TTL expiration. The callback receives the key and value of the evicted entry.
+// Setting the callback replaces the previous one, nil removes it.
+// Wrappers (e.g. KV) subscribe to evictions separately and are not affected.
 // Note that the eviction callback is not called for Del operation.
-func (c *MapTTLCache[K, V]) OnEvict(f onEvictFunc[K, V]) {
+func (c *MapTTLCache[K, V]) OnEvict(f func(key K, value V)) {
+	c.mux.Lock()
+	c.removals.setEvict(f)
+	c.mux.Unlock()
+}
+
+func (c *MapTTLCache[K, V]) listenEvict(f func(key K, value V)) {
+	c.mux.Lock()
+	c.removals.listenEvict(f)
+	c.mux.Unlock()
+}
+
+// OnRemove adds a callback function that will be called when a record is
+// removed from the cache for any reason: expired, replaced by Set, deleted or cleared.
+// Records that are expired, but were not removed by the cleanup yet,
+// are reported as expired when they are replaced, deleted or cleared.
+// The callback is called outside of the cache lock.
+// Multiple callbacks can be added, they are called in the order they were added.
+func (c *MapTTLCache[K, V]) OnRemove(f func(key K, value V, cause RemovalCause)) {
 	c.mux.Lock()
-	c.onEvict = f
+	c.removals.listenAll(f)
 	c.mux.Unlock()
 }
 
+// unlock releases the write lock and notifies listeners
+// about records removed while it was held.
+func (c *MapTTLCache[K, V]) unlock() {
+	removed := c.removals.take()
+	c.mux.Unlock()
+	removed.notify()
+}
+
+// removed collects the removed record for listeners.
+// Expired records are reported to OnRemove listeners as expired,
+// but are not evictions: only cleanup evicts records.
+// Should be called with the write lock held.
+func (c *MapTTLCache[K, V]) removed(key K, rec ttlRec[K, V], cause RemovalCause) {
+	if !c.removals.active() {
+		return
+	}
+
+	reported := cause
+	if c.now().Sub(rec.timestamp) >= c.ttl {
+		reported = RemovalExpired
+	}
+	c.removals.addReported(key, rec.value, cause, reported)
+}
+
 func (c *MapTTLCache[K, V]) Set(key K, value V) {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
 	c.set(key, value)
 }
 
 // SetIfPresent sets the given key to the given value if the key was already present, and resets the TTL
 func (c *MapTTLCache[K, V]) SetIfPresent(key K, value V) (V, bool) {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
 
 	old, err := c.get(key)
 	if err == nil {
@@ -105,7 +148,7 @@ func (c *MapTTLCache[K, V]) SetIfPresent(key K, value V) (V, bool) {
 
 func (c *MapTTLCache[K, V]) SetIfAbsent(key K, value V) (V, bool) {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
 
 	old, err := c.get(key)
 	if err == nil {
@@ -126,7 +169,7 @@ func (c *MapTTLCache[K, V]) Get(key K) (V, error) {
 
 func (c *MapTTLCache[K, V]) Del(key K) error {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
 
 	rec, ok := c.data[key]
 	if !ok {
@@ -134,6 +177,7 @@ func (c *MapTTLCache[K, V]) Del(key K) error {
 	}
 
 	delete(c.data, key)
+	c.removed(key, rec, RemovalDeleted)
 
 	if key == c.head {
 		c.head = rec.next
@@ -161,19 +205,9 @@ func (c *MapTTLCache[K, V]) Del(key K) error {
 // cleanup removes outdated records
 // and calls eviction callbacks.
 func (c *MapTTLCache[K, V]) cleanup() error {
-	var (
-		evicted map[K]V
-		onEvict onEvictFunc[K, V]
-	)
-
 	c.mux.Lock()
-
-	// Preallocate a small map for evicted records
-	// if eviction callback is set.
-	if c.onEvict != nil {
-		onEvict = c.onEvict
-		evicted = make(map[K]V, 16)
-	}
+	// Eviction callbacks are called outside of the lock.
+	defer c.unlock()
 
 	key := c.head
 	for {
@@ -188,10 +222,7 @@ func (c *MapTTLCache[K, V]) cleanup() error {
 
 		c.head = rec.next
 		delete(c.data, key)
-
-		if onEvict != nil {
-			evicted[key] = rec.value
-		}
+		c.removals.add(key, rec.value, RemovalExpired)
 
 		if key == c.tail {
 			c.tail = c.zero
@@ -205,12 +236,6 @@ func (c *MapTTLCache[K, V]) cleanup() error {
 		}
 		key = rec.next
 	}
-	c.mux.Unlock()
-
-	// Call eviction callbacks outside of the lock.
-	for k, v := range evicted {
-		onEvict(k, v)
-	}
 
 	return nil
 }
@@ -240,7 +265,13 @@ func (c *MapTTLCache[K, V]) Len() int {
 // Clear removes all records from the cache.
 func (c *MapTTLCache[K, V]) Clear() {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
+
+	if c.removals.active() {
+		for k, rec := range c.data {
+			c.removed(k, rec, RemovalCleared)
+		}
+	}
 
 	clear(c.data)
 	c.head = c.zero
@@ -248,6 +279,12 @@ func (c *MapTTLCache[K, V]) Clear() {
 }
 
 func (c *MapTTLCache[K, V]) set(key K, value V) {
+	if c.removals.active() {
+		if rec, ok := c.data[key]; ok {
+			c.removed(key, rec, RemovalReplaced)
+		}
+	}
+
 	ts := c.now()
 	val := ttlRec[K, V]{
 		value:     value,
@@ -310,3 +347,93 @@ func (c *MapTTLCache[K, V]) get(key K) (V, error) {
 
 	return v.value, nil
 }
+
+// All is a (read-only) iterator over all key-value pairs in the cache
+// in the order they were set (oldest first).
+// Records that are expired (but were not removed by the cleanup yet) are skipped.
+// Expiration is checked against the time iteration has started.
+// Attempt to modify the cache (Set/Del, etc.) while iterating will lead to
+// a deadlock.
+func (c *MapTTLCache[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for k, rec := range c.allRecs() {
+			if !yield(k, rec.value) {
+				return
+			}
+		}
+	}
+}
+
+// allRecs iterates over not expired records in the order they were set.
+// Same locking rules as for All apply.
+func (c *MapTTLCache[K, V]) allRecs() iter.Seq2[K, ttlRec[K, V]] {
+	return func(yield func(K, ttlRec[K, V]) bool) {
+		c.mux.RLock()
+		defer c.mux.RUnlock()
+
+		now := c.now()
+		key := c.head
+		for {
+			rec, ok := c.data[key]
+			if !ok {
+				break
+			}
+
+			if now.Sub(rec.timestamp) < c.ttl {
+				if !yield(key, rec) {
+					break
+				}
+			}
+
+			if key == c.tail {
+				break
+			}
+			key = rec.next
+		}
+	}
+}
+
+// Keys is a (read-only) iterator over all not expired keys in the cache.
+// Same ordering and locking rules as for All apply.
+func (c *MapTTLCache[K, V]) Keys() iter.Seq[K] {
+	return keysOf(c.All())
+}
+
+// Values is a (read-only) iterator over all not expired values in the cache.
+// Same ordering and locking rules as for All apply.
+func (c *MapTTLCache[K, V]) Values() iter.Seq[V] {
+	return valuesOf(c.All())
+}
+
+// allTTL is like All, but also yields expiration time of the records.
+func (c *MapTTLCache[K, V]) allTTL() iter.Seq2[K, ttlEntry[V]] {
+	return func(yield func(K, ttlEntry[V]) bool) {
+		for k, rec := range c.allRecs() {
+			if !yield(k, ttlEntry[V]{value: rec.value, expires: rec.timestamp.Add(c.ttl)}) {
+				return
+			}
+		}
+	}
+}
+
+// setExpiring sets the record that expires at the given time,
+// but not later than TTL from now.
+// Used to restore records from the snapshot (see LoadFrom).
+func (c *MapTTLCache[K, V]) setExpiring(key K, value V, expires time.Time) {
+	c.mux.Lock()
+	defer c.unlock()
+
+	c.set(key, value)
+
+	rec := c.data[key]
+	if ts := expires.Add(-c.ttl); ts.Before(rec.timestamp) {
+		rec.timestamp = ts
+		c.data[key] = rec
+	}
+}
+
+// setAt sets the record as if it was set at the given time (but not later than now).
+// Used to replay the write-ahead log (see Durable).
+func (c *MapTTLCache[K, V]) setAt(key K, value V, ts time.Time) {
+	c.setExpiring(key, value, ts.Add(c.ttl))
+}
@@ -0,0 +1,118 @@
+package geche
+
+import (
+	"hash/maphash"
+	"math/bits"
+)
+
+// shardOf maps 64-bit hash to [0, numShards) range.
+// It uses multiply-shift (Lemire's fast range reduction) instead of modulo,
+// so it relies on the high bits of the hash and is free of division.
+func shardOf(h uint64, numShards int) int {
+	hi, _ := bits.Mul64(h, uint64(numShards))
+	return int(hi)
+}
+
+// HashMapper maps any comparable keys (including structs and arrays)
+// to N shards using seeded hash/maphash.
+// Seed is generated randomly when mapper is created, so mapping
+// is not stable across process restarts.
+type HashMapper[K comparable] struct {
+	seed maphash.Seed
+}
+
+// NewHashMapper creates HashMapper with random seed.
+func NewHashMapper[K comparable]() *HashMapper[K] {
+	return &HashMapper[K]{seed: maphash.MakeSeed()}
+}
+
+// Map key to shard number.
+func (hm *HashMapper[K]) Map(key K, numShards int) int {
+	return shardOf(maphash.Comparable(hm.seed, key), numShards)
+}
+
+// StringHashMapper maps string keys to N shards using seeded hash/maphash.
+// Unlike StringMapper it supports any number of shards and does not
+// map anagrams to the same shard.
+type StringHashMapper struct {
+	seed maphash.Seed
+}
+
+// NewStringHashMapper creates StringHashMapper with random seed.
+func NewStringHashMapper() *StringHashMapper {
+	return &StringHashMapper{seed: maphash.MakeSeed()}
+}
+
+// Map key to shard number.
+func (sm *StringHashMapper) Map(key string, numShards int) int {
+	return shardOf(maphash.String(sm.seed, key), numShards)
+}
+
+// BytesMapper maps []byte keys to N shards using seeded hash/maphash.
+type BytesMapper struct {
+	seed maphash.Seed
+}
+
+// NewBytesMapper creates BytesMapper with random seed.
+func NewBytesMapper() *BytesMapper {
+	return &BytesMapper{seed: maphash.MakeSeed()}
+}
+
+// Map key to shard number.
+func (bm *BytesMapper) Map(key []byte, numShards int) int {
+	return shardOf(maphash.Bytes(bm.seed, key), numShards)
+}
+
+// IntegerMapper maps integer keys to N shards.
+// Unlike NumberMapper it mixes the bits of the key before mapping,
+// so keys with common stride (e.g. IDs that are multiples of number of shards)
+// are still distributed uniformly.
+// Mapping is deterministic and zero value is ready to use.
+type IntegerMapper[K integer] struct{}
+
+// Map key to shard number.
+func (im *IntegerMapper[K]) Map(key K, numShards int) int {
+	return shardOf(mix64(uint64(key)), numShards)
+}
+
+// mix64 is a splitmix64 finalizer. It is a bijection that
+// spreads every input bit over all output bits.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// JumpHashMapper maps any comparable keys to N shards using seeded
+// hash/maphash and jump consistent hash (Lamping and Veach, 2014).
+// It is a consistent hashing mapper: when number of shards changes
+// from N to N+1, only ~1/(N+1) of the keys are mapped to a different shard.
+// Use it with Sharded.Resize to minimize number of migrated keys.
+type JumpHashMapper[K comparable] struct {
+	seed maphash.Seed
+}
+
+// NewJumpHashMapper creates JumpHashMapper with random seed.
+func NewJumpHashMapper[K comparable]() *JumpHashMapper[K] {
+	return &JumpHashMapper[K]{seed: maphash.MakeSeed()}
+}
+
+// Map key to shard number.
+func (jm *JumpHashMapper[K]) Map(key K, numShards int) int {
+	return jumpHash(maphash.Comparable(jm.seed, key), numShards)
+}
+
+// jumpHash returns bucket number in [0, numBuckets) range for the key hash.
+func jumpHash(key uint64, numBuckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(numBuckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+
+	return int(b)
+}
@@ -0,0 +1,199 @@
+package geche
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// chiSquare returns chi-square statistic of the shard distribution
+// against uniform distribution and the upper acceptance bound for it.
+// Bound is set to mean + 6 standard deviations of chi-square distribution
+// with numShards-1 degrees of freedom, so the test is not flaky.
+func chiSquare(counts []int, total int) (float64, float64) {
+	expected := float64(total) / float64(len(counts))
+	var stat float64
+	for _, c := range counts {
+		d := float64(c) - expected
+		stat += d * d / expected
+	}
+
+	df := float64(len(counts) - 1)
+	return stat, df + 6*math.Sqrt(2*df)
+}
+
+func testDistribution[K any](t *testing.T, m Mapper[K], keys []K, numShards int) {
+	t.Helper()
+
+	counts := make([]int, numShards)
+	for _, k := range keys {
+		s := m.Map(k, numShards)
+		if s < 0 || s >= numShards {
+			t.Fatalf("shard %d is out of range [0, %d)", s, numShards)
+		}
+		counts[s]++
+	}
+
+	stat, bound := chiSquare(counts, len(keys))
+	if stat > bound {
+		t.Errorf("distribution over %d shards is not uniform: chi-square %.1f > %.1f",
+			numShards, stat, bound)
+	}
+}
+
+type structKey struct {
+	tenant int
+	name   string
+}
+
+func TestMapperDistribution(t *testing.T) {
+	const numKeys = 100000
+
+	seqStrings := make([]string, numKeys)
+	seqBytes := make([][]byte, numKeys)
+	seqInts := make([]int, numKeys)
+	stridedInts := make([]uint64, numKeys)
+	structs := make([]structKey, numKeys)
+	for i := 0; i < numKeys; i++ {
+		seqStrings[i] = "key" + strconv.Itoa(i)
+		seqBytes[i] = []byte(seqStrings[i])
+		seqInts[i] = i
+		stridedInts[i] = uint64(i) * 1024
+		structs[i] = structKey{tenant: i % 100, name: strconv.Itoa(i / 100)}
+	}
+
+	for _, numShards := range []int{2, 7, 16, 64, 1000} {
+		t.Run(strconv.Itoa(numShards), func(t *testing.T) {
+			t.Run("StringHashMapper", func(t *testing.T) {
+				testDistribution[string](t, NewStringHashMapper(), seqStrings, numShards)
+			})
+			t.Run("BytesMapper", func(t *testing.T) {
+				testDistribution[[]byte](t, NewBytesMapper(), seqBytes, numShards)
+			})
+			t.Run("HashMapperString", func(t *testing.T) {
+				testDistribution[string](t, NewHashMapper[string](), seqStrings, numShards)
+			})
+			t.Run("HashMapperStruct", func(t *testing.T) {
+				testDistribution[structKey](t, NewHashMapper[structKey](), structs, numShards)
+			})
+			t.Run("IntegerMapperSequential", func(t *testing.T) {
+				testDistribution[int](t, &IntegerMapper[int]{}, seqInts, numShards)
+			})
+			t.Run("IntegerMapperStrided", func(t *testing.T) {
+				testDistribution[uint64](t, &IntegerMapper[uint64]{}, stridedInts, numShards)
+			})
+		})
+	}
+}
+
+func TestNumberMapperStrided(t *testing.T) {
+	// Documents the weakness of plain modulo that IntegerMapper fixes:
+	// keys with stride equal to number of shards all land in one shard.
+	m := &NumberMapper[uint64]{}
+	for i := uint64(0); i < 1000; i++ {
+		if s := m.Map(i*16, 16); s != 0 {
+			t.Fatalf("expected all keys in shard 0, got %d", s)
+		}
+	}
+}
+
+func TestStringHashMapperAnagrams(t *testing.T) {
+	// StringMapper XORs bytes, so all anagrams collide.
+	sm := &StringMapper{}
+	if sm.Map("ab", 64) != sm.Map("ba", 64) {
+		t.Fatal("expected StringMapper to map anagrams to the same shard")
+	}
+
+	// With a good hash some of the anagram pairs must land in different shards.
+	hm := NewStringHashMapper()
+	differ := 0
+	for i := 0; i < 100; i++ {
+		a := "a" + strconv.Itoa(i) + "b"
+		b := "b" + strconv.Itoa(i) + "a"
+		if hm.Map(a, 64) != hm.Map(b, 64) {
+			differ++
+		}
+	}
+
+	if differ < 50 {
+		t.Errorf("expected most anagram pairs to map to different shards, got %d of 100", differ)
+	}
+}
+
+func TestMapperStable(t *testing.T) {
+	hm := NewHashMapper[structKey]()
+	k := structKey{tenant: 42, name: "foo"}
+	s := hm.Map(k, 1024)
+	for i := 0; i < 10; i++ {
+		if hm.Map(structKey{tenant: 42, name: "foo"}, 1024) != s {
+			t.Fatal("expected the same key to be mapped to the same shard")
+		}
+	}
+}
+
+func TestShardedHashMapper(t *testing.T) {
+	c := NewSharded[structKey](
+		func() Geche[structKey, int] { return NewMapCache[structKey, int]() },
+		300,
+		NewHashMapper[structKey](),
+	)
+
+	for i := 0; i < 3000; i++ {
+		c.Set(structKey{tenant: i % 10, name: strconv.Itoa(i)}, i)
+	}
+
+	for i := 0; i < 3000; i++ {
+		v, err := c.Get(structKey{tenant: i % 10, name: strconv.Itoa(i)})
+		if err != nil {
+			t.Fatalf("unexpected error in Get: %v", err)
+		}
+		if v != i {
+			t.Fatalf("expected %d, got %d", i, v)
+		}
+	}
+
+	// With 3000 keys over 300 shards every shard should get something.
+	for i, shard := range c.layout.Load().shards {
+		if shard.Len() == 0 {
+			t.Errorf("shard %d is empty", i)
+		}
+	}
+}
+
+func BenchmarkMappers(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "somewhat/longer/key/" + strconv.Itoa(i)
+	}
+
+	b.Run("StringMapper", func(b *testing.B) {
+		m := &StringMapper{}
+		for i := 0; i < b.N; i++ {
+			_ = m.Map(keys[i%len(keys)], 16)
+		}
+	})
+	b.Run("StringHashMapper", func(b *testing.B) {
+		m := NewStringHashMapper()
+		for i := 0; i < b.N; i++ {
+			_ = m.Map(keys[i%len(keys)], 16)
+		}
+	})
+	b.Run("HashMapper", func(b *testing.B) {
+		m := NewHashMapper[string]()
+		for i := 0; i < b.N; i++ {
+			_ = m.Map(keys[i%len(keys)], 16)
+		}
+	})
+	b.Run("NumberMapper", func(b *testing.B) {
+		m := &NumberMapper[int]{}
+		for i := 0; i < b.N; i++ {
+			_ = m.Map(i, 16)
+		}
+	})
+	b.Run("IntegerMapper", func(b *testing.B) {
+		m := &IntegerMapper[int]{}
+		for i := 0; i < b.N; i++ {
+			_ = m.Map(i, 16)
+		}
+	})
+}
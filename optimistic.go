@@ -0,0 +1,305 @@
+package geche
+
+import (
+	"errors"
+	"iter"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrTxConflict is returned by WatchTx.Exec when one of the watched keys
+// was modified after Watch was called.
+var ErrTxConflict = errors.New("transaction conflict")
+
+type watchedKey struct {
+	version uint64
+	refs    int
+}
+
+// Optimistic is a wrapper for any Geche interface implementation that
+// provides Redis-style optimistic transactions (WATCH/MULTI/EXEC).
+// Instead of holding a lock while the business logic runs (see Locker),
+// client watches a set of keys, reads them freely and then atomically
+// applies queued writes only if none of the watched keys were changed
+// in the meantime.
+// Only modifications made through the Optimistic wrapper are tracked.
+// Changes made directly in the underlying cache (including TTL expiration
+// or eviction) do not cause conflicts.
+type Optimistic[K comparable, V any] struct {
+	cache Geche[K, V]
+	// Versions are tracked only for keys that are currently watched,
+	// so memory footprint does not grow with the number of keys in the cache.
+	watched map[K]*watchedKey
+	mux     sync.RWMutex
+}
+
+// NewOptimistic creates a new Optimistic instance.
+func NewOptimistic[K comparable, V any](
+	cache Geche[K, V],
+) *Optimistic[K, V] {
+	o := Optimistic[K, V]{
+		cache:   cache,
+		watched: make(map[K]*watchedKey),
+	}
+
+	return &o
+}
+
+// WatchTx is an optimistic transaction returned by Optimistic.Watch.
+// It records versions of watched keys and applies writes queued in Exec
+// only if these versions did not change.
+// WatchTx must be finished with either Exec or Discard, otherwise
+// watched keys will be tracked forever.
+type WatchTx[K comparable, V any] struct {
+	o        *Optimistic[K, V]
+	keys     []K
+	versions []uint64
+	finished int32
+}
+
+// Multi is a queue of writes passed to the WatchTx.Exec callback.
+// Queued operations are applied to the cache atomically after the
+// callback returns and only if there was no conflict.
+type Multi[K comparable, V any] struct {
+	ops []multiOp[K, V]
+}
+
+type multiOp[K comparable, V any] struct {
+	key   K
+	value V
+	del   bool
+}
+
+// Set queues key-value pair to be set on Exec.
+func (m *Multi[K, V]) Set(key K, value V) {
+	m.ops = append(m.ops, multiOp[K, V]{key: key, value: value})
+}
+
+// Del queues key to be deleted on Exec.
+func (m *Multi[K, V]) Del(key K) {
+	m.ops = append(m.ops, multiOp[K, V]{key: key, del: true})
+}
+
+// Watch starts an optimistic transaction watching the provided keys.
+func (o *Optimistic[K, V]) Watch(keys ...K) *WatchTx[K, V] {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	tx := WatchTx[K, V]{
+		o:        o,
+		keys:     keys,
+		versions: make([]uint64, len(keys)),
+	}
+
+	for i, key := range keys {
+		w, ok := o.watched[key]
+		if !ok {
+			w = &watchedKey{}
+			o.watched[key] = w
+		}
+		w.refs++
+		tx.versions[i] = w.version
+	}
+
+	return &tx
+}
+
+// Get value by key from the underlying cache.
+// Reading keys that are not watched is allowed, but their modification
+// will not cause a conflict.
+func (tx *WatchTx[K, V]) Get(key K) (V, error) {
+	if atomic.LoadInt32(&tx.finished) == 1 {
+		panic("cannot use finished transaction")
+	}
+	return tx.o.Get(key)
+}
+
+// Exec calls fn to queue writes and applies them atomically if none of the
+// watched keys were modified since Watch was called.
+// Returns ErrTxConflict (and discards queued writes) otherwise.
+// Transaction is finished after Exec and can't be used anymore.
+func (tx *WatchTx[K, V]) Exec(fn func(m *Multi[K, V])) error {
+	if !atomic.CompareAndSwapInt32(&tx.finished, 0, 1) {
+		panic("cannot use finished transaction")
+	}
+
+	o := tx.o
+	// Watched keys are released below, or here if fn panics.
+	released := false
+	defer func() {
+		if !released {
+			o.mux.Lock()
+			tx.unwatch()
+			o.mux.Unlock()
+		}
+	}()
+
+	m := Multi[K, V]{}
+	fn(&m)
+
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	conflict := false
+	for i, key := range tx.keys {
+		if o.watched[key].version != tx.versions[i] {
+			conflict = true
+			break
+		}
+	}
+	tx.unwatch()
+	released = true
+
+	if conflict {
+		return ErrTxConflict
+	}
+
+	for _, op := range m.ops {
+		if op.del {
+			_ = o.cache.Del(op.key)
+		} else {
+			o.cache.Set(op.key, op.value)
+		}
+		o.touch(op.key)
+	}
+
+	return nil
+}
+
+// Discard finishes the transaction without applying any writes.
+func (tx *WatchTx[K, V]) Discard() {
+	if !atomic.CompareAndSwapInt32(&tx.finished, 0, 1) {
+		panic("cannot use finished transaction")
+	}
+
+	tx.o.mux.Lock()
+	defer tx.o.mux.Unlock()
+
+	tx.unwatch()
+}
+
+// unwatch releases watched keys. Caller must hold the write lock.
+func (tx *WatchTx[K, V]) unwatch() {
+	for _, key := range tx.keys {
+		w := tx.o.watched[key]
+		w.refs--
+		if w.refs == 0 {
+			delete(tx.o.watched, key)
+		}
+	}
+}
+
+// touch bumps the version of the key if it is watched.
+// Caller must hold the write lock.
+func (o *Optimistic[K, V]) touch(key K) {
+	if w, ok := o.watched[key]; ok {
+		w.version++
+	}
+}
+
+// Set key-value pair in the underlying cache.
+func (o *Optimistic[K, V]) Set(key K, value V) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	o.cache.Set(key, value)
+	o.touch(key)
+}
+
+func (o *Optimistic[K, V]) SetIfPresent(key K, value V) (V, bool) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	old, ok := o.cache.SetIfPresent(key, value)
+	if ok {
+		o.touch(key)
+	}
+
+	return old, ok
+}
+
+func (o *Optimistic[K, V]) SetIfAbsent(key K, value V) (V, bool) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	old, ok := o.cache.SetIfAbsent(key, value)
+	if ok {
+		o.touch(key)
+	}
+
+	return old, ok
+}
+
+// Get value by key from the underlying cache.
+func (o *Optimistic[K, V]) Get(key K) (V, error) {
+	o.mux.RLock()
+	defer o.mux.RUnlock()
+
+	return o.cache.Get(key)
+}
+
+// Del key from the underlying cache.
+func (o *Optimistic[K, V]) Del(key K) error {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	o.touch(key)
+	return o.cache.Del(key)
+}
+
+// Snapshot returns a shallow copy of the cache data.
+func (o *Optimistic[K, V]) Snapshot() map[K]V {
+	o.mux.RLock()
+	defer o.mux.RUnlock()
+
+	return o.cache.Snapshot()
+}
+
+// Len returns total number of elements in the cache.
+func (o *Optimistic[K, V]) Len() int {
+	o.mux.RLock()
+	defer o.mux.RUnlock()
+
+	return o.cache.Len()
+}
+
+// Clear removes all elements from the cache.
+// All ongoing transactions will fail with ErrTxConflict.
+func (o *Optimistic[K, V]) Clear() {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	o.cache.Clear()
+	for _, w := range o.watched {
+		w.version++
+	}
+}
+
+// All is an iterator over all key-value pairs in the underlying cache.
+// If the underlying cache does not implement Iterable, its Snapshot is iterated.
+// Iterator holds the read lock, so attempt to modify the cache (including Exec)
+// while iterating will lead to a deadlock.
+func (o *Optimistic[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		o.mux.RLock()
+		defer o.mux.RUnlock()
+
+		for k, v := range all(o.cache) {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// Keys is an iterator over all keys in the underlying cache.
+// Same rules as for All apply.
+func (o *Optimistic[K, V]) Keys() iter.Seq[K] {
+	return keysOf(o.All())
+}
+
+// Values is an iterator over all values in the underlying cache.
+// Same rules as for All apply.
+func (o *Optimistic[K, V]) Values() iter.Seq[V] {
+	return valuesOf(o.All())
+}
@@ -0,0 +1,236 @@
+package geche
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func ExampleNewOptimistic() {
+	o := NewOptimistic[string, int](NewMapCache[string, int]())
+	o.Set("balance", 100)
+
+	tx := o.Watch("balance")
+	balance, _ := tx.Get("balance")
+
+	// Someone modifies watched key before Exec.
+	o.Set("balance", 50)
+
+	err := tx.Exec(func(m *Multi[string, int]) {
+		m.Set("balance", balance+10)
+	})
+	fmt.Println(err)
+
+	v, _ := o.Get("balance")
+	fmt.Println(v)
+
+	// Output: transaction conflict
+	// 50
+}
+
+func TestOptimisticExec(t *testing.T) {
+	o := NewOptimistic[string, string](NewMapCache[string, string]())
+	o.Set("a", "1")
+	o.Set("b", "2")
+
+	tx := o.Watch("a", "b")
+	if v, err := tx.Get("a"); err != nil || v != "1" {
+		t.Fatalf("expected value %q, got %q (err %v)", "1", v, err)
+	}
+
+	// Modifying key that is not watched does not cause conflict.
+	o.Set("c", "3")
+
+	err := tx.Exec(func(m *Multi[string, string]) {
+		m.Set("a", "10")
+		m.Del("b")
+		m.Set("d", "4")
+	})
+	if err != nil {
+		t.Fatalf("unexpected error in Exec: %v", err)
+	}
+
+	expected := map[string]string{"a": "10", "c": "3", "d": "4"}
+	got := o.Snapshot()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d keys, got %d", len(expected), len(got))
+	}
+	for k, v := range expected {
+		if got[k] != v {
+			t.Errorf("expected %q for key %q, got %q", v, k, got[k])
+		}
+	}
+
+	if len(o.watched) != 0 {
+		t.Errorf("expected no watched keys after Exec, got %d", len(o.watched))
+	}
+}
+
+func TestOptimisticConflict(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(o *Optimistic[string, string])
+	}{
+		{"Set", func(o *Optimistic[string, string]) { o.Set("a", "x") }},
+		{"Del", func(o *Optimistic[string, string]) { _ = o.Del("a") }},
+		{"SetIfPresent", func(o *Optimistic[string, string]) { o.SetIfPresent("a", "x") }},
+		{"SetIfAbsent", func(o *Optimistic[string, string]) { o.SetIfAbsent("b", "x") }},
+		{"Clear", func(o *Optimistic[string, string]) { o.Clear() }},
+		{"OtherTx", func(o *Optimistic[string, string]) {
+			tx := o.Watch("a")
+			_ = tx.Exec(func(m *Multi[string, string]) { m.Set("b", "x") })
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := NewOptimistic[string, string](NewMapCache[string, string]())
+			o.Set("a", "1")
+
+			tx := o.Watch("a", "b")
+			tc.modify(o)
+
+			err := tx.Exec(func(m *Multi[string, string]) {
+				m.Set("c", "3")
+			})
+			if !errors.Is(err, ErrTxConflict) {
+				t.Fatalf("expected error %v, got %v", ErrTxConflict, err)
+			}
+
+			if _, err := o.Get("c"); err != ErrNotFound {
+				t.Errorf("expected queued writes to be discarded, got err %v", err)
+			}
+
+			if len(o.watched) != 0 {
+				t.Errorf("expected no watched keys after Exec, got %d", len(o.watched))
+			}
+		})
+	}
+}
+
+func TestOptimisticNoopWritesDoNotConflict(t *testing.T) {
+	o := NewOptimistic[string, string](NewMapCache[string, string]())
+
+	tx := o.Watch("a")
+	// Neither of these operations modify the key.
+	o.SetIfPresent("a", "x")
+	o.Set("b", "1")
+	o.SetIfAbsent("b", "2")
+
+	if err := tx.Exec(func(m *Multi[string, string]) { m.Set("a", "1") }); err != nil {
+		t.Fatalf("unexpected error in Exec: %v", err)
+	}
+}
+
+func TestOptimisticDiscard(t *testing.T) {
+	o := NewOptimistic[string, string](NewMapCache[string, string]())
+
+	tx1 := o.Watch("a")
+	tx2 := o.Watch("a")
+	tx1.Discard()
+
+	if len(o.watched) != 1 {
+		t.Fatalf("expected key to be watched by second transaction")
+	}
+
+	o.Set("a", "1")
+	if err := tx2.Exec(func(m *Multi[string, string]) {}); !errors.Is(err, ErrTxConflict) {
+		t.Fatalf("expected error %v, got %v", ErrTxConflict, err)
+	}
+
+	if len(o.watched) != 0 {
+		t.Errorf("expected no watched keys, got %d", len(o.watched))
+	}
+}
+
+func TestOptimisticFinishedPanics(t *testing.T) {
+	o := NewOptimistic[string, string](NewMapCache[string, string]())
+
+	tx := o.Watch("a")
+	tx.Discard()
+
+	if !panics(func() { tx.Discard() }) {
+		t.Error("expected Discard on finished transaction to panic")
+	}
+	if !panics(func() { _, _ = tx.Get("a") }) {
+		t.Error("expected Get on finished transaction to panic")
+	}
+	if !panics(func() { _ = tx.Exec(func(m *Multi[string, string]) {}) }) {
+		t.Error("expected Exec on finished transaction to panic")
+	}
+}
+
+func TestOptimisticExecPanic(t *testing.T) {
+	o := NewOptimistic[string, string](NewMapCache[string, string]())
+
+	tx := o.Watch("a", "b")
+	if !panics(func() { _ = tx.Exec(func(m *Multi[string, string]) { panic("oops") }) }) {
+		t.Fatal("expected panic in fn to be propagated")
+	}
+
+	if len(o.watched) != 0 {
+		t.Errorf("expected no watched keys, got %d", len(o.watched))
+	}
+}
+
+func TestOptimisticParallel(t *testing.T) {
+	// Same balance transfer scenario as in TestLockerParallel,
+	// but transactions are retried on conflict instead of holding a lock.
+	o := NewOptimistic[int, int](NewMapCache[int, int]())
+
+	numAccounts := 10
+	numTransactions := 10000
+	initialBalance := 1000
+
+	for i := 0; i < numAccounts; i++ {
+		o.Set(i, initialBalance)
+	}
+	totalBalance := numAccounts * initialBalance
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < numTransactions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			accA := rand.Intn(numAccounts)
+			accB := (accA + 1 + rand.Intn(numAccounts-1)) % numAccounts
+			for {
+				tx := o.Watch(accA, accB)
+				balA, _ := tx.Get(accA)
+				balB, _ := tx.Get(accB)
+				if balA > 0 {
+					size := rand.Intn(balA)
+					balA -= size
+					balB += size
+				}
+
+				err := tx.Exec(func(m *Multi[int, int]) {
+					m.Set(accA, balA)
+					m.Set(accB, balB)
+				})
+				if err == nil {
+					return
+				}
+				if !errors.Is(err, ErrTxConflict) {
+					t.Errorf("unexpected error in Exec: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	sum := 0
+	for _, v := range o.Snapshot() {
+		sum += v
+	}
+
+	if sum != totalBalance {
+		t.Errorf("expected total balance to be %d, got %d", totalBalance, sum)
+	}
+
+	if len(o.watched) != 0 {
+		t.Errorf("expected no watched keys, got %d", len(o.watched))
+	}
+}
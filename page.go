@@ -0,0 +1,159 @@
+package geche
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ListPage is a single page of the prefix listing returned by
+// ListByPrefixPageDelimited functions of KV and KVCache.
+// K is the key type of the cache (string for KV).
+type ListPage[K byteSlice, V any] struct {
+	// Keys and Values of the records in lexicographical order of the keys.
+	Keys   []K
+	Values []V
+	// CommonPrefixes are distinct key prefixes up to and including the first
+	// delimiter after the listed prefix. Keys that have such prefix are not
+	// returned in Keys, and each common prefix counts as a single entry towards the limit.
+	CommonPrefixes []K
+	// Next is a cursor to pass as afterKey to get the next page.
+	// Empty Next means that there are no more pages.
+	Next K
+}
+
+// prefixEnd returns the smallest key that is greater than all keys starting with prefix.
+// Returns false if there is no such key (prefix is empty or consists of 0xFF bytes only).
+func prefixEnd(prefix string) (string, bool) {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xFF {
+			return prefix[:i] + string([]byte{prefix[i] + 1}), true
+		}
+	}
+
+	return "", false
+}
+
+// listPage collects up to limit entries with keys starting with prefix
+// and greater than afterKey in lexicographical order.
+// If delimiter is not empty, keys having delimiter after the prefix are collapsed
+// into common prefixes, and walk jumps over the whole group instead of visiting it.
+// get returns the value of the terminal node or false if the record should be skipped.
+// Empty key is returned on the first page in addition to limit entries.
+// Caller must hold the read lock.
+func listPage[K byteSlice, N trieWalkNode[N], V any](
+	root N,
+	prefix, delimiter, afterKey string,
+	limit int,
+	get func(key []byte, node N) (V, bool),
+) ListPage[K, V] {
+	if limit <= 0 {
+		panic("limit must be positive")
+	}
+
+	var page ListPage[K, V]
+
+	r := keyRange{from: prefix}
+	// Empty afterKey requests the first page, so empty key is not skipped.
+	if afterKey != "" && afterKey >= prefix {
+		r.from = afterKey
+		r.FromExclusive = true
+		if delimiter != "" && strings.HasPrefix(afterKey, prefix) {
+			// Cursor points to a common prefix (or somewhere inside it),
+			// whole group was already returned.
+			if i := strings.Index(afterKey[len(prefix):], delimiter); i >= 0 {
+				end, ok := prefixEnd(afterKey[:len(prefix)+i+len(delimiter)])
+				if !ok {
+					return page
+				}
+				r.from = end
+				r.FromExclusive = false
+			}
+		}
+	}
+	if end, ok := prefixEnd(prefix); ok {
+		r.to = end
+		r.hasTo = true
+	}
+
+	delim := []byte(delimiter)
+
+	var (
+		n     int
+		last  string
+		more  bool
+		group string
+	)
+	for {
+		walkRange(root, r, func(path []byte, node N) bool {
+			if delimiter != "" {
+				if i := bytes.Index(path[len(prefix):], delim); i >= 0 {
+					if n == limit {
+						more = true
+						return false
+					}
+					group = string(path[:len(prefix)+i+len(delimiter)])
+					page.CommonPrefixes = append(page.CommonPrefixes, cloneKey(stringToKey[K](group)))
+					n++
+					last = group
+					// Restart the walk after the group.
+					return false
+				}
+			}
+
+			v, ok := get(path, node)
+			if !ok {
+				return true
+			}
+			if n == limit {
+				more = true
+				return false
+			}
+			page.Keys = append(page.Keys, stringToKey[K](string(path)))
+			page.Values = append(page.Values, v)
+			if len(path) == 0 {
+				// Empty key can't be used as a cursor,
+				// so it does not count towards the limit.
+				return true
+			}
+			last = string(path)
+			n++
+
+			return true
+		})
+
+		if group == "" || more {
+			break
+		}
+
+		end, ok := prefixEnd(group)
+		if !ok {
+			break
+		}
+		r.from = end
+		r.FromExclusive = false
+		group = ""
+	}
+
+	if more {
+		// Last entry can be a common prefix, Next should not share memory with it.
+		page.Next = cloneKey(stringToKey[K](last))
+	}
+
+	return page
+}
+
+// Children is a hierarchical listing returned by ListChildren functions of KV and KVCache.
+// K is the key type of the cache (string for KV).
+type Children[K byteSlice, V any] struct {
+	// Keys and Values of the immediate children records in lexicographical order of the keys.
+	Keys   []K
+	Values []V
+	// Prefixes are collapsed sub-prefixes in lexicographical order.
+	Prefixes []PrefixCount[K]
+}
+
+// PrefixCount is a collapsed sub-prefix with the number of keys that start with it.
+type PrefixCount[K byteSlice] struct {
+	Prefix K
+	Count  int
+}
@@ -0,0 +1,264 @@
+package geche
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func ExampleKVCache_ListByPrefixPage() {
+	cache := NewKVCache[string, int]()
+	for i := 0; i < 5; i++ {
+		cache.Set(fmt.Sprintf("tenant/1/%d", i), i)
+	}
+
+	after := ""
+	for {
+		keys, values, next := cache.ListByPrefixPage("tenant/1/", after, 2)
+		fmt.Println(keys, values)
+		if next == "" {
+			break
+		}
+		after = next
+	}
+	// Output:
+	// [tenant/1/0 tenant/1/1] [0 1]
+	// [tenant/1/2 tenant/1/3] [2 3]
+	// [tenant/1/4] [4]
+}
+
+type pageLister interface {
+	Set(string, int)
+	ListByPrefixPageDelimited(prefix, delimiter, afterKey string, limit int) ListPage[string, int]
+}
+
+// expectedListing returns keys and common prefixes in a single sorted list.
+func expectedListing(keys []string, prefix, delimiter string) []string {
+	var res []string
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(k[len(prefix):], delimiter); i >= 0 {
+				p := k[:len(prefix)+i+len(delimiter)]
+				if len(res) == 0 || res[len(res)-1] != p {
+					res = append(res, p)
+				}
+				continue
+			}
+		}
+		res = append(res, k)
+	}
+	return res
+}
+
+func testListPages(t *testing.T, c pageLister) {
+	rnd := rand.New(rand.NewSource(7))
+	set := map[string]int{}
+	for i := 0; i < 300; i++ {
+		b := make([]byte, 1+rnd.Intn(6))
+		for j := range b {
+			b[j] = "ab/\xff"[rnd.Intn(4)]
+		}
+		set[string(b)] = i
+		c.Set(string(b), i)
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, prefix := range []string{"", "a", "a/", "b/a", "\xff", "\xff\xff", "zzz"} {
+		for _, delimiter := range []string{"", "/", "a/", "\xff"} {
+			for _, limit := range []int{1, 3, 1000} {
+				expected := expectedListing(keys, prefix, delimiter)
+
+				var got []string
+				after := ""
+				for pages := 0; ; pages++ {
+					if pages > len(keys) {
+						t.Fatalf("too many pages for prefix %q delimiter %q", prefix, delimiter)
+					}
+					page := c.ListByPrefixPageDelimited(prefix, delimiter, after, limit)
+					if len(page.Keys)+len(page.CommonPrefixes) > limit {
+						t.Fatalf("page is larger than limit %d", limit)
+					}
+					for i, k := range page.Keys {
+						if page.Values[i] != set[k] {
+							t.Fatalf("expected value %d for key %q, got %d", set[k], k, page.Values[i])
+						}
+					}
+					entries := append(slices.Clone(page.Keys), page.CommonPrefixes...)
+					slices.Sort(entries)
+					got = append(got, entries...)
+					if page.Next == "" {
+						break
+					}
+					after = page.Next
+				}
+
+				if !slices.Equal(expected, got) {
+					t.Fatalf("prefix %q delimiter %q limit %d: expected %q, got %q",
+						prefix, delimiter, limit, expected, got)
+				}
+			}
+		}
+	}
+}
+
+func TestListByPrefixPage(t *testing.T) {
+	t.Run("KV", func(t *testing.T) {
+		testListPages(t, NewKV[int](NewMapCache[string, int]()))
+	})
+	t.Run("KVCache", func(t *testing.T) {
+		testListPages(t, NewKVCache[string, int]())
+	})
+}
+
+func TestListByPrefixPageDelimited(t *testing.T) {
+	kv := NewKV[int](NewMapCache[string, int]())
+	for i, k := range []string{"a/1", "a/2", "b", "c/1/x", "c/2", "d"} {
+		kv.Set(k, i)
+	}
+
+	page := kv.ListByPrefixPageDelimited("", "/", "", 2)
+	if !slices.Equal(page.CommonPrefixes, []string{"a/"}) ||
+		!slices.Equal(page.Keys, []string{"b"}) || page.Next != "b" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+
+	page = kv.ListByPrefixPageDelimited("", "/", page.Next, 2)
+	if !slices.Equal(page.CommonPrefixes, []string{"c/"}) ||
+		!slices.Equal(page.Keys, []string{"d"}) || page.Next != "" {
+		t.Fatalf("unexpected second page %+v", page)
+	}
+
+	// Cursor pointing into a group skips the whole group.
+	page = kv.ListByPrefixPageDelimited("", "/", "a/1", 10)
+	if !slices.Equal(page.CommonPrefixes, []string{"c/"}) ||
+		!slices.Equal(page.Keys, []string{"b", "d"}) {
+		t.Fatalf("unexpected page %+v", page)
+	}
+}
+
+func TestListByPrefixPageEmptyKey(t *testing.T) {
+	for name, c := range map[string]pageLister{
+		"KV":      NewKV[int](NewMapCache[string, int]()),
+		"KVCache": NewKVCache[string, int](),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for i, k := range []string{"", "a", "b"} {
+				c.Set(k, i)
+			}
+
+			page := c.ListByPrefixPageDelimited("", "", "", 1)
+			if !slices.Equal(page.Keys, []string{"", "a"}) ||
+				!slices.Equal(page.Values, []int{0, 1}) || page.Next != "a" {
+				t.Fatalf("unexpected first page %+v", page)
+			}
+
+			page = c.ListByPrefixPageDelimited("", "", page.Next, 1)
+			if !slices.Equal(page.Keys, []string{"b"}) || page.Next != "" {
+				t.Fatalf("unexpected second page %+v", page)
+			}
+		})
+	}
+}
+
+func TestListByPrefixPagePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on non-positive limit")
+		}
+	}()
+
+	NewKVCache[string, int]().ListByPrefixPage("", "", 0)
+}
+
+func ExampleKV_ListChildren() {
+	kv := NewKV[int](NewMapCache[string, int]())
+	for i, k := range []string{"a/b/c", "a/b/d", "a/e", "a/f/g", "h"} {
+		kv.Set(k, i)
+	}
+
+	res := kv.ListChildren("a/", "/")
+	fmt.Println(res.Keys, res.Values, res.Prefixes)
+	// Output: [a/e] [2] [{a/b/ 2} {a/f/ 1}]
+}
+
+type childrenLister interface {
+	Set(string, int)
+	ListChildren(prefix, delimiter string) Children[string, int]
+}
+
+func testListChildren(t *testing.T, c childrenLister) {
+	rnd := rand.New(rand.NewSource(11))
+	set := map[string]int{}
+	for i := 0; i < 300; i++ {
+		b := make([]byte, 1+rnd.Intn(7))
+		for j := range b {
+			b[j] = "ab/"[rnd.Intn(3)]
+		}
+		set[string(b)] = i
+		c.Set(string(b), i)
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, prefix := range []string{"", "a", "a/", "b/a", "//", "zzz"} {
+		for _, delimiter := range []string{"", "/", "a/", "//"} {
+			var (
+				expectedKeys     []string
+				expectedPrefixes []PrefixCount[string]
+			)
+			for _, k := range keys {
+				if !strings.HasPrefix(k, prefix) {
+					continue
+				}
+				if i := strings.Index(k[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+					p := k[:len(prefix)+i+len(delimiter)]
+					if n := len(expectedPrefixes); n > 0 && expectedPrefixes[n-1].Prefix == p {
+						expectedPrefixes[n-1].Count++
+					} else {
+						expectedPrefixes = append(expectedPrefixes, PrefixCount[string]{Prefix: p, Count: 1})
+					}
+					continue
+				}
+				expectedKeys = append(expectedKeys, k)
+			}
+
+			res := c.ListChildren(prefix, delimiter)
+			if !slices.Equal(expectedKeys, res.Keys) {
+				t.Fatalf("prefix %q delimiter %q: expected keys %q, got %q",
+					prefix, delimiter, expectedKeys, res.Keys)
+			}
+			for i, k := range res.Keys {
+				if res.Values[i] != set[k] {
+					t.Fatalf("expected value %d for key %q, got %d", set[k], k, res.Values[i])
+				}
+			}
+			if !slices.Equal(expectedPrefixes, res.Prefixes) {
+				t.Fatalf("prefix %q delimiter %q: expected prefixes %v, got %v",
+					prefix, delimiter, expectedPrefixes, res.Prefixes)
+			}
+		}
+	}
+}
+
+func TestListChildren(t *testing.T) {
+	t.Run("KV", func(t *testing.T) {
+		testListChildren(t, NewKV[int](NewMapCache[string, int]()))
+	})
+	t.Run("KVCache", func(t *testing.T) {
+		testListChildren(t, NewKVCache[string, int]())
+	})
+}
@@ -0,0 +1,313 @@
+package geche
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"time"
+)
+
+// ErrBadSnapshot is returned by LoadFrom when the data is not a valid snapshot:
+// it has wrong format or version, is truncated, or fails checksum verification.
+var ErrBadSnapshot = errors.New("bad snapshot")
+
+// Snapshot format (all integers are little endian):
+//
+//	header:  magic "GCHE", version (1 byte), flags (1 byte)
+//	block:   payload length (uint32), number of records (uint32), payload,
+//	         CRC-32C of all previous fields of the block (uint32)
+//	record:  key length (uvarint), key, value length (uvarint), value,
+//	         expiration time in Unix nanoseconds (varint, only if flagTTL is set)
+//
+// Header is followed by any number of blocks and the final empty block
+// (zero length and zero records), which allows to detect truncated snapshots.
+const (
+	snapshotMagic   = "GCHE"
+	snapshotVersion = 1
+
+	// Block is written when its payload exceeds this size.
+	snapshotBlockSize = 64 << 10
+	// Maximum payload size accepted by LoadFrom (a single huge record can
+	// make a block larger than snapshotBlockSize). SaveTo returns an error
+	// instead of writing a larger block.
+	maxSnapshotBlockSize = 1 << 30
+
+	snapshotFlagTTL byte = 1
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ttlEntry is the value with its expiration time.
+type ttlEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// ttlIterable is implemented by caches that can iterate over records
+// along with their expiration time (MapTTLCache).
+type ttlIterable[K comparable, V any] interface {
+	allTTL() iter.Seq2[K, ttlEntry[V]]
+}
+
+// ttlSetter is implemented by caches that can set records expiring
+// at the specific time (MapTTLCache).
+type ttlSetter[K comparable, V any] interface {
+	setExpiring(key K, value V, expires time.Time)
+}
+
+// SaveTo writes all records of the cache to w in a versioned and checksummed
+// binary format, using codec to serialize keys and values.
+// Records are streamed in blocks as the cache is iterated, so the whole
+// cache is not copied to memory. Caches implementing Iterable are iterated
+// directly (see locking rules of the particular cache), so slow w delays
+// writers of the cache, others are saved from their Snapshot.
+// Records are written in iteration order, so RingBuffer keeps insertion order
+// after LoadFrom. For MapTTLCache expiration time of each record is saved too.
+// Returns an error if a single record does not fit into the maximum block
+// size accepted by LoadFrom.
+func SaveTo[K comparable, V any](w io.Writer, cache Geche[K, V], codec Codec[K, V]) error {
+	return saveTo(w, cache, codec, maxSnapshotBlockSize)
+}
+
+func saveTo[K comparable, V any](w io.Writer, cache Geche[K, V], codec Codec[K, V], maxBlockSize int) error {
+	tc, withTTL := cache.(ttlIterable[K, V])
+	var flags byte
+	if withTTL {
+		flags |= snapshotFlagTTL
+	}
+
+	s := snapshotWriter[K, V]{
+		w:            w,
+		codec:        codec,
+		header:       append([]byte(snapshotMagic), snapshotVersion, flags),
+		block:        make([]byte, 8, snapshotBlockSize+512),
+		maxBlockSize: maxBlockSize,
+	}
+
+	if withTTL {
+		for k, e := range tc.allTTL() {
+			if !s.add(k, e.value, e.expires, true) {
+				break
+			}
+		}
+	} else {
+		for k, v := range all(cache) {
+			if !s.add(k, v, time.Time{}, false) {
+				break
+			}
+		}
+	}
+
+	if s.err != nil {
+		return s.err
+	}
+
+	// Last non-empty block and the final empty block.
+	if s.n > 0 {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+
+	return s.flush()
+}
+
+type snapshotWriter[K comparable, V any] struct {
+	w     io.Writer
+	codec Codec[K, V]
+	// Snapshot header, written along with the first block,
+	// so nothing is written if the first record can not be encoded.
+	header []byte
+	// Current block with 8 bytes reserved for its header.
+	block []byte
+	// Number of records in the current block.
+	n            uint32
+	maxBlockSize int
+	scratch      []byte
+	err          error
+}
+
+// add appends the record to the current block and writes the block
+// if it is full. Returns false on error.
+func (s *snapshotWriter[K, V]) add(key K, value V, expires time.Time, withTTL bool) bool {
+	s.scratch, s.err = s.codec.AppendKey(s.scratch[:0], key)
+	if s.err != nil {
+		return false
+	}
+	s.block = binary.AppendUvarint(s.block, uint64(len(s.scratch)))
+	s.block = append(s.block, s.scratch...)
+
+	s.scratch, s.err = s.codec.AppendValue(s.scratch[:0], value)
+	if s.err != nil {
+		return false
+	}
+	s.block = binary.AppendUvarint(s.block, uint64(len(s.scratch)))
+	s.block = append(s.block, s.scratch...)
+
+	if withTTL {
+		s.block = binary.AppendVarint(s.block, expires.UnixNano())
+	}
+
+	s.n++
+	size := len(s.block) - 8
+	if size > s.maxBlockSize {
+		s.err = fmt.Errorf("record is too large for the snapshot block (%d bytes)", size)
+		return false
+	}
+	if size >= snapshotBlockSize {
+		s.err = s.flush()
+	}
+
+	return s.err == nil
+}
+
+// flush writes the current block and starts a new one.
+func (s *snapshotWriter[K, V]) flush() error {
+	if s.header != nil {
+		if _, err := s.w.Write(s.header); err != nil {
+			return err
+		}
+		s.header = nil
+	}
+
+	binary.LittleEndian.PutUint32(s.block[0:], uint32(len(s.block)-8))
+	binary.LittleEndian.PutUint32(s.block[4:], s.n)
+	s.block = binary.LittleEndian.AppendUint32(s.block, crc32.Checksum(s.block, crcTable))
+
+	_, err := s.w.Write(s.block)
+	s.block = s.block[:8]
+	s.n = 0
+
+	return err
+}
+
+// LoadFrom reads records written by SaveTo from r and sets them to the cache,
+// using codec to deserialize keys and values.
+// Blocks are read and verified one by one, so the whole snapshot is not
+// loaded to memory. If an error occurs, records of the blocks read before
+// are already set to the cache.
+// Records are set in the order they were saved. If the snapshot was saved from
+// MapTTLCache, records that have expired since are skipped, and if the cache
+// is MapTTLCache, the rest keep their expiration time (but do not live longer
+// than the cache TTL). Otherwise, records are set with Set. To keep the
+// expiration order intact, MapTTLCache should be empty before loading.
+// Returns ErrBadSnapshot if data is malformed or corrupted.
+func LoadFrom[K comparable, V any](r io.Reader, cache Geche[K, V], codec Codec[K, V]) error {
+	header := make([]byte, len(snapshotMagic)+2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return badSnapshot(err)
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return fmt.Errorf("%w: wrong magic", ErrBadSnapshot)
+	}
+	if v := header[len(snapshotMagic)]; v != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrBadSnapshot, v)
+	}
+	withTTL := header[len(snapshotMagic)+1]&snapshotFlagTTL != 0
+	setter, canSetTTL := cache.(ttlSetter[K, V])
+
+	var block []byte
+	for {
+		var bh [8]byte
+		if _, err := io.ReadFull(r, bh[:]); err != nil {
+			return badSnapshot(err)
+		}
+
+		size := binary.LittleEndian.Uint32(bh[0:])
+		n := binary.LittleEndian.Uint32(bh[4:])
+		if size > maxSnapshotBlockSize {
+			return fmt.Errorf("%w: block is too large", ErrBadSnapshot)
+		}
+
+		block = append(block[:0], bh[:]...)
+		block = append(block, make([]byte, size+4)...)
+		if _, err := io.ReadFull(r, block[8:]); err != nil {
+			return badSnapshot(err)
+		}
+
+		payload := block[8 : 8+size]
+		sum := binary.LittleEndian.Uint32(block[8+size:])
+		if crc32.Checksum(block[:8+size], crcTable) != sum {
+			return fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+		}
+
+		if size == 0 && n == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		for i := uint32(0); i < n; i++ {
+			var (
+				kb, vb  []byte
+				expires int64
+				ok      bool
+			)
+			if kb, payload, ok = readChunk(payload); !ok {
+				return fmt.Errorf("%w: malformed record", ErrBadSnapshot)
+			}
+			if vb, payload, ok = readChunk(payload); !ok {
+				return fmt.Errorf("%w: malformed record", ErrBadSnapshot)
+			}
+			if withTTL {
+				var l int
+				expires, l = binary.Varint(payload)
+				if l <= 0 {
+					return fmt.Errorf("%w: malformed record", ErrBadSnapshot)
+				}
+				payload = payload[l:]
+			}
+
+			key, err := codec.DecodeKey(kb)
+			if err != nil {
+				return err
+			}
+			value, err := codec.DecodeValue(vb)
+			if err != nil {
+				return err
+			}
+
+			if !withTTL {
+				cache.Set(key, value)
+				continue
+			}
+
+			exp := time.Unix(0, expires)
+			if !exp.After(now) {
+				continue
+			}
+			if canSetTTL {
+				setter.setExpiring(key, value, exp)
+			} else {
+				cache.Set(key, value)
+			}
+		}
+
+		if len(payload) > 0 {
+			return fmt.Errorf("%w: malformed block", ErrBadSnapshot)
+		}
+	}
+}
+
+// readChunk reads length-prefixed chunk from the data
+// and returns it along with the rest of the data.
+func readChunk(data []byte) ([]byte, []byte, bool) {
+	size, l := binary.Uvarint(data)
+	if l <= 0 || size > uint64(len(data)-l) {
+		return nil, nil, false
+	}
+
+	data = data[l:]
+	return data[:size], data[size:], true
+}
+
+// badSnapshot converts unexpected end of data to ErrBadSnapshot.
+func badSnapshot(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: unexpected end of data", ErrBadSnapshot)
+	}
+
+	return err
+}
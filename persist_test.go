@@ -0,0 +1,372 @@
+package geche
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleSaveTo() {
+	cache := NewMapCache[string, int]()
+	cache.Set("one", 1)
+	cache.Set("two", 2)
+
+	var buf bytes.Buffer
+	if err := SaveTo(&buf, cache, NewBinaryCodec[string, int]()); err != nil {
+		panic(err)
+	}
+
+	restored := NewMapCache[string, int]()
+	if err := LoadFrom(&buf, restored, NewBinaryCodec[string, int]()); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(restored.Snapshot())
+	// Output: map[one:1 two:2]
+}
+
+type testPoint struct {
+	X, Y int32
+	Name string
+}
+
+func TestSaveLoadCodecs(t *testing.T) {
+	for name, codec := range map[string]Codec[string, testPoint]{
+		"gob":  NewGobCodec[string, testPoint](),
+		"json": NewJSONCodec[string, testPoint](),
+	} {
+		t.Run(name, func(t *testing.T) {
+			cache := NewMapCache[string, testPoint]()
+			for i := 0; i < 100; i++ {
+				cache.Set(strconv.Itoa(i), testPoint{X: int32(i), Y: -int32(i), Name: "p" + strconv.Itoa(i)})
+			}
+
+			var buf bytes.Buffer
+			if err := SaveTo(&buf, cache, codec); err != nil {
+				t.Fatalf("unexpected error in SaveTo: %v", err)
+			}
+
+			restored := NewMapCache[string, testPoint]()
+			if err := LoadFrom(&buf, restored, codec); err != nil {
+				t.Fatalf("unexpected error in LoadFrom: %v", err)
+			}
+			if !maps.Equal(cache.Snapshot(), restored.Snapshot()) {
+				t.Error("restored cache differs from the original")
+			}
+		})
+	}
+}
+
+func TestBinaryCodec(t *testing.T) {
+	type rec struct {
+		A int64
+		B [3]uint16
+		C bool
+	}
+
+	codec := NewBinaryCodec[[]byte, rec]()
+	b, err := codec.AppendKey([]byte("prefix"), []byte("key"))
+	if err != nil || string(b) != "prefixkey" {
+		t.Fatalf("unexpected result of AppendKey: %q, %v", b, err)
+	}
+
+	v := rec{A: -42, B: [3]uint16{1, 2, 3}, C: true}
+	b, err = codec.AppendValue(nil, v)
+	if err != nil {
+		t.Fatalf("unexpected error in AppendValue: %v", err)
+	}
+	if len(b) != 15 {
+		t.Errorf("expected 15 bytes, got %d", len(b))
+	}
+	got, err := codec.DecodeValue(b)
+	if err != nil || got != v {
+		t.Errorf("expected %v, got %v, %v", v, got, err)
+	}
+
+	if !panics(func() { NewBinaryCodec[string, map[string]int]() }) {
+		t.Error("expected NewBinaryCodec to panic for map values")
+	}
+	if !panics(func() { NewBinaryCodec[*int64, string]() }) {
+		t.Error("expected NewBinaryCodec to panic for pointer keys")
+	}
+
+	n, err := NewBinaryCodec[int, uint]().DecodeKey(binary.LittleEndian.AppendUint64(nil, uint64(1<<40)))
+	if err != nil || n != 1<<40 {
+		t.Errorf("expected %d, got %d, %v", 1<<40, n, err)
+	}
+
+	if _, err := codec.DecodeValue(append(b, 0)); err == nil {
+		t.Error("expected error when decoding value with trailing bytes")
+	}
+	if _, err := NewBinaryCodec[int, uint]().DecodeValue(make([]byte, 9)); err == nil {
+		t.Error("expected error when decoding uint with trailing bytes")
+	}
+}
+
+func TestBinaryCodecNamedTypes(t *testing.T) {
+	type (
+		id    string
+		blob  []byte
+		count int
+	)
+
+	codec := NewBinaryCodec[id, blob]()
+	b, err := codec.AppendKey(nil, "user:1")
+	if err != nil || string(b) != "user:1" {
+		t.Fatalf("unexpected result of AppendKey: %q, %v", b, err)
+	}
+	k, err := codec.DecodeKey(b)
+	if err != nil || k != "user:1" {
+		t.Errorf("expected key user:1, got %q, %v", k, err)
+	}
+
+	b, err = codec.AppendValue(nil, blob("data"))
+	if err != nil {
+		t.Fatalf("unexpected error in AppendValue: %v", err)
+	}
+	v, err := codec.DecodeValue(b)
+	if err != nil || string(v) != "data" {
+		t.Errorf("expected value data, got %q, %v", v, err)
+	}
+
+	c := NewBinaryCodec[count, count]()
+	b, _ = c.AppendValue(nil, -7)
+	if n, err := c.DecodeValue(b); err != nil || n != -7 {
+		t.Errorf("expected -7, got %d, %v", n, err)
+	}
+}
+
+func TestSaveLoadRingBufferOrder(t *testing.T) {
+	cache := NewRingBuffer[int, string](5)
+	for i := 0; i < 8; i++ {
+		cache.Set(i, strconv.Itoa(i))
+	}
+	// Key 4 is updated, so it goes last.
+	cache.Set(4, "four")
+
+	var buf bytes.Buffer
+	if err := SaveTo(&buf, cache, NewGobCodec[int, string]()); err != nil {
+		t.Fatalf("unexpected error in SaveTo: %v", err)
+	}
+
+	restored := NewRingBuffer[int, string](5)
+	if err := LoadFrom(&buf, restored, NewGobCodec[int, string]()); err != nil {
+		t.Fatalf("unexpected error in LoadFrom: %v", err)
+	}
+
+	expected := slices.Collect(cache.Keys())
+	if got := slices.Collect(restored.Keys()); !slices.Equal(expected, got) {
+		t.Errorf("expected keys %v, got %v", expected, got)
+	}
+	if v, _ := restored.Get(4); v != "four" {
+		t.Errorf("expected updated value, got %q", v)
+	}
+}
+
+func TestSaveLoadTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := time.Now()
+	cache := NewMapTTLCache[string, int](ctx, 10*time.Second, time.Hour)
+	cache.now = func() time.Time { return ts.Add(-8 * time.Second) }
+	cache.Set("old", 1)
+	cache.now = func() time.Time { return ts.Add(-11 * time.Second) }
+	cache.Set("expired", 0)
+	cache.now = func() time.Time { return ts.Add(-2 * time.Second) }
+	cache.Set("new", 2)
+	cache.now = func() time.Time { return ts }
+
+	var buf bytes.Buffer
+	if err := SaveTo(&buf, cache, NewBinaryCodec[string, int]()); err != nil {
+		t.Fatalf("unexpected error in SaveTo: %v", err)
+	}
+	data := buf.Bytes()
+
+	restored := NewMapTTLCache[string, int](ctx, 10*time.Second, time.Hour)
+	if err := LoadFrom(bytes.NewReader(data), restored, NewBinaryCodec[string, int]()); err != nil {
+		t.Fatalf("unexpected error in LoadFrom: %v", err)
+	}
+
+	if restored.Len() != 2 {
+		t.Fatalf("expected 2 records, got %v", restored.Snapshot())
+	}
+	if keys := slices.Collect(restored.Keys()); !slices.Equal(keys, []string{"old", "new"}) {
+		t.Errorf("expected keys in expiration order, got %v", keys)
+	}
+
+	restored.now = func() time.Time { return ts.Add(3 * time.Second) }
+	if _, err := restored.Get("old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected old record to expire, got %v", err)
+	}
+	if _, err := restored.Get("new"); err != nil {
+		t.Errorf("expected new record to be alive, got %v", err)
+	}
+
+	// Records do not live longer than TTL of the target cache.
+	short := NewMapTTLCache[string, int](ctx, time.Second, time.Hour)
+	if err := LoadFrom(bytes.NewReader(data), short, NewBinaryCodec[string, int]()); err != nil {
+		t.Fatalf("unexpected error in LoadFrom: %v", err)
+	}
+	short.now = func() time.Time { return time.Now().Add(time.Second) }
+	if short.Len() != 2 || len(slices.Collect(short.Keys())) != 0 {
+		t.Errorf("expected all records to expire after cache TTL")
+	}
+
+	// Non-TTL cache gets records that are not expired yet.
+	plain := NewMapCache[string, int]()
+	if err := LoadFrom(bytes.NewReader(data), plain, NewBinaryCodec[string, int]()); err != nil {
+		t.Fatalf("unexpected error in LoadFrom: %v", err)
+	}
+	if !maps.Equal(plain.Snapshot(), map[string]int{"old": 1, "new": 2}) {
+		t.Errorf("unexpected records %v", plain.Snapshot())
+	}
+}
+
+func TestSaveLoadBlocks(t *testing.T) {
+	cache := NewKVCache[string, string]()
+	value := string(bytes.Repeat([]byte("x"), 1000))
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("%04d", i), value)
+	}
+	// Record larger than the block size.
+	cache.Set("huge", string(bytes.Repeat([]byte("y"), 3*snapshotBlockSize)))
+
+	var buf bytes.Buffer
+	if err := SaveTo(&buf, cache, NewBinaryCodec[string, string]()); err != nil {
+		t.Fatalf("unexpected error in SaveTo: %v", err)
+	}
+
+	restored := NewKVCache[string, string]()
+	if err := LoadFrom(&buf, restored, NewBinaryCodec[string, string]()); err != nil {
+		t.Fatalf("unexpected error in LoadFrom: %v", err)
+	}
+	if !maps.Equal(cache.Snapshot(), restored.Snapshot()) {
+		t.Error("restored cache differs from the original")
+	}
+}
+
+func TestLoadBadSnapshot(t *testing.T) {
+	cache := NewMapCache[string, int]()
+	for i := 0; i < 10; i++ {
+		cache.Set(strconv.Itoa(i), i)
+	}
+
+	var buf bytes.Buffer
+	if err := SaveTo(&buf, cache, NewBinaryCodec[string, int]()); err != nil {
+		t.Fatalf("unexpected error in SaveTo: %v", err)
+	}
+	data := buf.Bytes()
+
+	corrupt := func(f func(b []byte) []byte) []byte {
+		return f(bytes.Clone(data))
+	}
+
+	for name, b := range map[string][]byte{
+		"empty":     nil,
+		"magic":     corrupt(func(b []byte) []byte { b[0] = 'X'; return b }),
+		"version":   corrupt(func(b []byte) []byte { b[4] = 99; return b }),
+		"checksum":  corrupt(func(b []byte) []byte { b[20] ^= 1; return b }),
+		"truncated": data[:len(data)-1],
+		"no end":    data[:len(data)-12],
+		"length":    corrupt(func(b []byte) []byte { b[6] = 0xff; b[7] = 0xff; b[8] = 0xff; b[9] = 0x7f; return b }),
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := LoadFrom(bytes.NewReader(b), NewMapCache[string, int](), NewBinaryCodec[string, int]())
+			if !errors.Is(err, ErrBadSnapshot) {
+				t.Errorf("expected ErrBadSnapshot, got %v", err)
+			}
+		})
+	}
+}
+
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("write failed")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestSaveToRecordTooLarge(t *testing.T) {
+	cache := NewMapCache[string, string]()
+	cache.Set("a", strings.Repeat("x", 100))
+
+	var buf bytes.Buffer
+	if err := saveTo(&buf, cache, NewBinaryCodec[string, string](), 64); err == nil {
+		t.Error("expected error for record larger than the block size limit")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be written, got %d bytes", buf.Len())
+	}
+}
+
+// iterationCache calls done when iteration over the cache is finished.
+type iterationCache[K comparable, V any] struct {
+	*MapCache[K, V]
+	done func()
+}
+
+func (c iterationCache[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		defer c.done()
+		for k, v := range c.MapCache.All() {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+func TestSaveToStreamsBlocks(t *testing.T) {
+	cache := iterationCache[int, int]{MapCache: NewMapCache[int, int]()}
+	for i := 0; i < snapshotBlockSize; i++ {
+		cache.Set(i, i)
+	}
+
+	w := &countingWriter{}
+	var written int
+	cache.done = func() { written = w.n }
+	if err := SaveTo(w, cache, NewBinaryCodec[int, int]()); err != nil {
+		t.Fatalf("unexpected error in SaveTo: %v", err)
+	}
+
+	// Full blocks are written while the cache is iterated.
+	if written < 2 {
+		t.Errorf("expected blocks to be written during iteration, got %d writes", written)
+	}
+}
+
+// countingWriter counts writes.
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n++
+	return len(p), nil
+}
+
+func TestSaveToWriteError(t *testing.T) {
+	cache := NewMapCache[string, int]()
+	cache.Set("a", 1)
+
+	for n := 0; n < 3; n++ {
+		if err := SaveTo(&failingWriter{n: n}, cache, NewBinaryCodec[string, int]()); err == nil {
+			t.Errorf("expected error when write %d fails", n)
+		}
+	}
+}
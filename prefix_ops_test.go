@@ -0,0 +1,258 @@
+package geche
+
+import (
+	"fmt"
+	"iter"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func ExampleKVCache_DeleteByPrefix() {
+	cache := NewKVCache[string, int]()
+	for i := 0; i < 3; i++ {
+		cache.Set(fmt.Sprintf("tenant:42:%d", i), i)
+		cache.Set(fmt.Sprintf("tenant:43:%d", i), i)
+	}
+
+	fmt.Println(cache.CountByPrefix("tenant:"))
+	fmt.Println(cache.DeleteByPrefix("tenant:42:"))
+	fmt.Println(cache.CountByPrefix("tenant:"))
+	// Output:
+	// 6
+	// 3
+	// 3
+}
+
+// checkCounts verifies that subtree count of every node in the trie
+// is equal to the number of terminal nodes in it, and returns the root count.
+func checkCounts[N trieWalkNode[N]](t *testing.T, node N, count func(N) int) int {
+	t.Helper()
+
+	n := 0
+	if node.isTerminal() {
+		n++
+	}
+	for _, child := range node.appendChildren(nil) {
+		n += checkCounts(t, child, count)
+	}
+
+	if count(node) != n {
+		t.Fatalf("node %q has count %d, but %d terminal nodes in subtree", node.segment(), count(node), n)
+	}
+
+	return n
+}
+
+type prefixOps interface {
+	Set(string, int)
+	Del(string) error
+	Get(string) (int, error)
+	Len() int
+	DeleteByPrefix(string) int
+	CountByPrefix(string) int
+}
+
+func testPrefixOps(t *testing.T, c prefixOps, check func()) {
+	rnd := rand.New(rand.NewSource(3))
+	set := map[string]bool{}
+	randKey := func() string {
+		b := make([]byte, rnd.Intn(6))
+		for j := range b {
+			b[j] = "abc"[rnd.Intn(3)]
+		}
+		return string(b)
+	}
+
+	for i := 0; i < 3000; i++ {
+		k := randKey()
+		switch rnd.Intn(10) {
+		case 0, 1, 2:
+			_ = c.Del(k)
+			delete(set, k)
+		case 3:
+			p := k[:len(k)/2]
+			expected := 0
+			for key := range set {
+				if strings.HasPrefix(key, p) {
+					delete(set, key)
+					expected++
+				}
+			}
+			if n := c.DeleteByPrefix(p); n != expected {
+				t.Fatalf("DeleteByPrefix(%q): expected %d, got %d", p, expected, n)
+			}
+		default:
+			c.Set(k, i)
+			set[k] = true
+		}
+
+		check()
+
+		p := randKey()
+		expected := 0
+		for key := range set {
+			if strings.HasPrefix(key, p) {
+				expected++
+			}
+		}
+		if n := c.CountByPrefix(p); n != expected {
+			t.Fatalf("CountByPrefix(%q): expected %d, got %d", p, expected, n)
+		}
+	}
+
+	if c.Len() != len(set) {
+		t.Fatalf("expected %d keys, got %d", len(set), c.Len())
+	}
+	for k := range set {
+		if _, err := c.Get(k); err != nil {
+			t.Fatalf("expected key %q to be present: %v", k, err)
+		}
+	}
+}
+
+func TestPrefixOps(t *testing.T) {
+	t.Run("KV", func(t *testing.T) {
+		kv := NewKV[int](NewMapCache[string, int]())
+		testPrefixOps(t, kv, func() {
+			n := checkCounts(t, kv.trie, func(n *trieNode) int { return n.count })
+			if n != kv.Len() {
+				t.Fatalf("trie has %d keys, underlying cache has %d", n, kv.Len())
+			}
+		})
+	})
+	t.Run("KVCache", func(t *testing.T) {
+		kv := NewKVCache[string, int]()
+		testPrefixOps(t, kv, func() {
+			n := checkCounts(t, kv.trie, func(n *trieCacheNode[string]) int { return n.count })
+			if n != kv.Len() {
+				t.Fatalf("trie has %d keys, Len is %d", n, kv.Len())
+			}
+		})
+	})
+}
+
+func TestDeleteByPrefixFreelist(t *testing.T) {
+	kv := NewKVCache[[]byte, int]()
+	for i := 0; i < 100; i++ {
+		kv.Set([]byte(fmt.Sprintf("a%03d", i)), i)
+	}
+	kv.Set([]byte("b"), 100)
+
+	if n := kv.DeleteByPrefix([]byte("a")); n != 100 {
+		t.Fatalf("expected 100 keys to be deleted, got %d", n)
+	}
+	if len(kv.freelist) != 100 {
+		t.Errorf("expected 100 indices in the freelist, got %d", len(kv.freelist))
+	}
+
+	// Freed values are reused.
+	for i := 0; i < 100; i++ {
+		kv.Set([]byte(fmt.Sprintf("c%03d", i)), i)
+	}
+	if len(kv.values) != 101 {
+		t.Errorf("expected values slice to be reused, got len %d", len(kv.values))
+	}
+	if kv.CountByPrefix(nil) != 101 {
+		t.Errorf("expected 101 keys, got %d", kv.CountByPrefix(nil))
+	}
+}
+
+func ExampleKV_LongestPrefix() {
+	routes := NewKV[string](NewMapCache[string, string]())
+	routes.Set("/", "root")
+	routes.Set("/api/", "api")
+	routes.Set("/api/v2/", "api v2")
+
+	k, v, _ := routes.LongestPrefix("/api/v2/users/42")
+	fmt.Println(k, v)
+
+	k, v, _ = routes.LongestPrefix("/api/v1/users")
+	fmt.Println(k, v)
+	// Output:
+	// /api/v2/ api v2
+	// /api/ api
+}
+
+type prefixMatcher interface {
+	Set(string, int)
+	LongestPrefix(s string) (string, int, bool)
+	AllPrefixesOf(s string) iter.Seq2[string, int]
+}
+
+func testPrefixesOf(t *testing.T, c prefixMatcher) {
+	rnd := rand.New(rand.NewSource(5))
+	randKey := func(maxLen int) string {
+		b := make([]byte, rnd.Intn(maxLen))
+		for j := range b {
+			b[j] = "ab."[rnd.Intn(3)]
+		}
+		return string(b)
+	}
+
+	set := map[string]int{}
+	for i := 0; i < 200; i++ {
+		k := randKey(7)
+		set[k] = i
+		c.Set(k, i)
+	}
+
+	for i := 0; i < 500; i++ {
+		s := randKey(10)
+
+		var expected []string
+		for j := 0; j <= len(s); j++ {
+			if _, ok := set[s[:j]]; ok {
+				expected = append(expected, s[:j])
+			}
+		}
+
+		var got []string
+		for k, v := range c.AllPrefixesOf(s) {
+			if v != set[k] {
+				t.Fatalf("expected value %d for key %q, got %d", set[k], k, v)
+			}
+			got = append(got, k)
+		}
+		if !slices.Equal(expected, got) {
+			t.Fatalf("AllPrefixesOf(%q): expected %q, got %q", s, expected, got)
+		}
+
+		k, v, ok := c.LongestPrefix(s)
+		if len(expected) == 0 {
+			if ok {
+				t.Fatalf("LongestPrefix(%q): expected nothing, got %q", s, k)
+			}
+			continue
+		}
+		longest := expected[len(expected)-1]
+		if !ok || k != longest || v != set[longest] {
+			t.Fatalf("LongestPrefix(%q): expected %q, got %q", s, longest, k)
+		}
+	}
+}
+
+func TestPrefixesOf(t *testing.T) {
+	t.Run("KV", func(t *testing.T) {
+		testPrefixesOf(t, NewKV[int](NewMapCache[string, int]()))
+	})
+	t.Run("KVCache", func(t *testing.T) {
+		testPrefixesOf(t, NewKVCache[string, int]())
+	})
+}
+
+func TestKVLongestPrefixSkipsMissing(t *testing.T) {
+	data := NewMapCache[string, int]()
+	kv := NewKV[int](data)
+	kv.Set("a", 1)
+	kv.Set("ab", 2)
+
+	// Remove the longest match from the underlying cache only.
+	_ = data.Del("ab")
+
+	k, v, ok := kv.LongestPrefix("abc")
+	if !ok || k != "a" || v != 1 {
+		t.Errorf("expected (a, 1), got (%q, %d, %v)", k, v, ok)
+	}
+}
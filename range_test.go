@@ -0,0 +1,249 @@
+package geche
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleKVCache_Range() {
+	cache := NewKVCache[string, int]()
+	for i, k := range []string{"apple", "banana", "cherry", "date", "fig"} {
+		cache.Set(k, i)
+	}
+
+	for k, v := range cache.Range("b", "d") {
+		fmt.Println(k, v)
+	}
+	// Output:
+	// banana 1
+	// cherry 2
+}
+
+type rangeIndex interface {
+	Set(string, int)
+	Range(from, to string) iter.Seq2[string, int]
+	RangeWith(from, to string, opts RangeOptions) iter.Seq2[string, int]
+	Seek(key string) iter.Seq2[string, int]
+	SeekReverse(key string) iter.Seq2[string, int]
+	First() (string, int, bool)
+	Last() (string, int, bool)
+	Floor(key string) (string, int, bool)
+	Ceiling(key string) (string, int, bool)
+}
+
+func collectKeys(seq iter.Seq2[string, int]) []string {
+	var res []string
+	for k := range seq {
+		res = append(res, k)
+	}
+	return res
+}
+
+// expectedRange filters sorted keys using plain string comparison.
+func expectedRange(keys []string, from, to string, opts RangeOptions) []string {
+	var res []string
+	for _, k := range keys {
+		if k < from || (opts.FromExclusive && k == from) {
+			continue
+		}
+		if to != "" && (k > to || (!opts.ToInclusive && k == to)) {
+			continue
+		}
+		res = append(res, k)
+	}
+	if opts.Descending {
+		slices.Reverse(res)
+	}
+	return res
+}
+
+func randomKey(rnd *rand.Rand) string {
+	const alphabet = "abc"
+	b := make([]byte, 1+rnd.Intn(5))
+	for i := range b {
+		b[i] = alphabet[rnd.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+func testRange(t *testing.T, idx rangeIndex) {
+	rnd := rand.New(rand.NewSource(42))
+	set := map[string]int{}
+	for i := 0; i < 200; i++ {
+		k := randomKey(rnd)
+		set[k] = i
+		idx.Set(k, i)
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for i := 0; i < 500; i++ {
+		from, to := randomKey(rnd), randomKey(rnd)
+		switch rnd.Intn(4) {
+		case 0:
+			from = ""
+		case 1:
+			to = ""
+		}
+		opts := RangeOptions{
+			FromExclusive: rnd.Intn(2) == 0,
+			ToInclusive:   rnd.Intn(2) == 0,
+			Descending:    rnd.Intn(2) == 0,
+		}
+
+		expected := expectedRange(keys, from, to, opts)
+		got := collectKeys(idx.RangeWith(from, to, opts))
+		if !slices.Equal(expected, got) {
+			t.Fatalf("RangeWith(%q, %q, %+v): expected %v, got %v", from, to, opts, expected, got)
+		}
+
+		expected = expectedRange(keys, from, to, RangeOptions{})
+		got = collectKeys(idx.Range(from, to))
+		if !slices.Equal(expected, got) {
+			t.Fatalf("Range(%q, %q): expected %v, got %v", from, to, expected, got)
+		}
+
+		expected = expectedRange(keys, from, "", RangeOptions{})
+		got = collectKeys(idx.Seek(from))
+		if !slices.Equal(expected, got) {
+			t.Fatalf("Seek(%q): expected %v, got %v", from, expected, got)
+		}
+
+		expected = nil
+		for _, k := range slices.Backward(keys) {
+			if k <= to {
+				expected = append(expected, k)
+			}
+		}
+		got = collectKeys(idx.SeekReverse(to))
+		if !slices.Equal(expected, got) {
+			t.Fatalf("SeekReverse(%q): expected %v, got %v", to, expected, got)
+		}
+
+		// Ceiling and Floor are the first elements of Seek and SeekReverse.
+		k, v, ok := idx.Ceiling(from)
+		pos, _ := slices.BinarySearch(keys, from)
+		if pos < len(keys) {
+			if !ok || k != keys[pos] || v != set[k] {
+				t.Fatalf("Ceiling(%q): expected %q, got %q %v", from, keys[pos], k, ok)
+			}
+		} else if ok {
+			t.Fatalf("Ceiling(%q): expected nothing, got %q", from, k)
+		}
+
+		k, v, ok = idx.Floor(to)
+		pos, found := slices.BinarySearch(keys, to)
+		if found {
+			pos++
+		}
+		if pos > 0 {
+			if !ok || k != keys[pos-1] || v != set[k] {
+				t.Fatalf("Floor(%q): expected %q, got %q %v", to, keys[pos-1], k, ok)
+			}
+		} else if ok {
+			t.Fatalf("Floor(%q): expected nothing, got %q", to, k)
+		}
+	}
+
+	k, _, ok := idx.First()
+	if !ok || k != keys[0] {
+		t.Errorf("First: expected %q, got %q", keys[0], k)
+	}
+	k, _, ok = idx.Last()
+	if !ok || k != keys[len(keys)-1] {
+		t.Errorf("Last: expected %q, got %q", keys[len(keys)-1], k)
+	}
+}
+
+func TestRange(t *testing.T) {
+	t.Run("KV", func(t *testing.T) {
+		testRange(t, NewKV[int](NewMapCache[string, int]()))
+	})
+	t.Run("KVCache", func(t *testing.T) {
+		testRange(t, NewKVCache[string, int]())
+	})
+}
+
+func TestRangeEmpty(t *testing.T) {
+	kv := NewKV[int](NewMapCache[string, int]())
+	if _, _, ok := kv.First(); ok {
+		t.Error("expected First to return false for empty KV")
+	}
+	if _, _, ok := kv.Floor("foo"); ok {
+		t.Error("expected Floor to return false for empty KV")
+	}
+
+	cache := NewKVCache[[]byte, int]()
+	if _, _, ok := cache.Last(); ok {
+		t.Error("expected Last to return false for empty KVCache")
+	}
+	if _, _, ok := cache.Ceiling([]byte("foo")); ok {
+		t.Error("expected Ceiling to return false for empty KVCache")
+	}
+}
+
+func TestRangeStop(t *testing.T) {
+	cache := NewKVCache[string, int]()
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("%03d", i), i)
+	}
+
+	var got []string
+	for k := range cache.RangeWith("010", "", RangeOptions{FromExclusive: true}) {
+		got = append(got, k)
+		if len(got) == 3 {
+			break
+		}
+	}
+
+	expected := []string{"011", "012", "013"}
+	if !slices.Equal(expected, got) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestRangeLongKeys(t *testing.T) {
+	cache := NewKVCache[string, int]()
+	long := strings.Repeat("x", 2*maxKeyLength)
+	cache.Set(long+"a", 1)
+	cache.Set(long+"b", 2)
+	cache.Set("y", 3)
+
+	got := collectKeys(cache.Range(long, "y"))
+	expected := []string{long + "a", long + "b"}
+	if !slices.Equal(expected, got) {
+		t.Errorf("expected %d long keys, got %d", len(expected), len(got))
+	}
+}
+
+func TestKVRangeSkipsMissing(t *testing.T) {
+	ttl := NewMapTTLCache[string, int](context.Background(), time.Millisecond, 0)
+	kv := NewKV[int](ttl)
+	kv.Set("a", 1)
+	ttl.Set("b", 2)
+	kv.Set("b", 2)
+	kv.Set("c", 3)
+
+	// Remove "b" from the underlying cache only, so trie still has the key.
+	_ = ttl.Del("b")
+
+	got := collectKeys(kv.Range("", ""))
+	expected := []string{"a", "c"}
+	if !slices.Equal(expected, got) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if k, _, ok := kv.Floor("b"); !ok || k != "a" {
+		t.Errorf("expected Floor to skip missing key, got %q", k)
+	}
+}
@@ -0,0 +1,184 @@
+package geche
+
+import "slices"
+
+// RemovalCause is the reason the record was removed from the cache.
+type RemovalCause int
+
+const (
+	// RemovalExpired means that TTL of the record has expired (MapTTLCache).
+	RemovalExpired RemovalCause = iota + 1
+	// RemovalEvicted means that the record was removed to make space
+	// for new records (RingBuffer, DiskCache with MaxSize).
+	RemovalEvicted
+	// RemovalReplaced means that the value was overwritten by the new one.
+	RemovalReplaced
+	// RemovalDeleted means that the record was deleted by Del or DeleteByPrefix.
+	RemovalDeleted
+	// RemovalCleared means that the record was removed by Clear.
+	RemovalCleared
+)
+
+func (c RemovalCause) String() string {
+	switch c {
+	case RemovalExpired:
+		return "expired"
+	case RemovalEvicted:
+		return "evicted"
+	case RemovalReplaced:
+		return "replaced"
+	case RemovalDeleted:
+		return "deleted"
+	case RemovalCleared:
+		return "cleared"
+	default:
+		return "unknown"
+	}
+}
+
+type removalListener[K, V any] struct {
+	f func(key K, value V, cause RemovalCause)
+	// Bit mask of the causes the listener is interested in.
+	causes uint
+}
+
+type removal[K, V any] struct {
+	key   K
+	value V
+	// cause selects listeners of the record, and reported is passed to them.
+	cause    RemovalCause
+	reported RemovalCause
+}
+
+// removals collects records removed while the cache lock is held,
+// so listeners can be called after the lock is released.
+// Records are collected only for the causes some listener is interested in,
+// so caches without listeners do not pay for it.
+// Zero value is ready to use. Methods should be called with the cache lock held.
+type removals[K, V any] struct {
+	listeners []removalListener[K, V]
+	causes    uint
+	pending   []removal[K, V]
+	// Index of the listener set by setEvict plus one, zero if there is none.
+	evictIdx int
+}
+
+// listen adds the listener of the causes.
+func (r *removals[K, V]) listen(f func(key K, value V, cause RemovalCause), causes ...RemovalCause) {
+	l := removalListener[K, V]{f: f}
+	for _, c := range causes {
+		l.causes |= 1 << c
+	}
+
+	r.listeners = append(r.listeners, l)
+	r.causes |= l.causes
+}
+
+// listenAll adds the listener of all causes (OnRemove).
+func (r *removals[K, V]) listenAll(f func(key K, value V, cause RemovalCause)) {
+	r.listen(f, RemovalExpired, RemovalEvicted, RemovalReplaced, RemovalDeleted, RemovalCleared)
+}
+
+// listenEvict adds OnEvict callback. Caches evict records
+// either because they expired or because there is no space left.
+func (r *removals[K, V]) listenEvict(f func(key K, value V)) {
+	l := evictListener(f)
+	r.listeners = append(r.listeners, l)
+	r.causes |= l.causes
+}
+
+func evictListener[K, V any](f func(key K, value V)) removalListener[K, V] {
+	return removalListener[K, V]{
+		f:      func(key K, value V, _ RemovalCause) { f(key, value) },
+		causes: 1<<RemovalExpired | 1<<RemovalEvicted,
+	}
+}
+
+// setEvict replaces OnEvict callback set by the previous call,
+// nil removes it. Listeners taken by take are not changed.
+func (r *removals[K, V]) setEvict(f func(key K, value V)) {
+	listeners := slices.Clone(r.listeners)
+	switch {
+	case r.evictIdx > 0 && f == nil:
+		listeners = slices.Delete(listeners, r.evictIdx-1, r.evictIdx)
+		r.evictIdx = 0
+	case r.evictIdx > 0:
+		listeners[r.evictIdx-1] = evictListener(f)
+	case f != nil:
+		listeners = append(listeners, evictListener(f))
+		r.evictIdx = len(listeners)
+	}
+
+	r.listeners = listeners
+	r.causes = 0
+	for _, l := range listeners {
+		r.causes |= l.causes
+	}
+}
+
+// active returns true if there are listeners.
+func (r *removals[K, V]) active() bool {
+	return r.causes != 0
+}
+
+// wants returns true if some listener is interested in the cause.
+func (r *removals[K, V]) wants(cause RemovalCause) bool {
+	return r.causes&(1<<cause) != 0
+}
+
+// add collects the removed record if some listener is interested in the cause.
+func (r *removals[K, V]) add(key K, value V, cause RemovalCause) {
+	r.addReported(key, value, cause, cause)
+}
+
+// addReported is like add, but listeners of the cause receive reported cause instead
+// (e.g. an expired record deleted by Del is reported as expired to OnRemove,
+// but is not an eviction for OnEvict).
+func (r *removals[K, V]) addReported(key K, value V, cause, reported RemovalCause) {
+	if r.wants(cause) {
+		r.pending = append(r.pending, removal[K, V]{key: key, value: value, cause: cause, reported: reported})
+	}
+}
+
+// take returns collected records along with current listeners.
+// Returned batch should be notified after the lock is released.
+func (r *removals[K, V]) take() removalBatch[K, V] {
+	b := removalBatch[K, V]{listeners: r.listeners, causes: r.causes, records: r.pending}
+	r.pending = nil
+
+	return b
+}
+
+// removalBatch is a set of removed records taken from removals
+// to notify listeners outside of the cache lock.
+type removalBatch[K, V any] struct {
+	listeners []removalListener[K, V]
+	causes    uint
+	records   []removal[K, V]
+}
+
+func (b removalBatch[K, V]) wants(cause RemovalCause) bool {
+	return b.causes&(1<<cause) != 0
+}
+
+// call calls listeners interested in the cause in the order they were added.
+func (b removalBatch[K, V]) call(key K, value V, cause RemovalCause) {
+	b.callReported(key, value, cause, cause)
+}
+
+// callReported calls listeners interested in the cause with reported cause.
+func (b removalBatch[K, V]) callReported(key K, value V, cause, reported RemovalCause) {
+	for _, l := range b.listeners {
+		if l.causes&(1<<cause) != 0 {
+			l.f(key, value, reported)
+		}
+	}
+}
+
+// notify calls listeners for all records of the batch
+// in the order they were removed.
+func (b removalBatch[K, V]) notify() {
+	for _, r := range b.records {
+		b.callReported(r.key, r.value, r.cause, r.reported)
+	}
+}
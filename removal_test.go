@@ -0,0 +1,296 @@
+package geche
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func ExampleMapCache_OnRemove() {
+	c := NewMapCache[string, string]()
+	c.OnRemove(func(key, value string, cause RemovalCause) {
+		fmt.Println(key, value, cause)
+	})
+
+	c.Set("a", "1")
+	c.Set("a", "2")
+	_ = c.Del("a")
+	// Output:
+	// a 1 replaced
+	// a 2 deleted
+}
+
+// removalLog records removals reported to the listener.
+type removalLog struct {
+	mux     sync.Mutex
+	records []string
+}
+
+func (l *removalLog) listen(key, value string, cause RemovalCause) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.records = append(l.records, fmt.Sprintf("%s=%s %s", key, value, cause))
+}
+
+// sorted returns recorded removals sorted, since order of cleared records is not defined.
+func (l *removalLog) sorted() []string {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	return slices.Sorted(slices.Values(l.records))
+}
+
+func TestOnRemove(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		new  func() Geche[string, string]
+	}{
+		{"MapCache", func() Geche[string, string] { return NewMapCache[string, string]() }},
+		{"MapTTLCache", func() Geche[string, string] {
+			return NewMapTTLCache[string, string](t.Context(), time.Hour, time.Hour)
+		}},
+		{"RingBuffer", func() Geche[string, string] { return NewRingBuffer[string, string](10) }},
+		{"KVCache", func() Geche[string, string] { return NewKVCache[string, string]() }},
+		{"DiskCache", func() Geche[string, string] { return newTestDiskCache(t, DiskCacheOptions{}) }},
+		{"Sharded", func() Geche[string, string] {
+			return NewSharded(func() Geche[string, string] { return NewMapCache[string, string]() }, 4, &StringMapper{})
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.new()
+			log := &removalLog{}
+			c.(RemovalNotifier[string, string]).OnRemove(log.listen)
+
+			c.Set("a", "1")
+			c.Set("a", "2")
+			c.SetIfPresent("a", "3")
+			c.SetIfAbsent("a", "x")
+			c.Set("b", "4")
+			c.Set("c", "5")
+			_ = c.Del("a")
+			_ = c.Del("missing")
+			c.Clear()
+
+			expected := []string{"a=1 replaced", "a=2 replaced", "a=3 deleted", "b=4 cleared", "c=5 cleared"}
+			if got := log.sorted(); !slices.Equal(got, expected) {
+				t.Errorf("expected removals %v, got %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestRingBufferOnRemove(t *testing.T) {
+	c := NewRingBuffer[int, int](3)
+	var evicted, removed []string
+	c.OnEvict(func(key, value int) {
+		evicted = append(evicted, fmt.Sprintf("%d=%d", key, value))
+	})
+	c.OnRemove(func(key, value int, cause RemovalCause) {
+		removed = append(removed, fmt.Sprintf("%d=%d %s", key, value, cause))
+	})
+
+	c.Set(1, 1)
+	c.Set(2, 2)
+	c.Set(1, 10) // Key 1 is moved to the head of the buffer.
+	c.Set(3, 3)  // Overwrites stale record of key 1.
+	c.Set(4, 4)  // Evicts key 2.
+	c.Clear()
+
+	if !slices.Equal(evicted, []string{"2=2"}) {
+		t.Errorf("expected OnEvict to be called only for evictions, got %v", evicted)
+	}
+
+	expected := []string{"1=1 replaced", "2=2 evicted", "1=10 cleared", "3=3 cleared", "4=4 cleared"}
+	if !slices.Equal(removed, expected) {
+		t.Errorf("expected removals %v, got %v", expected, removed)
+	}
+}
+
+func TestMapTTLCacheOnRemove(t *testing.T) {
+	c := NewMapTTLCache[string, string](t.Context(), time.Second, time.Hour)
+	log := &removalLog{}
+	c.OnRemove(log.listen)
+	ts := time.Now()
+
+	c.Set("a", "1")
+	c.Set("b", "2")
+	c.Set("c", "3")
+
+	c.mux.Lock()
+	c.now = func() time.Time { return ts.Add(2 * time.Second) }
+	c.mux.Unlock()
+
+	// Expired records are reported as expired whatever removes them.
+	_ = c.Del("a")
+	c.Set("b", "4")
+	if err := c.cleanup(); err != nil {
+		t.Fatalf("unexpected error in cleanup: %v", err)
+	}
+	c.Clear()
+
+	expected := []string{"a=1 expired", "b=2 expired", "b=4 cleared", "c=3 expired"}
+	if got := log.sorted(); !slices.Equal(got, expected) {
+		t.Errorf("expected removals %v, got %v", expected, got)
+	}
+}
+
+func TestMapTTLCacheOnEvictExpiredDel(t *testing.T) {
+	c := NewMapTTLCache[string, string](t.Context(), time.Second, time.Hour)
+	var evicted []string
+	c.OnEvict(func(key, value string) {
+		evicted = append(evicted, key+"="+value)
+	})
+	log := &removalLog{}
+	c.OnRemove(log.listen)
+	ts := time.Now()
+
+	c.Set("a", "1")
+	c.Set("b", "2")
+	c.Set("c", "3")
+	c.Set("d", "4")
+
+	c.mux.Lock()
+	c.now = func() time.Time { return ts.Add(2 * time.Second) }
+	c.mux.Unlock()
+
+	// Expired records removed by Del, Set and Clear are not evicted.
+	_ = c.Del("a")
+	c.Set("b", "5")
+	if err := c.cleanup(); err != nil {
+		t.Fatalf("unexpected error in cleanup: %v", err)
+	}
+	c.Set("d", "6")
+	c.mux.Lock()
+	c.now = func() time.Time { return ts.Add(4 * time.Second) }
+	c.mux.Unlock()
+	c.Clear()
+
+	expected := []string{"c=3", "d=4"}
+	slices.Sort(evicted)
+	if !slices.Equal(evicted, expected) {
+		t.Errorf("expected only cleanup to evict %v, got %v", expected, evicted)
+	}
+
+	expected = []string{"a=1 expired", "b=2 expired", "b=5 expired", "c=3 expired", "d=4 expired", "d=6 expired"}
+	if got := log.sorted(); !slices.Equal(got, expected) {
+		t.Errorf("expected removals %v, got %v", expected, got)
+	}
+}
+
+func TestDiskCacheOnRemove(t *testing.T) {
+	c := newTestDiskCache(t, DiskCacheOptions{SegmentSize: 64, MaxSize: 128, GCInterval: -1})
+	log := &removalLog{}
+	c.OnRemove(log.listen)
+
+	for i := 0; i < 20; i++ {
+		c.Set(strconv.Itoa(i), "value")
+	}
+
+	evicted := 0
+	for _, r := range log.sorted() {
+		if !strings.HasSuffix(r, "=value evicted") {
+			t.Fatalf("expected only evictions, got %q", r)
+		}
+		evicted++
+	}
+	if evicted == 0 || evicted+c.Len() != 20 {
+		t.Errorf("expected %d records to be evicted, got %d", 20-c.Len(), evicted)
+	}
+
+	log.records = nil
+	left := c.Len()
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected error in Close: %v", err)
+	}
+	if len(log.records) != left {
+		t.Errorf("expected Close to report %d records, got %v", left, log.records)
+	}
+}
+
+func TestKVCacheOnRemove(t *testing.T) {
+	kv := NewKVCache[[]byte, int]()
+	var removed []string
+	kv.OnRemove(func(key []byte, value int, cause RemovalCause) {
+		removed = append(removed, fmt.Sprintf("%s=%d %s", key, value, cause))
+	})
+
+	kv.Set([]byte("a"), 1)
+	kv.Set([]byte("ab"), 2)
+	kv.SetWithScore([]byte("ab"), 3, 1)
+	kv.Set([]byte("b"), 4)
+	kv.DeleteByPrefix([]byte("a"))
+	kv.Clear()
+
+	expected := []string{"ab=2 replaced", "a=1 deleted", "ab=3 deleted", "b=4 cleared"}
+	if !slices.Equal(removed, expected) {
+		t.Errorf("expected removals %v, got %v", expected, removed)
+	}
+}
+
+func TestShardedOnRemoveResize(t *testing.T) {
+	c := NewSharded(
+		func() Geche[int, string] { return NewMapCache[int, string]() },
+		2,
+		&NumberMapper[int]{},
+	)
+
+	type rec struct {
+		key   int
+		cause RemovalCause
+	}
+	var (
+		mux     sync.Mutex
+		removed []rec
+	)
+	c.OnRemove(func(key int, _ string, cause RemovalCause) {
+		mux.Lock()
+		removed = append(removed, rec{key, cause})
+		mux.Unlock()
+	})
+
+	for i := 0; i < 100; i++ {
+		c.Set(i, strconv.Itoa(i))
+	}
+
+	c.Resize(4)
+	if len(removed) != 0 {
+		t.Fatalf("expected migrated records not to be reported, got %v", removed)
+	}
+
+	// Shards created by Resize report removals too.
+	_ = c.Del(3)
+
+	// Emulate state in the middle of migration from 4 to 8 shards.
+	startMigration(c, 8, func() Geche[int, string] { return NewMapCache[int, string]() })
+
+	c.Set(7, "seven")
+	c.SetIfPresent(5, "five")
+
+	slices.SortFunc(removed, func(a, b rec) int { return cmp.Compare(a.key, b.key) })
+	expected := []rec{{3, RemovalDeleted}, {5, RemovalReplaced}, {7, RemovalReplaced}}
+	if !slices.Equal(removed, expected) {
+		t.Errorf("expected removals %v, got %v", expected, removed)
+	}
+}
+
+func TestOnRemoveOutsideLock(t *testing.T) {
+	c := NewMapCache[int, int]()
+	c.OnRemove(func(key, value int, cause RemovalCause) {
+		// Callback can use the cache.
+		if cause == RemovalDeleted {
+			c.Set(-key, value)
+		}
+	})
+
+	c.Set(1, 1)
+	_ = c.Del(1)
+	if v, err := c.Get(-1); err != nil || v != 1 {
+		t.Errorf("expected callback to set the record, got %d, %v", v, err)
+	}
+}
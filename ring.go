@@ -16,11 +16,12 @@ type BufferRec[K comparable, V any] struct {
 // The idea is to reduce allocations and GC pressure while having
 // fixed memory footprint (does not grow).
 type RingBuffer[K comparable, V any] struct {
-	data  []BufferRec[K, V]
-	index map[K]int
-	head  int
-	zeroV V
-	mux   sync.RWMutex
+	data     []BufferRec[K, V]
+	index    map[K]int
+	head     int
+	zeroV    V
+	mux      sync.RWMutex
+	removals removals[K, V]
 }
 
 // NewRingBuffer creates RingBuffer instance with predifined size (number of records).
@@ -40,19 +41,70 @@ func NewRingBuffer[K comparable, V any](size int) *RingBuffer[K, V] {
 	return &b
 }
 
+// OnEvict adds a callback function that will be called when a record is
+// overwritten because the buffer is full. The callback receives the key and
+// value of the evicted record and is called outside of the cache lock.
+// Multiple callbacks can be added, they are called in the order they were added.
+// Note that the eviction callback is not called for Del and Clear operations.
+func (c *RingBuffer[K, V]) OnEvict(f func(key K, value V)) {
+	c.listenEvict(f)
+}
+
+func (c *RingBuffer[K, V]) listenEvict(f func(key K, value V)) {
+	c.mux.Lock()
+	c.removals.listenEvict(f)
+	c.mux.Unlock()
+}
+
+// OnRemove adds a callback function that will be called when a record is
+// removed from the cache: evicted because the buffer is full,
+// replaced by Set or SetIfPresent, deleted or cleared.
+// The callback is called outside of the cache lock.
+// Multiple callbacks can be added, they are called in the order they were added.
+func (c *RingBuffer[K, V]) OnRemove(f func(key K, value V, cause RemovalCause)) {
+	c.mux.Lock()
+	c.removals.listenAll(f)
+	c.mux.Unlock()
+}
+
+// unlock releases the write lock and notifies listeners
+// about records removed while it was held.
+func (c *RingBuffer[K, V]) unlock() {
+	removed := c.removals.take()
+	c.mux.Unlock()
+	removed.notify()
+}
+
 // Set adds value to the ring buffer and key index.
 func (c *RingBuffer[K, V]) Set(key K, value V) {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
+
 	c.set(key, value)
 }
 
+// set writes the record to the head of the buffer.
+// Record evicted to make space for the new one is collected for listeners.
 func (c *RingBuffer[K, V]) set(key K, value V) {
+	if c.removals.wants(RemovalReplaced) {
+		if i, ok := c.index[key]; ok {
+			c.removals.add(key, c.data[i].V, RemovalReplaced)
+		}
+	}
+
 	// Remove the key which value we are overwriting
 	// from the map. GC does not cleanup preallocated map,
 	// so no pressure here.
-	if old := c.data[c.head]; !old.empty {
-		delete(c.index, old.K)
+	// If the key was set again later, the index already points
+	// to the newer record, which is not evicted.
+	old := c.data[c.head]
+	if !old.empty {
+		if i, ok := c.index[old.K]; ok && i == c.head {
+			delete(c.index, old.K)
+			if old.K != key {
+				c.removals.add(old.K, old.V, RemovalEvicted)
+			}
+		}
 	}
 
 	c.data[c.head].K = key
@@ -64,12 +116,13 @@ func (c *RingBuffer[K, V]) set(key K, value V) {
 
 func (c *RingBuffer[K, V]) SetIfPresent(key K, value V) (V, bool) {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
 
 	i, present := c.index[key]
 	if present {
 		oldVal := c.data[i].V
 		c.data[i].V = value
+		c.removals.add(key, oldVal, RemovalReplaced)
 		return oldVal, present
 	}
 
@@ -78,7 +131,7 @@ func (c *RingBuffer[K, V]) SetIfPresent(key K, value V) (V, bool) {
 
 func (c *RingBuffer[K, V]) SetIfAbsent(key K, value V) (V, bool) {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
 
 	i, present := c.index[key]
 	if present {
@@ -105,7 +158,7 @@ func (c *RingBuffer[K, V]) Get(key K) (V, error) {
 // Del removes key from the cache. Return value is always nil.
 func (c *RingBuffer[K, V]) Del(key K) error {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
 
 	idx, ok := c.index[key]
 	if !ok {
@@ -115,6 +168,7 @@ func (c *RingBuffer[K, V]) Del(key K) error {
 	// Mark item as deleted.
 	c.data[idx].empty = true
 	delete(c.index, key)
+	c.removals.add(key, c.data[idx].V, RemovalDeleted)
 
 	return nil
 }
@@ -144,7 +198,17 @@ func (c *RingBuffer[K, V]) Len() int {
 // Clear removes all items from the cache.
 func (c *RingBuffer[K, V]) Clear() {
 	c.mux.Lock()
-	defer c.mux.Unlock()
+	defer c.unlock()
+
+	if c.removals.wants(RemovalCleared) {
+		for i := 0; i < len(c.data); i++ {
+			idx := (c.head + i) % len(c.data)
+			// Records of keys that were set again later are not in the index.
+			if j, ok := c.index[c.data[idx].K]; ok && j == idx && !c.data[idx].empty {
+				c.removals.add(c.data[idx].K, c.data[idx].V, RemovalCleared)
+			}
+		}
+	}
 
 	for i := range c.data {
 		c.data[i] = BufferRec[K, V]{empty: true}
@@ -221,3 +285,17 @@ func (c *RingBuffer[K, V]) All() iter.Seq2[K, V] {
 		}
 	}
 }
+
+// Keys is a (read-only) iterator over all keys in the cache
+// in the order they were added.
+// Same locking rules as for All apply.
+func (c *RingBuffer[K, V]) Keys() iter.Seq[K] {
+	return keysOf(c.All())
+}
+
+// Values is a (read-only) iterator over all values in the cache
+// in the order they were added.
+// Same locking rules as for All apply.
+func (c *RingBuffer[K, V]) Values() iter.Seq[V] {
+	return valuesOf(c.All())
+}
@@ -488,3 +488,49 @@ func TestRingAllIterator_Break(t *testing.T) {
 		t.Errorf("expected 5 items from iterator, but got %d", count)
 	}
 }
+
+func TestRingOnEvict(t *testing.T) {
+	c := NewRingBuffer[string, string](3)
+
+	evicted := map[string]string{}
+	c.OnEvict(func(key string, value string) {
+		evicted[key] = value
+	})
+
+	c.Set("a", "1")
+	c.Set("b", "2")
+	c.Set("c", "3")
+	if len(evicted) != 0 {
+		t.Errorf("expected no evictions, got %v", evicted)
+	}
+
+	// Overwrites slot of "a".
+	c.Set("d", "4")
+	// Overwrites slot of "b", but "b" is set again, so it is a replacement.
+	c.Set("b", "5")
+	if len(evicted) != 1 || evicted["a"] != "1" {
+		t.Errorf("expected only \"a\" to be evicted, got %v", evicted)
+	}
+
+	// Overwrites slot of "c", which is evicted.
+	if _, inserted := c.SetIfAbsent("e", "6"); !inserted {
+		t.Error("expected SetIfAbsent to insert the value")
+	}
+	if len(evicted) != 2 || evicted["c"] != "3" {
+		t.Errorf("expected \"c\" to be evicted, got %v", evicted)
+	}
+
+	// Overwrites slot of "d".
+	c.Set("f", "7")
+	if evicted["d"] != "4" {
+		t.Errorf("expected \"d\" to be evicted, got %v", evicted)
+	}
+
+	// Del does not call the callback.
+	if err := c.Del("b"); err != nil {
+		t.Errorf("unexpected error in Del: %v", err)
+	}
+	if _, ok := evicted["b"]; ok {
+		t.Errorf("expected no eviction for Del, got %v", evicted)
+	}
+}
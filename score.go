@@ -0,0 +1,252 @@
+package geche
+
+import (
+	"container/heap"
+	"math"
+)
+
+// ScoredEntry is a result of TopByPrefix.
+type ScoredEntry[K byteSlice, V any] struct {
+	Key   K
+	Value V
+	Score float64
+}
+
+// SetWithScore sets the value for the key along with its score
+// that is used by TopByPrefix. First call enables scoring for the cache,
+// after that subtree maximum scores are maintained in the trie on every change.
+// Keys set with plain Set keep their previous score (or get score 0 if they are new),
+// unless score function is set by SetScoreFunc.
+func (kv *KVCache[K, V]) SetWithScore(key K, value V, score float64) {
+	kv.mux.Lock()
+	defer kv.unlock()
+
+	kv.enableScores()
+	kv.beforeSet(key, value)
+	kv.insert(key, value)
+	kv.updateScore(key, score, true)
+}
+
+// SetScoreFunc sets the function deriving score from the value.
+// Scores of all values in the cache are recomputed, and Set (as well as
+// SetIfPresent and SetIfAbsent) will use the function to compute the score.
+// Passing nil unsets the function, but keeps existing scores.
+func (kv *KVCache[K, V]) SetScoreFunc(f func(V) float64) {
+	kv.mux.Lock()
+	defer kv.mux.Unlock()
+
+	kv.scoreFunc = f
+	if f == nil {
+		return
+	}
+
+	kv.enableScores()
+	walkRange(kv.trie, keyRange{}, func(_ []byte, node *trieCacheNode[K]) bool {
+		kv.scores[node.valueIndex] = f(kv.values[node.valueIndex])
+		return true
+	})
+	kv.recomputeMaxScores()
+}
+
+// TopByPrefix returns up to k records with keys starting with the given prefix
+// that have the highest scores, ordered by score (descending) and then by key.
+// Best-first search guided by subtree maximum scores is used, so only
+// a small part of the subtree is visited if scores vary enough.
+// If scoring is not enabled, all scores are 0 and first k keys are returned.
+func (kv *KVCache[K, V]) TopByPrefix(prefix K, k int) []ScoredEntry[K, V] {
+	kv.mux.RLock()
+	defer kv.mux.RUnlock()
+
+	if k <= 0 {
+		return nil
+	}
+
+	path, ok := kv.findPrefix(prefix)
+	if !ok {
+		return nil
+	}
+
+	start := kv.trie
+	key := ""
+	if len(path) > 0 {
+		start = path[len(path)-1].node
+		// Prefix can end in the middle of the node segment.
+		for _, e := range path {
+			key += keyToString(e.node.b)
+		}
+	}
+
+	h := scoreHeap[K]{{node: start, key: key, score: start.maxScore}}
+	res := make([]ScoredEntry[K, V], 0, k)
+	for len(h) > 0 && len(res) < k {
+		top := heap.Pop(&h).(scoreItem[K])
+		if top.value {
+			res = append(res, ScoredEntry[K, V]{
+				Key:   cloneKey(stringToKey[K](top.key)),
+				Value: kv.values[top.node.valueIndex],
+				Score: top.score,
+			})
+			continue
+		}
+
+		if top.node.terminal {
+			heap.Push(&h, scoreItem[K]{
+				node:  top.node,
+				key:   top.key,
+				score: kv.score(top.node.valueIndex),
+				value: true,
+			})
+		}
+		for i := range top.node.children {
+			child := &top.node.children[i]
+			heap.Push(&h, scoreItem[K]{
+				node:  child,
+				key:   top.key + keyToString(child.b),
+				score: child.maxScore,
+			})
+		}
+	}
+
+	return res
+}
+
+// scoreItem is either a subtree (with its maximum score) or a single value
+// in the best-first search queue.
+type scoreItem[K byteSlice] struct {
+	node  *trieCacheNode[K]
+	key   string
+	score float64
+	value bool
+}
+
+// scoreHeap orders items by score (descending), then by key. When key is the same,
+// value goes before the subtree. This way results with equal scores are ordered by key.
+type scoreHeap[K byteSlice] []scoreItem[K]
+
+func (h scoreHeap[K]) Len() int { return len(h) }
+
+func (h scoreHeap[K]) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	if h[i].key != h[j].key {
+		return h[i].key < h[j].key
+	}
+	return h[i].value && !h[j].value
+}
+
+func (h scoreHeap[K]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *scoreHeap[K]) Push(x any) { *h = append(*h, x.(scoreItem[K])) }
+
+func (h *scoreHeap[K]) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// set inserts the value and maintains scores if scoring is enabled.
+func (kv *KVCache[K, V]) set(key K, value V) {
+	kv.beforeSet(key, value)
+	kv.insert(key, value)
+	if kv.scores == nil {
+		return
+	}
+
+	if kv.scoreFunc != nil {
+		kv.updateScore(key, kv.scoreFunc(value), true)
+	} else {
+		kv.updateScore(key, 0, false)
+	}
+}
+
+// growScores makes scores slice as long as values slice.
+func (kv *KVCache[K, V]) growScores() {
+	if len(kv.scores) < len(kv.values) {
+		kv.scores = append(kv.scores, make([]float64, len(kv.values)-len(kv.scores))...)
+	}
+}
+
+func (kv *KVCache[K, V]) score(idx int) float64 {
+	if idx < len(kv.scores) {
+		return kv.scores[idx]
+	}
+	return 0
+}
+
+// enableScores allocates scores for all values. Existing values get score 0.
+func (kv *KVCache[K, V]) enableScores() {
+	if kv.scores != nil {
+		return
+	}
+
+	kv.scores = make([]float64, len(kv.values))
+	kv.recomputeMaxScores()
+}
+
+// updateScore sets the score of the existing key (if ok is true) and updates
+// subtree maximum scores on the path from the root to the key.
+func (kv *KVCache[K, V]) updateScore(key K, score float64, ok bool) {
+	kv.growScores()
+
+	path, _ := kv.findPrefix(key)
+	node := kv.trie
+	if len(path) > 0 {
+		node = path[len(path)-1].node
+	}
+	if ok {
+		kv.scores[node.valueIndex] = score
+	}
+
+	kv.updateMaxScores(path)
+}
+
+// updateMaxScore recomputes maximum score of the node from its own score
+// and maximum scores of its children.
+func (kv *KVCache[K, V]) updateMaxScore(n *trieCacheNode[K]) {
+	m := math.Inf(-1)
+	if n.terminal {
+		m = kv.scores[n.valueIndex]
+	}
+	for i := range n.children {
+		m = max(m, n.children[i].maxScore)
+	}
+	n.maxScore = m
+}
+
+// updateMaxScores recomputes maximum scores bottom-up along the path and for the root.
+func (kv *KVCache[K, V]) updateMaxScores(path []trieCachePathEntry[K]) {
+	for i := len(path) - 1; i >= 0; i-- {
+		kv.updateMaxScore(path[i].node)
+	}
+	kv.updateMaxScore(kv.trie)
+}
+
+// recomputeMaxScores recomputes maximum scores for all nodes of the trie.
+func (kv *KVCache[K, V]) recomputeMaxScores() {
+	type stackEntry struct {
+		node *trieCacheNode[K]
+		post bool
+	}
+
+	kv.ownRoot()
+	stack := []stackEntry{{node: kv.trie}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if e.post {
+			kv.updateMaxScore(e.node)
+			continue
+		}
+
+		kv.ownChildren(e.node)
+
+		// Children are processed before the node itself.
+		stack = append(stack, stackEntry{node: e.node, post: true})
+		for i := range e.node.children {
+			stack = append(stack, stackEntry{node: &e.node.children[i]})
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package geche
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func ExampleKVCache_TopByPrefix() {
+	cache := NewKVCache[string, int]()
+	cache.SetWithScore("golang", 1, 10)
+	cache.SetWithScore("google", 2, 50)
+	cache.SetWithScore("gopher", 3, 30)
+	cache.SetWithScore("rust", 4, 100)
+
+	for _, e := range cache.TopByPrefix("go", 2) {
+		fmt.Println(e.Key, e.Score)
+	}
+	// Output:
+	// google 50
+	// gopher 30
+}
+
+// checkMaxScores verifies that maxScore of every node is the maximum score in its subtree.
+func checkMaxScores(t *testing.T, kv *KVCache[string, int], n *trieCacheNode[string]) float64 {
+	t.Helper()
+
+	m := math.Inf(-1)
+	if n.terminal {
+		m = kv.scores[n.valueIndex]
+	}
+	for i := range n.children {
+		m = max(m, checkMaxScores(t, kv, &n.children[i]))
+	}
+
+	if n.maxScore != m && (n.terminal || len(n.children) > 0) {
+		t.Fatalf("node %q has max score %v, expected %v", n.b, n.maxScore, m)
+	}
+
+	return m
+}
+
+func expectedTop(scores map[string]float64, values map[string]int, prefix string, k int) []ScoredEntry[string, int] {
+	var res []ScoredEntry[string, int]
+	for key, s := range scores {
+		if strings.HasPrefix(key, prefix) {
+			res = append(res, ScoredEntry[string, int]{Key: key, Value: values[key], Score: s})
+		}
+	}
+	slices.SortFunc(res, func(a, b ScoredEntry[string, int]) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return res[:min(k, len(res))]
+}
+
+func TestTopByPrefix(t *testing.T) {
+	rnd := rand.New(rand.NewSource(17))
+	randKey := func() string {
+		b := make([]byte, rnd.Intn(6))
+		for j := range b {
+			b[j] = "abc"[rnd.Intn(3)]
+		}
+		return string(b)
+	}
+
+	cache := NewKVCache[string, int]()
+	scores := map[string]float64{}
+	values := map[string]int{}
+
+	// Keys added before scoring is enabled get score 0.
+	for i := 0; i < 50; i++ {
+		k := randKey()
+		cache.Set(k, i)
+		scores[k] = 0
+		values[k] = i
+	}
+
+	for i := 0; i < 3000; i++ {
+		k := randKey()
+		switch rnd.Intn(10) {
+		case 0, 1:
+			_ = cache.Del(k)
+			delete(scores, k)
+			delete(values, k)
+		case 2:
+			p := k[:len(k)/2]
+			cache.DeleteByPrefix(p)
+			for key := range scores {
+				if strings.HasPrefix(key, p) {
+					delete(scores, key)
+					delete(values, key)
+				}
+			}
+		case 3, 4:
+			// Plain Set keeps the score of the existing key.
+			cache.Set(k, i)
+			if _, ok := scores[k]; !ok {
+				scores[k] = 0
+			}
+			values[k] = i
+		default:
+			s := float64(rnd.Intn(20))
+			cache.SetWithScore(k, i, s)
+			scores[k] = s
+			values[k] = i
+		}
+
+		if cache.scores != nil {
+			checkMaxScores(t, cache, cache.trie)
+		}
+
+		p := randKey()
+		p = p[:len(p)/2]
+		n := rnd.Intn(8)
+		expected := expectedTop(scores, values, p, n)
+		got := cache.TopByPrefix(p, n)
+		if len(expected) == 0 && len(got) == 0 {
+			continue
+		}
+		if !slices.Equal(expected, got) {
+			t.Fatalf("TopByPrefix(%q, %d): expected %v, got %v", p, n, expected, got)
+		}
+	}
+}
+
+func TestTopByPrefixBytesKeyCopy(t *testing.T) {
+	cache := NewKVCache[[]byte, int]()
+	cache.SetWithScore([]byte("ab"), 1, 10)
+	cache.SetWithScore([]byte("abc"), 2, 20)
+
+	top := cache.TopByPrefix([]byte("ab"), 2)
+	if len(top) != 2 {
+		t.Fatalf("expected 2 results, got %v", top)
+	}
+	for _, e := range top {
+		e.Key[0] = 'x'
+	}
+
+	// Returned keys are owned by the caller.
+	if v, err := cache.Get([]byte("ab")); err != nil || v != 1 {
+		t.Errorf("expected cache not to be affected by mutated keys, got %v, %v", v, err)
+	}
+	top = cache.TopByPrefix([]byte("ab"), 2)
+	if len(top) != 2 || string(top[0].Key) != "abc" || string(top[1].Key) != "ab" {
+		t.Errorf("unexpected result after mutating keys %v", top)
+	}
+}
+
+func TestTopByPrefixScoreFunc(t *testing.T) {
+	cache := NewKVCache[string, int]()
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("k%02d", i), i)
+	}
+
+	// Without scoring all scores are 0, so first keys are returned.
+	top := cache.TopByPrefix("k", 2)
+	if len(top) != 2 || top[0].Key != "k00" || top[1].Key != "k01" {
+		t.Fatalf("unexpected result without scores: %v", top)
+	}
+
+	// Existing values are rescored.
+	cache.SetScoreFunc(func(v int) float64 { return float64(v % 10) })
+	top = cache.TopByPrefix("k", 3)
+	expected := []string{"k09", "k19", "k29"}
+	for i, e := range top {
+		if e.Key != expected[i] || e.Score != 9 {
+			t.Fatalf("expected %v, got %v", expected, top)
+		}
+	}
+
+	// New values are scored with the function.
+	cache.Set("k", 1009)
+	top = cache.TopByPrefix("", 1)
+	if len(top) != 1 || top[0].Key != "k" || top[0].Score != 9 {
+		t.Fatalf("unexpected result %v", top)
+	}
+	cache.Set("k", 1000)
+	top = cache.TopByPrefix("", 1)
+	if len(top) != 1 || top[0].Key != "k09" {
+		t.Fatalf("unexpected result %v", top)
+	}
+
+	cache.Clear()
+	if top := cache.TopByPrefix("", 10); len(top) != 0 {
+		t.Fatalf("expected empty result after Clear, got %v", top)
+	}
+	cache.Set("a", 5)
+	top = cache.TopByPrefix("", 10)
+	if len(top) != 1 || top[0].Score != 5 {
+		t.Fatalf("unexpected result after Clear %v", top)
+	}
+}
@@ -1,8 +1,13 @@
 package geche
 
 import (
+	"errors"
+	"iter"
 	"math"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
 )
 
 type integer interface {
@@ -25,6 +30,8 @@ func (nm *NumberMapper[K]) Map(key K, numShards int) int {
 // StringMapper is a simple implementation mapping string keys to N shards.
 // It works best with number of shards that is power of 2, and it
 // works up to 256 shards.
+// Keys consisting of the same bytes (e.g. anagrams) are always mapped to the
+// same shard. Use StringHashMapper if this is a problem.
 type StringMapper struct{}
 
 // Map key to shard number. Should be uniform enough 🤣
@@ -37,13 +44,74 @@ func (sm *StringMapper) Map(key string, numShards int) int {
 	return int(s) % numShards
 }
 
+// reshardBatchSize is the number of keys migrated by Resize
+// while holding the exclusive lock.
+const reshardBatchSize = 128
+
+// Kinds of key moves between shard layouts (see Sharded.OnRemove).
+const (
+	// Key is migrated by Resize, its deletion from the old shard is not reported.
+	moveMigrate int32 = iota + 1
+	// Key is set with a new value, its deletion from the old shard is reported as replacement.
+	moveReplace
+)
+
 // Sharded is a wrapper for any Geche interface implementation
 // that provides the same interface itself. The idea is to better
 // utilize CPUs using several thread safe shards.
 type Sharded[K comparable, V any] struct {
-	N      int
+	// layout is the current set of shards. Operations load it without
+	// taking the global lock, unless resharding is in progress.
+	layout       atomic.Pointer[shardLayout[K, V]]
+	mapper       Mapper[K]
+	shardFactory func() Geche[K, V]
+	// mux is taken by operations only while Resize migrates the keys
+	// (write operations take the write lock, Get takes the read lock),
+	// by Resize to publish layouts and move keys, and by whole-cache operations.
+	mux sync.RWMutex
+	// resizeMux serializes Resize calls.
+	resizeMux sync.Mutex
+	// consistent makes whole-cache operations freeze all shards.
+	consistent atomic.Bool
+	// Removal listeners added to every shard, including ones created by Resize.
+	onRemove []func(key K, value V, cause RemovalCause)
+	// moving is the kind of the key move in progress. Moves are made
+	// with the write lock held, so there is at most one at a time.
+	moving atomic.Int32
+}
+
+// shardLayout is a set of shards. Layouts are not modified,
+// Resize publishes a new one instead.
+type shardLayout[K comparable, V any] struct {
 	shards []Geche[K, V]
-	mapper Mapper[K]
+	// gates are read-locked by operations on the corresponding shards
+	// made without the global lock. Resize locks them to wait
+	// for such operations to finish before it starts moving keys.
+	gates []shardGate
+	// Old layout, non-nil only while Resize migrates the keys.
+	old []Geche[K, V]
+}
+
+// shardGate is padded to the cache line size, so operations
+// on different shards do not contend on it.
+type shardGate struct {
+	sync.RWMutex
+	_ [64 - unsafe.Sizeof(sync.RWMutex{})]byte
+}
+
+func newShardLayout[K comparable, V any](shards []Geche[K, V]) *shardLayout[K, V] {
+	return &shardLayout[K, V]{
+		shards: shards,
+		gates:  make([]shardGate, len(shards)),
+	}
+}
+
+// drain waits for operations on the layout made without the global lock to finish.
+func (l *shardLayout[K, V]) drain() {
+	for i := range l.gates {
+		l.gates[i].Lock()
+		l.gates[i].Unlock()
+	}
 }
 
 // NewSharded creates numShards underlying cache containers
@@ -59,47 +127,266 @@ func NewSharded[K comparable, V any](
 		numShards = defaultShardNumber()
 	}
 	s := Sharded[K, V]{
-		N:      numShards,
-		mapper: keyMapper,
+		mapper:       keyMapper,
+		shardFactory: shardFactory,
 	}
 
+	shards := make([]Geche[K, V], 0, numShards)
 	for i := 0; i < numShards; i++ {
-		s.shards = append(s.shards, shardFactory())
+		shards = append(shards, shardFactory())
 	}
+	s.layout.Store(newShardLayout(shards))
 
 	return &s
 }
 
+// enter returns the layout and the index of the key's shard with the gate
+// of the shard read-locked. Returns false if resharding is in progress,
+// then the operation should be made with the global lock held.
+func (s *Sharded[K, V]) enter(key K) (*shardLayout[K, V], int, bool) {
+	l := s.layout.Load()
+	if l.old != nil {
+		return nil, 0, false
+	}
+
+	idx := s.mapper.Map(key, len(l.shards))
+	l.gates[idx].RLock()
+	if s.layout.Load() != l {
+		// Resize has just started, it will wait for this gate.
+		l.gates[idx].RUnlock()
+		return nil, 0, false
+	}
+
+	return l, idx, true
+}
+
+// oldShard returns the shard of the old layout the key may still reside in
+// while resharding is in progress. Returns nil if there is no such shard,
+// or if it is the same shard the key is mapped to in the new layout.
+// Caller must hold the lock.
+func (s *Sharded[K, V]) oldShard(l *shardLayout[K, V], key K, idx int) Geche[K, V] {
+	if l.old == nil {
+		return nil
+	}
+
+	// Shards with index below min(len(old), len(shards)) are the same
+	// instances in both layouts, so same index means the same shard.
+	oldIdx := s.mapper.Map(key, len(l.old))
+	if oldIdx == idx {
+		return nil
+	}
+
+	return l.old[oldIdx]
+}
+
 // Set key-value pair in the underlying sharded cache.
 func (s *Sharded[K, V]) Set(key K, value V) {
-	s.shards[s.mapper.Map(key, s.N)].Set(key, value)
+	if l, idx, ok := s.enter(key); ok {
+		defer l.gates[idx].RUnlock()
+		l.shards[idx].Set(key, value)
+		return
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	l := s.layout.Load()
+	idx := s.mapper.Map(key, len(l.shards))
+	l.shards[idx].Set(key, value)
+	if old := s.oldShard(l, key, idx); old != nil {
+		s.delMoved(old, key, moveReplace)
+	}
 }
 
 func (s *Sharded[K, V]) SetIfPresent(key K, value V) (V, bool) {
-	return s.shards[s.mapper.Map(key, s.N)].SetIfPresent(key, value)
+	if l, idx, ok := s.enter(key); ok {
+		defer l.gates[idx].RUnlock()
+		return l.shards[idx].SetIfPresent(key, value)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	l := s.layout.Load()
+	idx := s.mapper.Map(key, len(l.shards))
+	if old := s.oldShard(l, key, idx); old != nil {
+		// Key is not migrated yet, moving it to the new shard.
+		if v, err := old.Get(key); err == nil {
+			s.delMoved(old, key, moveReplace)
+			l.shards[idx].Set(key, value)
+			return v, true
+		}
+	}
+
+	return l.shards[idx].SetIfPresent(key, value)
 }
 
 func (s *Sharded[K, V]) SetIfAbsent(key K, value V) (V, bool) {
-	return s.shards[s.mapper.Map(key, s.N)].SetIfAbsent(key, value)
+	if l, idx, ok := s.enter(key); ok {
+		defer l.gates[idx].RUnlock()
+		return l.shards[idx].SetIfAbsent(key, value)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	l := s.layout.Load()
+	idx := s.mapper.Map(key, len(l.shards))
+	if old := s.oldShard(l, key, idx); old != nil {
+		if v, err := old.Get(key); err == nil {
+			return v, false
+		}
+	}
+
+	return l.shards[idx].SetIfAbsent(key, value)
 }
 
 // Get value by key from the underlying sharded cache.
 func (s *Sharded[K, V]) Get(key K) (V, error) {
-	return s.shards[s.mapper.Map(key, s.N)].Get(key)
+	if l, idx, ok := s.enter(key); ok {
+		defer l.gates[idx].RUnlock()
+		return l.shards[idx].Get(key)
+	}
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	l := s.layout.Load()
+	idx := s.mapper.Map(key, len(l.shards))
+	v, err := l.shards[idx].Get(key)
+	if err != nil {
+		if old := s.oldShard(l, key, idx); old != nil {
+			return old.Get(key)
+		}
+	}
+
+	return v, err
 }
 
 // Del key from the underlying sharded cache.
 func (s *Sharded[K, V]) Del(key K) error {
-	return s.shards[s.mapper.Map(key, s.N)].Del(key)
+	if l, idx, ok := s.enter(key); ok {
+		defer l.gates[idx].RUnlock()
+		return l.shards[idx].Del(key)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	l := s.layout.Load()
+	idx := s.mapper.Map(key, len(l.shards))
+	var oldErr error
+	if old := s.oldShard(l, key, idx); old != nil {
+		oldErr = old.Del(key)
+	}
+
+	return errors.Join(oldErr, l.shards[idx].Del(key))
+}
+
+// OnRemove adds a callback function to every shard that implements
+// RemovalNotifier, including shards created later by Resize.
+// Records moved to another shard by Resize are not reported, and records
+// moved by write operations during resharding are reported as replaced.
+func (s *Sharded[K, V]) OnRemove(f func(key K, value V, cause RemovalCause)) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.onRemove = append(s.onRemove, f)
+	for _, shard := range s.layout.Load().allShards() {
+		s.listen(shard, f)
+	}
+}
+
+// listen adds the removal listener to the shard.
+func (s *Sharded[K, V]) listen(shard Geche[K, V], f func(key K, value V, cause RemovalCause)) {
+	n, ok := shard.(RemovalNotifier[K, V])
+	if !ok {
+		return
+	}
+
+	n.OnRemove(func(key K, value V, cause RemovalCause) {
+		if cause == RemovalDeleted {
+			switch s.moving.Load() {
+			case moveMigrate:
+				return
+			case moveReplace:
+				cause = RemovalReplaced
+			}
+		}
+		f(key, value, cause)
+	})
+}
+
+// delMoved deletes the key moved to the new layout from the old shard.
+// Caller must hold the write lock.
+func (s *Sharded[K, V]) delMoved(shard Geche[K, V], key K, move int32) {
+	s.moving.Store(move)
+	_ = shard.Del(key)
+	s.moving.Store(0)
+}
+
+// allShards returns all distinct shard instances of both old and new layouts.
+func (l *shardLayout[K, V]) allShards() []Geche[K, V] {
+	if len(l.old) <= len(l.shards) {
+		return l.shards
+	}
+
+	// Shrinking: old layout has extra shards that are not drained yet.
+	return append(l.shards[:len(l.shards):len(l.shards)], l.old[len(l.shards):]...)
+}
+
+// SetConsistent enables or disables consistent mode.
+// By default Snapshot, Len, Clear and All process shards one by one (or in parallel),
+// while other goroutines can modify the shards that were already processed,
+// so the result is not a point-in-time view of the whole cache.
+// In consistent mode these operations freeze all shards (block all other
+// operations on the Sharded cache) for their whole duration.
+// Only operations made through the Sharded wrapper are blocked.
+func (s *Sharded[K, V]) SetConsistent(consistent bool) {
+	s.consistent.Store(consistent)
+}
+
+// lockAll acquires the lock for whole-cache operation.
+// Returns the layout to work with and a function that releases the lock.
+func (s *Sharded[K, V]) lockAll() (*shardLayout[K, V], func()) {
+	if !s.consistent.Load() {
+		s.mux.RLock()
+		return s.layout.Load(), s.mux.RUnlock
+	}
+
+	s.mux.Lock()
+	l := s.layout.Load()
+	for i := range l.gates {
+		l.gates[i].Lock()
+	}
+
+	return l, func() {
+		for i := range l.gates {
+			l.gates[i].Unlock()
+		}
+		s.mux.Unlock()
+	}
 }
 
 // Snapshot returns a shallow copy of the cache data.
-// Sequentially locks each of she undelnying shards
-// from modification for the duration of the copy.
+// The copy is pre-sized to the total number of records and is filled
+// directly from each shard's iterator (see All), shard by shard. Each of the
+// underlying shards is locked from modification for the duration of its copy.
+// In consistent mode (see SetConsistent) all shards are frozen
+// for the whole duration of the Snapshot.
 func (s *Sharded[K, V]) Snapshot() map[K]V {
-	snapshot := make(map[K]V)
-	for _, shard := range s.shards {
-		for k, v := range shard.Snapshot() {
+	l, unlock := s.lockAll()
+	defer unlock()
+
+	shards := l.allShards()
+	total := 0
+	for _, shard := range shards {
+		total += shard.Len()
+	}
+
+	snapshot := make(map[K]V, total)
+	for _, shard := range shards {
+		for k, v := range all(shard) {
 			snapshot[k] = v
 		}
 	}
@@ -107,6 +394,41 @@ func (s *Sharded[K, V]) Snapshot() map[K]V {
 	return snapshot
 }
 
+// All is a (read-only) iterator over all key-value pairs in the cache.
+// It yields shard by shard without copying the whole cache. Shards that
+// implement Iterable are iterated directly, other shards are
+// iterated over their Snapshot.
+// Attempt to modify the cache (Set/Del, etc.) while iterating will lead to
+// a deadlock. In consistent mode (see SetConsistent) all shards are frozen
+// for the whole iteration, so any operation on the cache inside the loop,
+// including Get, will lead to a deadlock too.
+func (s *Sharded[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		l, unlock := s.lockAll()
+		defer unlock()
+
+		for _, shard := range l.allShards() {
+			for k, v := range all(shard) {
+				if !yield(k, v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Keys is a (read-only) iterator over all keys in the cache.
+// Same locking rules as for All apply.
+func (s *Sharded[K, V]) Keys() iter.Seq[K] {
+	return keysOf(s.All())
+}
+
+// Values is a (read-only) iterator over all values in the cache.
+// Same locking rules as for All apply.
+func (s *Sharded[K, V]) Values() iter.Seq[V] {
+	return valuesOf(s.All())
+}
+
 // defaultShardNumber returns recommended number of shards for current CPU.
 // It is computed as nearest power of two that is equal or greater than
 // number of available CPU cores.
@@ -115,18 +437,118 @@ func defaultShardNumber() int {
 }
 
 // Len returns total number of elements in the underlying sharded caches.
+// It is a point-in-time value only in consistent mode (see SetConsistent).
 func (s *Sharded[K, V]) Len() int {
-	var l int
-	for _, shard := range s.shards {
-		l += shard.Len()
+	l, unlock := s.lockAll()
+	defer unlock()
+
+	var n int
+	for _, shard := range l.allShards() {
+		n += shard.Len()
 	}
 
-	return l
+	return n
 }
 
 // Clear removes all elements from all underlying shards.
+// Shards are cleared in parallel. In consistent mode (see SetConsistent)
+// no other operation can be performed until all shards are cleared.
 func (s *Sharded[K, V]) Clear() {
-	for _, shard := range s.shards {
-		shard.Clear()
+	l, unlock := s.lockAll()
+	defer unlock()
+
+	wg := sync.WaitGroup{}
+	for _, shard := range l.allShards() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shard.Clear()
+		}()
+	}
+	wg.Wait()
+}
+
+// NumShards returns current number of shards.
+func (s *Sharded[K, V]) NumShards() int {
+	return len(s.layout.Load().shards)
+}
+
+// Resize changes the number of shards to newN (or to the default number
+// of shards if newN is not positive) without downtime.
+// Shards that exist in both layouts are reused and new ones are created
+// with shardFactory. Then keys that are mapped to a different shard in the new
+// layout are migrated in small batches, so other operations keep working
+// while migration is in progress. Until migration is finished, Get looks for
+// the key in both layouts and write operations are serialized. Otherwise
+// operations do not take any lock besides the one of the key's shard.
+// Resize blocks until migration is finished, run it in a separate goroutine
+// if that is not desired. Concurrent Resize calls are serialized.
+// Use consistent hashing mapper (JumpHashMapper) to minimize number of
+// migrated keys. Migrated records are Set in the new shard, so
+// their TTL or position in the eviction order is reset.
+func (s *Sharded[K, V]) Resize(newN int) {
+	if newN <= 0 {
+		newN = defaultShardNumber()
+	}
+
+	s.resizeMux.Lock()
+	defer s.resizeMux.Unlock()
+
+	s.mux.Lock()
+	prev := s.layout.Load()
+	if newN == len(prev.shards) {
+		s.mux.Unlock()
+		return
+	}
+
+	old := prev.shards
+	shards := make([]Geche[K, V], newN)
+	copy(shards, old)
+	for i := len(old); i < newN; i++ {
+		shards[i] = s.shardFactory()
+		for _, f := range s.onRemove {
+			s.listen(shards[i], f)
+		}
+	}
+	s.layout.Store(&shardLayout[K, V]{shards: shards, old: old})
+	s.mux.Unlock()
+
+	// Operations that loaded the previous layout may still be working
+	// with its shards, keys are moved after they finish.
+	prev.drain()
+
+	for oldIdx, shard := range old {
+		keys := make([]K, 0, shard.Len())
+		for k := range shard.Snapshot() {
+			keys = append(keys, k)
+		}
+
+		for len(keys) > 0 {
+			batch := keys[:min(reshardBatchSize, len(keys))]
+			keys = keys[len(batch):]
+
+			s.mux.Lock()
+			for _, key := range batch {
+				idx := s.mapper.Map(key, newN)
+				if idx == oldIdx {
+					continue
+				}
+
+				// Key could be modified or deleted after snapshot was taken,
+				// so we use its current value.
+				v, err := shard.Get(key)
+				if err != nil {
+					continue
+				}
+
+				s.delMoved(shard, key, moveMigrate)
+				shards[idx].Set(key, v)
+			}
+			s.mux.Unlock()
+		}
 	}
+
+	s.mux.Lock()
+	s.layout.Store(newShardLayout(shards))
+	s.mux.Unlock()
 }
@@ -1,6 +1,7 @@
 package geche
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"sync"
@@ -102,7 +103,368 @@ func TestSharded(t *testing.T) {
 		}
 	}
 
-	if len(c.shards) != 4 {
-		t.Errorf("expected number of shards to be 4 but got %d", len(c.shards))
+	if c.NumShards() != 4 {
+		t.Errorf("expected number of shards to be 4 but got %d", c.NumShards())
+	}
+}
+
+func TestShardedResize(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		mapper Mapper[int]
+		from   int
+		to     int
+	}{
+		{"GrowNumberMapper", &NumberMapper[int]{}, 4, 7},
+		{"ShrinkNumberMapper", &NumberMapper[int]{}, 7, 4},
+		{"GrowJumpHash", NewJumpHashMapper[int](), 8, 16},
+		{"ShrinkJumpHash", NewJumpHashMapper[int](), 16, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewSharded(
+				func() Geche[int, string] { return NewMapCache[int, string]() },
+				tc.from,
+				tc.mapper,
+			)
+
+			for i := 0; i < 10000; i++ {
+				c.Set(i, strconv.Itoa(i))
+			}
+
+			c.Resize(tc.to)
+
+			shards := c.layout.Load().shards
+			if c.NumShards() != tc.to || len(shards) != tc.to {
+				t.Fatalf("expected %d shards, got %d", tc.to, len(shards))
+			}
+
+			if c.Len() != 10000 {
+				t.Fatalf("expected length 10000, got %d", c.Len())
+			}
+
+			for i := 0; i < 10000; i++ {
+				v, err := c.Get(i)
+				if err != nil {
+					t.Fatalf("unexpected error in Get(%d): %v", i, err)
+				}
+				if v != strconv.Itoa(i) {
+					t.Fatalf("key %d with unexpected value %q", i, v)
+				}
+			}
+
+			// Every key should be in the shard it is mapped to.
+			for i, shard := range shards {
+				for k := range shard.Snapshot() {
+					if idx := tc.mapper.Map(k, tc.to); idx != i {
+						t.Fatalf("key %d found in shard %d, expected %d", k, i, idx)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestJumpHashMapperMovesFewKeys(t *testing.T) {
+	m := NewJumpHashMapper[int]()
+	moved := 0
+	for i := 0; i < 100000; i++ {
+		if m.Map(i, 9) != m.Map(i, 10) {
+			moved++
+		}
+	}
+
+	// Expected fraction is 1/10.
+	if moved < 9000 || moved > 11000 {
+		t.Errorf("expected ~10000 keys to move, got %d", moved)
+	}
+}
+
+// startMigration emulates the state of Resize to n shards before any key
+// was moved, creating new shards with the factory. Returns the new shards.
+func startMigration[K comparable, V any](c *Sharded[K, V], n int, factory func() Geche[K, V]) []Geche[K, V] {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	old := c.layout.Load().shards
+	shards := append(old[:len(old):len(old)], make([]Geche[K, V], n-len(old))...)
+	for i := len(old); i < n; i++ {
+		shards[i] = factory()
+	}
+	c.layout.Store(&shardLayout[K, V]{shards: shards, old: old})
+
+	return shards
+}
+
+func TestShardedResizeDuringMigration(t *testing.T) {
+	c := NewSharded(
+		func() Geche[int, string] { return NewMapCache[int, string]() },
+		2,
+		&NumberMapper[int]{},
+	)
+
+	for i := 0; i < 100; i++ {
+		c.Set(i, strconv.Itoa(i))
+	}
+
+	// Emulate state in the middle of migration from 2 to 4 shards
+	// before any key was moved.
+	shards := startMigration(c, 4, func() Geche[int, string] { return NewMapCache[int, string]() })
+
+	if v, err := c.Get(3); err != nil || v != "3" {
+		t.Fatalf("expected to find not migrated key in old layout, got %q, %v", v, err)
+	}
+
+	if old, ok := c.SetIfPresent(3, "three"); !ok || old != "3" {
+		t.Fatalf("expected SetIfPresent to find not migrated key, got %q, %v", old, ok)
+	}
+
+	if v, err := shards[3].Get(3); err != nil || v != "three" {
+		t.Fatalf("expected SetIfPresent to move key to the new shard, got %q, %v", v, err)
+	}
+
+	if _, err := shards[1].Get(3); err != ErrNotFound {
+		t.Fatalf("expected key to be removed from the old shard, got %v", err)
+	}
+
+	if old, ok := c.SetIfAbsent(5, "five"); ok || old != "5" {
+		t.Fatalf("expected SetIfAbsent to find not migrated key, got %q, %v", old, ok)
+	}
+
+	c.Set(7, "seven")
+	if _, err := shards[1].Get(7); err != ErrNotFound {
+		t.Fatalf("expected Set to remove key from the old shard, got %v", err)
+	}
+
+	if err := c.Del(9); err != nil {
+		t.Fatalf("unexpected error in Del: %v", err)
+	}
+	if _, err := c.Get(9); err != ErrNotFound {
+		t.Fatalf("expected key to be deleted, got %v", err)
+	}
+
+	if c.Len() != 99 {
+		t.Fatalf("expected length 99, got %d", c.Len())
+	}
+
+	if len(c.Snapshot()) != 99 {
+		t.Fatalf("expected snapshot length 99, got %d", len(c.Snapshot()))
+	}
+}
+
+// failingDelCache is a cache which Del always fails.
+type failingDelCache[K comparable, V any] struct {
+	*MapCache[K, V]
+}
+
+func (c failingDelCache[K, V]) Del(K) error {
+	return errors.New("del failed")
+}
+
+func TestShardedDelDuringMigrationError(t *testing.T) {
+	c := NewSharded(
+		func() Geche[int, string] { return failingDelCache[int, string]{NewMapCache[int, string]()} },
+		2,
+		&NumberMapper[int]{},
+	)
+	c.Set(2, "old")
+
+	shards := startMigration(c, 4, func() Geche[int, string] { return NewMapCache[int, string]() })
+	shards[2].Set(2, "new")
+
+	if err := c.Del(2); err == nil {
+		t.Error("expected error of the old shard to be returned")
+	}
+	if _, err := shards[2].Get(2); err != ErrNotFound {
+		t.Errorf("expected key to be deleted from the new shard, got %v", err)
+	}
+}
+
+func TestShardedResizeConcurrent(t *testing.T) {
+	c := NewSharded(
+		func() Geche[int, int] { return NewMapCache[int, int]() },
+		2,
+		NewJumpHashMapper[int](),
+	)
+
+	const (
+		numWorkers = 8
+		numKeys    = 2000
+	)
+
+	// Stable keys are never modified and must always be found.
+	for i := 0; i < numKeys; i++ {
+		c.Set(-i-1, i)
+	}
+
+	done := make(chan struct{})
+	resized := make(chan struct{})
+	go func() {
+		defer close(resized)
+		for _, n := range []int{5, 16, 3, 8} {
+			c.Resize(n)
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	golden := make([]map[int]int, numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		golden[w] = make(map[int]int)
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				// Each worker owns its own key range.
+				key := w*numKeys + i%numKeys
+				switch i % 3 {
+				case 0, 1:
+					c.Set(key, i)
+					golden[w][key] = i
+				case 2:
+					_ = c.Del(key)
+					delete(golden[w], key)
+				}
+
+				stable := -(i % numKeys) - 1
+				if v, err := c.Get(stable); err != nil || v != i%numKeys {
+					t.Errorf("stable key %d: got %d, %v", stable, v, err)
+					return
+				}
+
+				if n := c.NumShards(); n <= 0 {
+					t.Errorf("unexpected number of shards %d", n)
+					return
+				}
+			}
+		}(w)
+	}
+
+	<-resized
+	close(done)
+	wg.Wait()
+
+	expectedLen := numKeys
+	for w := 0; w < numWorkers; w++ {
+		expectedLen += len(golden[w])
+		for k, v := range golden[w] {
+			got, err := c.Get(k)
+			if err != nil || got != v {
+				t.Fatalf("key %d: expected %d, got %d, %v", k, v, got, err)
+			}
+		}
+	}
+
+	if c.Len() != expectedLen {
+		t.Errorf("expected length %d, got %d", expectedLen, c.Len())
+	}
+}
+
+func TestShardedSnapshotAll(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		factory func() Geche[int, string]
+	}{
+		{"MapCache", func() Geche[int, string] { return NewMapCache[int, string]() }},
+		{"RingBuffer", func() Geche[int, string] { return NewRingBuffer[int, string](1000) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewSharded(tc.factory, 8, &IntegerMapper[int]{})
+			for i := 0; i < 1000; i++ {
+				c.Set(i, strconv.Itoa(i))
+			}
+
+			snap := c.Snapshot()
+			if len(snap) != 1000 {
+				t.Fatalf("expected snapshot length 1000, got %d", len(snap))
+			}
+
+			got := map[int]string{}
+			for k, v := range c.All() {
+				if _, ok := got[k]; ok {
+					t.Fatalf("key %d yielded twice", k)
+				}
+				got[k] = v
+			}
+
+			for i := 0; i < 1000; i++ {
+				if snap[i] != strconv.Itoa(i) {
+					t.Errorf("expected snapshot value %q for key %d, got %q", strconv.Itoa(i), i, snap[i])
+				}
+				if got[i] != strconv.Itoa(i) {
+					t.Errorf("expected All value %q for key %d, got %q", strconv.Itoa(i), i, got[i])
+				}
+			}
+
+			n := 0
+			for range c.All() {
+				n++
+				if n == 10 {
+					break
+				}
+			}
+			if n != 10 {
+				t.Errorf("expected iteration to stop after 10 elements, got %d", n)
+			}
+
+			c.Clear()
+			if c.Len() != 0 {
+				t.Errorf("expected length 0 after Clear, got %d", c.Len())
+			}
+		})
+	}
+}
+
+func TestShardedConsistent(t *testing.T) {
+	c := NewSharded(
+		func() Geche[int, int] { return NewMapCache[int, int]() },
+		16,
+		&IntegerMapper[int]{},
+	)
+	c.SetConsistent(true)
+
+	// Single writer sets keys in increasing order, so at any point in time
+	// the cache contains keys [0, n) without gaps. Consistent snapshot
+	// must not observe a gap.
+	const numKeys = 3000
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < numKeys; i++ {
+			c.Set(i, i)
+		}
+	}()
+
+	checkNoGaps := func(keys map[int]int) {
+		t.Helper()
+		for i := 0; i < len(keys); i++ {
+			if _, ok := keys[i]; !ok {
+				t.Fatalf("key %d is missing while %d keys are present", i, len(keys))
+			}
+		}
+	}
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+
+		checkNoGaps(c.Snapshot())
+
+		keys := map[int]int{}
+		for k, v := range c.All() {
+			keys[k] = v
+		}
+		checkNoGaps(keys)
+	}
+
+	if c.Len() != numKeys {
+		t.Errorf("expected length %d, got %d", numKeys, c.Len())
 	}
 }
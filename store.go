@@ -0,0 +1,181 @@
+package geche
+
+import (
+	"errors"
+	"iter"
+)
+
+// Store is a backing store of the cache records (e.g. a database table)
+// used by WriteThrough and WriteBehind wrappers.
+type Store[K comparable, V any] interface {
+	// Load returns the value of the key or ErrNotFound if it does not exist.
+	Load(key K) (V, error)
+	// Store writes the value of the key.
+	Store(key K, value V) error
+	// Delete deletes the key. Deleting a key that does not exist is not an error.
+	Delete(key K) error
+}
+
+// BatchStore is an optional interface of Store that writes several records
+// in one operation. WriteBehind uses it to flush coalesced writes.
+type BatchStore[K comparable, V any] interface {
+	Store[K, V]
+	// StoreBatch writes all records.
+	StoreBatch(records map[K]V) error
+	// DeleteBatch deletes all keys.
+	DeleteBatch(keys []K) error
+}
+
+// WriteThrough is a wrapper for any Geche interface implementation
+// that keeps the cache in sync with the backing store.
+// Writes are applied to the store first, and to the cache only
+// if the store write succeeded. Cache misses are loaded from the store.
+// Like Updater, it runs only one store operation per key
+// at the same time, and at most poolSize operations in total.
+type WriteThrough[K comparable, V any] struct {
+	cache Geche[K, V]
+	store Store[K, V]
+	gate  *keyGate[K]
+}
+
+// NewWriteThrough returns cache wrapped with WriteThrough.
+// Only poolSize store operations can run simultaneously.
+func NewWriteThrough[K comparable, V any](
+	cache Geche[K, V],
+	store Store[K, V],
+	poolSize int,
+) *WriteThrough[K, V] {
+	return &WriteThrough[K, V]{
+		cache: cache,
+		store: store,
+		gate:  newKeyGate[K](max(poolSize, 1)),
+	}
+}
+
+// Put writes the record to the store and then to the cache.
+// If the store write fails, the key is deleted from the cache,
+// so the next Get loads the actual value from the store.
+func (w *WriteThrough[K, V]) Put(key K, value V) error {
+	w.gate.acquire(key)
+	defer w.gate.release(key)
+
+	return w.put(key, value)
+}
+
+func (w *WriteThrough[K, V]) put(key K, value V) error {
+	if err := w.store.Store(key, value); err != nil {
+		_ = w.cache.Del(key)
+		return err
+	}
+
+	w.cache.Set(key, value)
+	return nil
+}
+
+// Set is the same as Put, but the error is ignored.
+func (w *WriteThrough[K, V]) Set(key K, value V) {
+	_ = w.Put(key, value)
+}
+
+// SetIfPresent writes the record only if the key exists
+// in the cache or in the store.
+// Returns false if the store operation failed.
+func (w *WriteThrough[K, V]) SetIfPresent(key K, value V) (V, bool) {
+	w.gate.acquire(key)
+	defer w.gate.release(key)
+
+	old, err := w.get(key)
+	if err != nil {
+		return old, false
+	}
+
+	return old, w.put(key, value) == nil
+}
+
+// SetIfAbsent writes the record only if the key does not exist
+// in the cache or in the store.
+// Returns false if the store operation failed.
+func (w *WriteThrough[K, V]) SetIfAbsent(key K, value V) (V, bool) {
+	w.gate.acquire(key)
+	defer w.gate.release(key)
+
+	old, err := w.get(key)
+	if !errors.Is(err, ErrNotFound) {
+		return old, false
+	}
+
+	return old, w.put(key, value) == nil
+}
+
+// Get returns the value from the cache. On cache miss the value is
+// loaded from the store and set to the cache. Returns the error of Load
+// (ErrNotFound if the key does not exist in the store).
+func (w *WriteThrough[K, V]) Get(key K) (V, error) {
+	if v, err := w.cache.Get(key); err == nil {
+		return v, nil
+	}
+
+	w.gate.acquire(key)
+	defer w.gate.release(key)
+
+	return w.get(key)
+}
+
+// get returns the value from the cache or loads it from the store.
+// Caller must acquire the key.
+func (w *WriteThrough[K, V]) get(key K) (V, error) {
+	// Value could be loaded by another operation while we were waiting.
+	if v, err := w.cache.Get(key); err == nil {
+		return v, nil
+	}
+
+	v, err := w.store.Load(key)
+	if err != nil {
+		return v, err
+	}
+
+	w.cache.Set(key, v)
+	return v, nil
+}
+
+// Del deletes the key from the store and from the cache.
+func (w *WriteThrough[K, V]) Del(key K) error {
+	w.gate.acquire(key)
+	defer w.gate.release(key)
+
+	err := w.store.Delete(key)
+	return errors.Join(err, w.cache.Del(key))
+}
+
+// Snapshot returns a shallow copy of the cache. The store is not read.
+func (w *WriteThrough[K, V]) Snapshot() map[K]V {
+	return w.cache.Snapshot()
+}
+
+// Len returns the number of records in the cache.
+func (w *WriteThrough[K, V]) Len() int {
+	return w.cache.Len()
+}
+
+// Clear removes all records from the cache. The store is not affected.
+func (w *WriteThrough[K, V]) Clear() {
+	w.cache.Clear()
+}
+
+// All is an iterator over all key-value pairs in the underlying cache.
+// Iteration does not read the store. Locking rules of the underlying cache apply.
+func (w *WriteThrough[K, V]) All() iter.Seq2[K, V] {
+	return all(w.cache)
+}
+
+// Keys is an iterator over all keys in the underlying cache.
+// Same rules as for All apply.
+func (w *WriteThrough[K, V]) Keys() iter.Seq[K] {
+	return keysOf(w.All())
+}
+
+// Values is an iterator over all values in the underlying cache.
+// Same rules as for All apply.
+func (w *WriteThrough[K, V]) Values() iter.Seq[V] {
+	return valuesOf(w.All())
+}
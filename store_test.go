@@ -0,0 +1,370 @@
+package geche
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testStore is an in-memory Store that counts operations and can fail them.
+type testStore struct {
+	mux      sync.Mutex
+	data     map[string]string
+	loads    atomic.Int32
+	writes   atomic.Int32
+	fail     atomic.Int32 // Number of writes to fail.
+	loadHook func(key string)
+}
+
+func newTestStore() *testStore {
+	return &testStore{data: map[string]string{}}
+}
+
+func (s *testStore) Load(key string) (string, error) {
+	s.loads.Add(1)
+	if s.loadHook != nil {
+		s.loadHook(key)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	v, ok := s.data[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return v, nil
+}
+
+func (s *testStore) failed() bool {
+	for {
+		n := s.fail.Load()
+		if n <= 0 {
+			return false
+		}
+		if s.fail.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+}
+
+func (s *testStore) Store(key, value string) error {
+	s.writes.Add(1)
+	if s.failed() {
+		return errors.New("store failed")
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.data[key] = value
+	return nil
+}
+
+func (s *testStore) Delete(key string) error {
+	s.writes.Add(1)
+	if s.failed() {
+		return errors.New("delete failed")
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.data, key)
+	return nil
+}
+
+func (s *testStore) snapshot() map[string]string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return maps.Clone(s.data)
+}
+
+// testBatchStore records sizes of batches.
+type testBatchStore struct {
+	*testStore
+	batches []int
+}
+
+func (s *testBatchStore) StoreBatch(records map[string]string) error {
+	s.batches = append(s.batches, len(records))
+	if s.failed() {
+		return errors.New("batch failed")
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	maps.Copy(s.data, records)
+	return nil
+}
+
+func (s *testBatchStore) DeleteBatch(keys []string) error {
+	s.batches = append(s.batches, len(keys))
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, key := range keys {
+		delete(s.data, key)
+	}
+	return nil
+}
+
+func ExampleNewWriteBehind() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newTestStore()
+	c := NewWriteBehind[string, string](ctx, NewMapCache[string, string](), store, WriteBehindOptions[string]{})
+	c.Set("a", "1")
+	c.Set("a", "2")
+	c.Set("b", "3")
+	_ = c.Del("b")
+
+	_ = c.Flush()
+	fmt.Println(store.snapshot(), store.writes.Load())
+	// Output: map[a:2] 2
+}
+
+func TestWriteThrough(t *testing.T) {
+	store := newTestStore()
+	store.data["stored"] = "value"
+	c := NewWriteThrough[string, string](NewMapCache[string, string](), store, 4)
+
+	c.Set("a", "1")
+	if store.data["a"] != "1" {
+		t.Errorf("expected value to be written to the store")
+	}
+
+	if v, err := c.Get("stored"); err != nil || v != "value" {
+		t.Errorf("expected value to be loaded, got %q, %v", v, err)
+	}
+	if _, err := c.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected 2 cached records, got %d", c.Len())
+	}
+
+	if _, ok := c.SetIfAbsent("stored", "x"); ok {
+		t.Error("expected SetIfAbsent to find the stored key")
+	}
+	if _, ok := c.SetIfPresent("missing", "x"); ok {
+		t.Error("expected SetIfPresent to skip missing key")
+	}
+
+	store.fail.Store(1)
+	if err := c.Put("a", "2"); err == nil {
+		t.Fatal("expected store error")
+	}
+	if v, err := c.Get("a"); err != nil || v != "1" {
+		t.Errorf("expected value from the store after failed write, got %q, %v", v, err)
+	}
+
+	if err := c.Del("a"); err != nil {
+		t.Fatalf("unexpected error in Del: %v", err)
+	}
+	if _, ok := store.data["a"]; ok {
+		t.Error("expected key to be deleted from the store")
+	}
+}
+
+func TestWriteThroughSingleLoad(t *testing.T) {
+	store := newTestStore()
+	store.data["k"] = "v"
+	store.loadHook = func(string) { time.Sleep(10 * time.Millisecond) }
+	c := NewWriteThrough[string, string](NewMapCache[string, string](), store, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.Get("k"); err != nil || v != "v" {
+				t.Errorf("unexpected value %q, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if store.loads.Load() != 1 {
+		t.Errorf("expected single load, got %d", store.loads.Load())
+	}
+}
+
+func TestWriteBehindBatch(t *testing.T) {
+	store := &testBatchStore{testStore: newTestStore()}
+	store.data["old"] = "value"
+
+	c := NewWriteBehind[string, string](t.Context(), NewMapCache[string, string](), store, WriteBehindOptions[string]{
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+	})
+	defer c.Close()
+
+	_ = c.Del("old")
+	if _, err := c.Get("old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected queued deletion to hide the stored key, got %v", err)
+	}
+
+	for i := 0; i < 9; i++ {
+		c.Set(strconv.Itoa(i), "v")
+	}
+
+	// Batch is full, so it is flushed without waiting for the interval.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(store.snapshot()) != 9 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected batch to be flushed, got %v", store.snapshot())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	c.Set("last", "v")
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected error in Close: %v", err)
+	}
+	if _, ok := store.snapshot()["last"]; !ok {
+		t.Error("expected Close to flush queued writes")
+	}
+	if !slices.Equal(store.batches, []int{9, 1, 1}) {
+		t.Errorf("expected writes to be batched, got batches %v", store.batches)
+	}
+}
+
+func TestWriteBehindLoadSustainedWrites(t *testing.T) {
+	store := newTestStore()
+	c := NewWriteBehind[string, string](t.Context(), NewRingBuffer[string, string](1), store, WriteBehindOptions[string]{
+		FlushInterval: time.Hour,
+	})
+	defer c.Close()
+
+	// Every load is outdated by a write, which is flushed and evicted from the cache.
+	store.loadHook = func(key string) {
+		c.Set(key, strconv.Itoa(int(store.loads.Load())))
+		c.Set("other", "v")
+		_ = c.Flush()
+	}
+
+	if v, err := c.Get("k"); err != nil || v != "1" {
+		t.Errorf("expected Get to return the value written while loading, got %q, %v", v, err)
+	}
+	if n := store.loads.Load(); n != 1 {
+		t.Errorf("expected single load, got %d", n)
+	}
+}
+
+func TestWriteBehindWriteAfterClose(t *testing.T) {
+	store := newTestStore()
+	c := NewWriteBehind[string, string](t.Context(), NewMapCache[string, string](), store, WriteBehindOptions[string]{
+		FlushInterval: time.Hour,
+	})
+	if err := c.Close(); err != nil {
+		t.Fatalf("unexpected error in Close: %v", err)
+	}
+
+	c.Set("a", "1")
+	c.Set("b", "2")
+	_ = c.Del("b")
+	if !maps.Equal(store.snapshot(), map[string]string{"a": "1"}) {
+		t.Errorf("expected writes after Close to be flushed synchronously, got %v", store.snapshot())
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	c = NewWriteBehind[string, string](ctx, NewMapCache[string, string](), store, WriteBehindOptions[string]{
+		FlushInterval: time.Hour,
+	})
+	defer c.Close()
+	cancel()
+	for !c.stopped.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	c.Set("c", "3")
+	if _, ok := store.snapshot()["c"]; !ok {
+		t.Error("expected writes after ctx cancellation to be flushed synchronously")
+	}
+}
+
+func TestWriteBehindRetry(t *testing.T) {
+	store := newTestStore()
+
+	var (
+		failedKeys []string
+		failedErr  error
+	)
+	c := NewWriteBehind[string, string](t.Context(), NewMapCache[string, string](), store, WriteBehindOptions[string]{
+		FlushInterval: time.Hour,
+		MaxRetries:    2,
+		RetryDelay:    time.Millisecond,
+		OnError: func(keys []string, err error) {
+			failedKeys, failedErr = keys, err
+		},
+	})
+	defer c.Close()
+
+	store.fail.Store(2)
+	c.Set("a", "1")
+	if err := c.Flush(); err != nil {
+		t.Fatalf("expected write to succeed after retries, got %v", err)
+	}
+	if store.data["a"] != "1" {
+		t.Error("expected value to be written")
+	}
+
+	store.fail.Store(3)
+	c.Set("b", "2")
+	if err := c.Flush(); err == nil {
+		t.Fatal("expected error after all retries")
+	}
+	if !slices.Equal(failedKeys, []string{"b"}) || failedErr == nil {
+		t.Errorf("expected OnError to be called for b, got %v, %v", failedKeys, failedErr)
+	}
+	if v, _ := c.Get("b"); v != "2" {
+		t.Errorf("expected cache to keep the value, got %q", v)
+	}
+}
+
+func TestWriteBehindLoadRace(t *testing.T) {
+	store := newTestStore()
+	store.data["k"] = "old"
+
+	loading := make(chan struct{})
+	resume := make(chan struct{})
+	store.loadHook = func(string) {
+		close(loading)
+		<-resume
+	}
+
+	c := NewWriteBehind[string, string](t.Context(), NewMapCache[string, string](), store, WriteBehindOptions[string]{
+		FlushInterval: time.Hour,
+	})
+	defer c.Close()
+
+	got := make(chan string)
+	go func() {
+		v, _ := c.Get("k")
+		got <- v
+	}()
+
+	<-loading
+	c.Set("k", "new")
+	close(resume)
+
+	if v := <-got; v != "new" {
+		t.Errorf("expected Get to return the value written while loading, got %q", v)
+	}
+	if v, _ := c.cache.Get("k"); v != "new" {
+		t.Errorf("expected loaded value not to overwrite the new one, got %q", v)
+	}
+}
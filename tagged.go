@@ -0,0 +1,254 @@
+package geche
+
+import (
+	"errors"
+	"iter"
+	"slices"
+	"sync"
+)
+
+// Tagged is a wrapper for any Geche interface implementation
+// that associates records with tags (e.g. ids of entities the cached
+// value depends on) and invalidates all records of the tag at once.
+// Records written by SetWithTags keep their tags until they are overwritten,
+// deleted or evicted. Set, SetIfPresent and SetIfAbsent write records
+// without tags, removing tags of the previous value.
+type Tagged[K comparable, V any] struct {
+	cache Geche[K, V]
+	// tags maps tag to the set of its keys, and keyTags maps key to its tags.
+	tags    map[string]map[K]struct{}
+	keyTags map[K][]string
+	mux     sync.RWMutex
+	evicted evictQueue[K]
+}
+
+// NewTagged creates a new Tagged wrapper over the cache.
+// If the cache implements EvictionNotifier (e.g. MapTTLCache or RingBuffer),
+// Tagged subscribes to its evictions and removes evicted keys from the tag index.
+func NewTagged[K comparable, V any](cache Geche[K, V]) *Tagged[K, V] {
+	t := &Tagged[K, V]{
+		cache:   cache,
+		tags:    make(map[string]map[K]struct{}),
+		keyTags: make(map[K][]string),
+	}
+
+	subscribeEvict(cache, t.onEvict)
+
+	return t
+}
+
+// onEvict is called by the underlying cache when the key is evicted.
+// The tag index is pruned via the eviction queue (see evictQueue.add).
+func (t *Tagged[K, V]) onEvict(key K, _ V) {
+	t.evicted.add(key, &t.mux, t.pruneKey)
+}
+
+// pruneEvicted removes queued evicted keys from the tag index.
+// Keys that were set again after eviction are kept.
+// Should be called with the write lock held.
+func (t *Tagged[K, V]) pruneEvicted() {
+	t.evicted.drain(t.pruneKey)
+}
+
+func (t *Tagged[K, V]) pruneKey(key K) {
+	if _, err := t.cache.Get(key); errors.Is(err, ErrNotFound) {
+		t.untag(key)
+	}
+}
+
+// untag removes the key from the tag index.
+// Should be called with the write lock held.
+func (t *Tagged[K, V]) untag(key K) {
+	for _, tag := range t.keyTags[key] {
+		keys := t.tags[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(t.tags, tag)
+		}
+	}
+	delete(t.keyTags, key)
+}
+
+// tag replaces tags of the key in the tag index.
+// Should be called with the write lock held.
+func (t *Tagged[K, V]) tag(key K, tags []string) {
+	t.untag(key)
+
+	tags = slices.Compact(slices.Sorted(slices.Values(tags)))
+	if len(tags) == 0 {
+		return
+	}
+
+	for _, tag := range tags {
+		keys, ok := t.tags[tag]
+		if !ok {
+			keys = make(map[K]struct{})
+			t.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	t.keyTags[key] = tags
+}
+
+// SetWithTags sets the record and associates it with the tags.
+// Previous tags of the key are replaced.
+func (t *Tagged[K, V]) SetWithTags(key K, value V, tags ...string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.cache.Set(key, value)
+	t.tag(key, tags)
+	t.pruneEvicted()
+}
+
+// InvalidateTag deletes all records associated with the tag
+// and returns the number of deleted keys.
+// Records are deleted atomically: other operations of the wrapper
+// do not see some of them deleted and others not.
+func (t *Tagged[K, V]) InvalidateTag(tag string) (int, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	defer t.pruneEvicted()
+
+	keys := t.tags[tag]
+	n := len(keys)
+	var errs []error
+	for key := range keys {
+		errs = append(errs, t.cache.Del(key))
+		t.untag(key)
+	}
+
+	return n, errors.Join(errs...)
+}
+
+// Tags returns tags of the key, sorted.
+func (t *Tagged[K, V]) Tags(key K) []string {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+
+	return slices.Clone(t.keyTags[key])
+}
+
+// TagKeys returns keys associated with the tag in no particular order.
+func (t *Tagged[K, V]) TagKeys(tag string) []K {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+
+	keys := make([]K, 0, len(t.tags[tag]))
+	for key := range t.tags[tag] {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// Set sets the record without tags.
+func (t *Tagged[K, V]) Set(key K, value V) {
+	t.SetWithTags(key, value)
+}
+
+// SetIfPresent sets the value without tags only if the key already exists.
+func (t *Tagged[K, V]) SetIfPresent(key K, value V) (V, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	defer t.pruneEvicted()
+
+	old, ok := t.cache.SetIfPresent(key, value)
+	if ok {
+		t.untag(key)
+	}
+
+	return old, ok
+}
+
+// SetIfAbsent sets the value without tags only if the key does not exist yet.
+func (t *Tagged[K, V]) SetIfAbsent(key K, value V) (V, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	defer t.pruneEvicted()
+
+	old, ok := t.cache.SetIfAbsent(key, value)
+	if ok {
+		// Key could be expired, but not evicted yet.
+		t.untag(key)
+	}
+
+	return old, ok
+}
+
+// Get returns the value from the underlying cache.
+func (t *Tagged[K, V]) Get(key K) (V, error) {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+
+	return t.cache.Get(key)
+}
+
+// Del deletes the key and its tags.
+func (t *Tagged[K, V]) Del(key K) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	defer t.pruneEvicted()
+
+	t.untag(key)
+	return t.cache.Del(key)
+}
+
+// Snapshot returns a shallow copy of the underlying cache.
+func (t *Tagged[K, V]) Snapshot() map[K]V {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+
+	return t.cache.Snapshot()
+}
+
+// Len returns the number of records in the underlying cache.
+func (t *Tagged[K, V]) Len() int {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+
+	return t.cache.Len()
+}
+
+// Clear removes all records and tags.
+func (t *Tagged[K, V]) Clear() {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.cache.Clear()
+	clear(t.tags)
+	clear(t.keyTags)
+	t.evicted.reset()
+}
+
+// All is an iterator over all key-value pairs of the underlying cache.
+// Iterator holds read lock for the whole iteration,
+// and locking rules of the underlying cache apply.
+func (t *Tagged[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		t.mux.RLock()
+		defer t.mux.RUnlock()
+
+		for k, v := range all(t.cache) {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// Keys is an iterator over all keys of the underlying cache.
+// Same rules as for All apply.
+func (t *Tagged[K, V]) Keys() iter.Seq[K] {
+	return keysOf(t.All())
+}
+
+// Values is an iterator over all values of the underlying cache.
+// Same rules as for All apply.
+func (t *Tagged[K, V]) Values() iter.Seq[V] {
+	return valuesOf(t.All())
+}
@@ -0,0 +1,132 @@
+package geche
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func ExampleNewTagged() {
+	c := NewTagged[string, string](NewMapCache[string, string]())
+	c.SetWithTags("/products/42", "<html>...</html>", "product:42")
+	c.SetWithTags("/catalog", "<html>...</html>", "product:42", "product:43")
+	c.SetWithTags("/products/43", "<html>...</html>", "product:43")
+
+	n, _ := c.InvalidateTag("product:42")
+	fmt.Println(n, slices.Sorted(c.Keys()))
+	// Output: 2 [/products/43]
+}
+
+func TestTaggedInvalidate(t *testing.T) {
+	c := NewTagged[int, string](NewMapCache[int, string]())
+	c.SetWithTags(1, "a", "x", "y", "x")
+	c.SetWithTags(2, "b", "y")
+	c.SetWithTags(3, "c", "z")
+	c.Set(4, "d")
+
+	if tags := c.Tags(1); !slices.Equal(tags, []string{"x", "y"}) {
+		t.Errorf("expected tags [x y], got %v", tags)
+	}
+
+	n, err := c.InvalidateTag("y")
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 keys to be invalidated, got %d, %v", n, err)
+	}
+	if keys := slices.Sorted(c.Keys()); !slices.Equal(keys, []int{3, 4}) {
+		t.Errorf("expected keys [3 4], got %v", keys)
+	}
+	if len(c.tags) != 1 || len(c.keyTags) != 1 {
+		t.Errorf("expected only tag z in the index, got %v, %v", c.tags, c.keyTags)
+	}
+
+	if n, _ := c.InvalidateTag("unknown"); n != 0 {
+		t.Errorf("expected nothing to be invalidated, got %d", n)
+	}
+}
+
+func TestTaggedOverwrite(t *testing.T) {
+	c := NewTagged[string, string](NewMapCache[string, string]())
+
+	c.SetWithTags("k", "v1", "a")
+	c.SetWithTags("k", "v2", "b")
+	if keys := c.TagKeys("a"); len(keys) != 0 {
+		t.Errorf("expected old tag to be removed, got %v", keys)
+	}
+
+	c.Set("k", "v3")
+	if tags := c.Tags("k"); len(tags) != 0 {
+		t.Errorf("expected Set to remove tags, got %v", tags)
+	}
+	if n, _ := c.InvalidateTag("b"); n != 0 {
+		t.Errorf("expected record without tags to stay, got %d invalidated", n)
+	}
+
+	c.SetWithTags("k", "v4", "c")
+	if _, ok := c.SetIfPresent("k", "v5"); !ok || len(c.Tags("k")) != 0 {
+		t.Errorf("expected SetIfPresent to remove tags, got %v", c.Tags("k"))
+	}
+
+	c.SetWithTags("d", "v", "c")
+	if err := c.Del("d"); err != nil {
+		t.Fatalf("unexpected error in Del: %v", err)
+	}
+	if len(c.tags) != 0 || len(c.keyTags) != 0 {
+		t.Errorf("expected empty index, got %v, %v", c.tags, c.keyTags)
+	}
+
+	c.SetWithTags("e", "v", "c")
+	c.Clear()
+	if len(c.tags) != 0 || len(c.keyTags) != 0 || c.Len() != 0 {
+		t.Error("expected Clear to remove records and tags")
+	}
+}
+
+func TestTaggedRingBufferEviction(t *testing.T) {
+	c := NewTagged[int, int](NewRingBuffer[int, int](3))
+	for i := 0; i < 10; i++ {
+		c.SetWithTags(i, i, "all", fmt.Sprintf("t%d", i))
+	}
+
+	if keys := slices.Sorted(slices.Values(c.TagKeys("all"))); !slices.Equal(keys, []int{7, 8, 9}) {
+		t.Errorf("expected evicted keys to be removed from the tag, got %v", keys)
+	}
+	if len(c.tags) != 4 || len(c.keyTags) != 3 {
+		t.Errorf("expected index of 3 keys, got %v, %v", c.tags, c.keyTags)
+	}
+}
+
+func TestTaggedMapTTLEviction(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewMapTTLCache[string, string](ctx, time.Second, time.Hour)
+	c := NewTagged[string, string](cache)
+	ts := time.Now()
+
+	c.SetWithTags("a", "a", "tag")
+	c.SetWithTags("b", "b", "tag")
+
+	cache.mux.Lock()
+	cache.now = func() time.Time { return ts.Add(2 * time.Second) }
+	cache.mux.Unlock()
+
+	c.SetWithTags("c", "c", "tag")
+	if err := cache.cleanup(); err != nil {
+		t.Fatalf("unexpected error in cleanup: %v", err)
+	}
+
+	if keys := c.TagKeys("tag"); !slices.Equal(keys, []string{"c"}) {
+		t.Errorf("expected expired keys to be removed from the tag, got %v", keys)
+	}
+
+	n, err := c.InvalidateTag("tag")
+	if n != 1 || err != nil {
+		t.Errorf("expected 1 key to be invalidated, got %d, %v", n, err)
+	}
+	if _, err := c.Get("c"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package geche
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"maps"
+	"sync"
+)
+
+// Tiered is a two-level cache for working sets larger than memory.
+// L1 is any in-memory cache that evicts records when it is full
+// (e.g. RingBuffer), and L2 is DiskCache stored in local files.
+// Records evicted from L1 are moved (demoted) to L2, and records found
+// in L2 are moved (promoted) back to L1, so every record is stored
+// in exactly one of the levels.
+// If L1 implements RemovalNotifier, records removed by TTL expiration
+// (MapTTLCache) are dropped instead of being demoted. Otherwise every record
+// reported by OnEvict is demoted.
+type Tiered[K comparable, V any] struct {
+	l1 Geche[K, V]
+	l2 *DiskCache[K, V]
+	// mux serializes writes and moves of records between levels,
+	// so readers never see a record missing from both levels.
+	mux sync.RWMutex
+	// Records evicted from L1 that are not demoted yet.
+	evicted evictQueue[removal[K, V]]
+}
+
+// NewTiered creates DiskCache in dir (see NewDiskCache) and returns
+// it combined with l1 cache. Codec is used to serialize records on the disk.
+// Returns an error if l1 does not implement EvictionNotifier.
+func NewTiered[K comparable, V any](
+	ctx context.Context,
+	l1 Geche[K, V],
+	dir string,
+	codec Codec[K, V],
+	opts DiskCacheOptions,
+) (*Tiered[K, V], error) {
+	if _, ok := l1.(EvictionNotifier[K, V]); !ok {
+		return nil, errors.New("L1 cache does not implement EvictionNotifier")
+	}
+
+	l2, err := NewDiskCache(ctx, dir, codec, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	t := Tiered[K, V]{
+		l1: l1,
+		l2: l2,
+	}
+	if rn, ok := l1.(RemovalNotifier[K, V]); ok {
+		rn.OnRemove(func(key K, value V, cause RemovalCause) {
+			if cause == RemovalEvicted {
+				t.onEvict(key, value)
+			}
+		})
+	} else {
+		subscribeEvict(l1, t.onEvict)
+	}
+
+	return &t, nil
+}
+
+// onEvict is called when the record is evicted from L1.
+// The record is demoted via the eviction queue (see evictQueue.add).
+func (t *Tiered[K, V]) onEvict(key K, value V) {
+	t.evicted.add(removal[K, V]{key: key, value: value, cause: RemovalEvicted}, &t.mux, t.demote)
+}
+
+// demoteEvicted moves queued evicted records to L2.
+// Records that were set to L1 again after eviction are not demoted.
+// Should be called with the write lock held.
+func (t *Tiered[K, V]) demoteEvicted() {
+	t.evicted.drain(t.demote)
+}
+
+func (t *Tiered[K, V]) demote(r removal[K, V]) {
+	if _, err := t.l1.Get(r.key); errors.Is(err, ErrNotFound) {
+		t.l2.Set(r.key, r.value)
+	}
+}
+
+// lock acquires the write lock and demotes records that were evicted
+// while it was held, before they can be affected by the operation.
+func (t *Tiered[K, V]) lock() {
+	t.mux.Lock()
+	t.demoteEvicted()
+}
+
+// unlock demotes records evicted by the operation and releases the write lock.
+func (t *Tiered[K, V]) unlock() {
+	t.demoteEvicted()
+	t.mux.Unlock()
+}
+
+// Set writes the record to L1 and removes the old record from L2.
+func (t *Tiered[K, V]) Set(key K, value V) {
+	t.lock()
+	defer t.unlock()
+
+	_ = t.l2.Del(key)
+	t.l1.Set(key, value)
+}
+
+// SetIfPresent sets the value only if the key already exists in any level.
+// Record found in L2 is moved to L1.
+func (t *Tiered[K, V]) SetIfPresent(key K, value V) (V, bool) {
+	t.lock()
+	defer t.unlock()
+
+	if old, ok := t.l1.SetIfPresent(key, value); ok {
+		return old, true
+	}
+
+	old, err := t.l2.Get(key)
+	if err != nil {
+		return old, false
+	}
+
+	_ = t.l2.Del(key)
+	t.l1.Set(key, value)
+
+	return old, true
+}
+
+// SetIfAbsent sets the value to L1 only if the key does not exist in any level.
+func (t *Tiered[K, V]) SetIfAbsent(key K, value V) (V, bool) {
+	t.lock()
+	defer t.unlock()
+
+	if old, err := t.l1.Get(key); err == nil {
+		return old, false
+	}
+	if old, err := t.l2.Get(key); err == nil {
+		return old, false
+	}
+
+	return t.l1.SetIfAbsent(key, value)
+}
+
+// Get returns the value from L1. If the key is not found there,
+// it is read from L2 and promoted to L1.
+// Misses of L1 are serialized, so L2 lookups do not run in parallel.
+func (t *Tiered[K, V]) Get(key K) (V, error) {
+	if v, err := t.l1.Get(key); err == nil {
+		return v, nil
+	}
+
+	t.lock()
+	defer t.unlock()
+
+	// Record could be promoted or demoted while we were waiting for the lock.
+	if v, err := t.l1.Get(key); err == nil {
+		return v, nil
+	}
+
+	v, err := t.l2.Get(key)
+	if err != nil {
+		return v, err
+	}
+
+	_ = t.l2.Del(key)
+	t.l1.Set(key, v)
+
+	return v, nil
+}
+
+// Del removes the key from both levels.
+func (t *Tiered[K, V]) Del(key K) error {
+	t.lock()
+	defer t.unlock()
+
+	return errors.Join(t.l1.Del(key), t.l2.Del(key))
+}
+
+// Snapshot returns a shallow copy of records of both levels.
+// L2 records are read from the disk, so it is a slow operation.
+func (t *Tiered[K, V]) Snapshot() map[K]V {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+
+	s := t.l2.Snapshot()
+	maps.Copy(s, t.l1.Snapshot())
+
+	return s
+}
+
+// Len returns the total number of records in both levels.
+func (t *Tiered[K, V]) Len() int {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+
+	return t.l1.Len() + t.l2.Len()
+}
+
+// Clear removes all records from both levels.
+func (t *Tiered[K, V]) Clear() {
+	t.lock()
+	defer t.unlock()
+
+	t.l1.Clear()
+	t.l2.Clear()
+}
+
+// All is an iterator over all key-value pairs of L1 and then L2.
+// Records are not promoted while iterating.
+// Iterator holds read lock for the whole iteration.
+func (t *Tiered[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		t.mux.RLock()
+		defer t.mux.RUnlock()
+
+		for k, v := range all(t.l1) {
+			if !yield(k, v) {
+				return
+			}
+		}
+		for k, v := range t.l2.All() {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// Keys is an iterator over all keys of both levels.
+// Same rules as for All apply.
+func (t *Tiered[K, V]) Keys() iter.Seq[K] {
+	return keysOf(t.All())
+}
+
+// Values is an iterator over all values of both levels.
+// Same rules as for All apply.
+func (t *Tiered[K, V]) Values() iter.Seq[V] {
+	return valuesOf(t.All())
+}
+
+// Err returns the error that stopped writing to L2, if any.
+func (t *Tiered[K, V]) Err() error {
+	return t.l2.Err()
+}
+
+// Close removes L2 files. Records evicted from L1 after Close are lost.
+func (t *Tiered[K, V]) Close() error {
+	t.lock()
+	defer t.unlock()
+
+	return t.l2.Close()
+}
@@ -0,0 +1,181 @@
+package geche
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func ExampleNewTiered() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, _ := os.MkdirTemp("", "geche")
+	defer os.RemoveAll(dir)
+
+	c, err := NewTiered(ctx, NewRingBuffer[string, int](2), dir, NewBinaryCodec[string, int](), DiskCacheOptions{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer c.Close()
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3) // "a" is moved to the disk.
+
+	v, _ := c.Get("a") // "a" is moved back to memory, and "b" to the disk.
+	fmt.Println(v, c.Len())
+	// Output: 1 3
+}
+
+func newTestTiered(t *testing.T, size int, opts DiskCacheOptions) *Tiered[string, string] {
+	t.Helper()
+
+	c, err := NewTiered(t.Context(), NewRingBuffer[string, string](size), t.TempDir(), NewBinaryCodec[string, string](), opts)
+	if err != nil {
+		t.Fatalf("unexpected error in NewTiered: %v", err)
+	}
+
+	return c
+}
+
+func TestTieredDemotePromote(t *testing.T) {
+	c := newTestTiered(t, 3, DiskCacheOptions{})
+
+	for i := 0; i < 10; i++ {
+		s := strconv.Itoa(i)
+		c.Set(s, "v"+s)
+	}
+	if c.l1.Len() != 3 || c.l2.Len() != 7 {
+		t.Fatalf("expected 3 records in L1 and 7 in L2, got %d and %d", c.l1.Len(), c.l2.Len())
+	}
+
+	if v, err := c.Get("0"); err != nil || v != "v0" {
+		t.Fatalf("unexpected value %q, %v", v, err)
+	}
+	if _, err := c.l1.Get("0"); err != nil {
+		t.Error("expected record to be promoted to L1")
+	}
+	if _, err := c.l2.Get("0"); err == nil {
+		t.Error("expected promoted record to be removed from L2")
+	}
+	if _, err := c.l2.Get("7"); err != nil {
+		t.Error("expected oldest L1 record to be demoted to L2")
+	}
+
+	// Overwriting the record stored in L2.
+	c.Set("1", "new")
+	if c.Len() != 10 {
+		t.Errorf("expected 10 records, got %d", c.Len())
+	}
+	if v, _ := c.Get("1"); v != "new" {
+		t.Errorf("expected new value, got %q", v)
+	}
+
+	if old, ok := c.SetIfPresent("2", "present"); !ok || old != "v2" {
+		t.Errorf("expected SetIfPresent to update L2 record, got %q, %v", old, ok)
+	}
+	if old, ok := c.SetIfAbsent("3", "absent"); ok || old != "v3" {
+		t.Errorf("expected SetIfAbsent to find L2 record, got %q, %v", old, ok)
+	}
+
+	if _, err := NewTiered(t.Context(), NewMapCache[string, string](), t.TempDir(), NewBinaryCodec[string, string](), DiskCacheOptions{}); err == nil {
+		t.Error("expected NewTiered to fail for L1 without OnEvict")
+	}
+}
+
+func TestTieredModel(t *testing.T) {
+	c := newTestTiered(t, 10, DiskCacheOptions{SegmentSize: 512, GCInterval: -1})
+	model := map[string]string{}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		k := strconv.Itoa(r.Intn(50))
+		switch r.Intn(5) {
+		case 0:
+			_ = c.Del(k)
+			delete(model, k)
+		case 1:
+			v, err := c.Get(k)
+			if mv, ok := model[k]; ok != (err == nil) || v != mv {
+				t.Fatalf("step %d: expected %q, %v for key %q, got %q, %v", i, mv, ok, k, v, err)
+			}
+		default:
+			v := strconv.Itoa(i)
+			c.Set(k, v)
+			model[k] = v
+		}
+		if i%500 == 0 {
+			if err := c.l2.GC(); err != nil {
+				t.Fatalf("unexpected error in GC: %v", err)
+			}
+		}
+	}
+
+	if !maps.Equal(model, c.Snapshot()) {
+		t.Errorf("expected %v, got %v", model, c.Snapshot())
+	}
+	if c.Len() != len(model) {
+		t.Errorf("expected %d records, got %d", len(model), c.Len())
+	}
+}
+
+func TestTieredConcurrent(t *testing.T) {
+	c := newTestTiered(t, 20, DiskCacheOptions{SegmentSize: 1024, GCInterval: -1})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := fmt.Sprintf("w%d:%d", w, i%50)
+				c.Set(k, k)
+				if v, err := c.Get(k); err != nil || v != k {
+					t.Errorf("unexpected value %q, %v", v, err)
+					return
+				}
+				if i%100 == 0 {
+					_ = c.l2.GC()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.Len() != 200 {
+		t.Errorf("expected 200 records, got %d", c.Len())
+	}
+}
+
+func TestTieredDropsExpired(t *testing.T) {
+	l1 := NewMapTTLCache[string, string](t.Context(), time.Second, time.Hour)
+	c, err := NewTiered[string, string](t.Context(), l1, t.TempDir(), NewBinaryCodec[string, string](), DiskCacheOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error in NewTiered: %v", err)
+	}
+
+	c.Set("a", "1")
+	ts := time.Now()
+	l1.mux.Lock()
+	l1.now = func() time.Time { return ts.Add(2 * time.Second) }
+	l1.mux.Unlock()
+	if err := l1.cleanup(); err != nil {
+		t.Fatalf("unexpected error in cleanup: %v", err)
+	}
+
+	if c.l2.Len() != 0 {
+		t.Errorf("expected expired record not to be demoted, got %d records in L2", c.l2.Len())
+	}
+	if _, err := c.Get("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected expired record to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,308 @@
+package geche
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+// RangeOptions modify bounds and direction of the range iteration.
+// By default range is half-open: lower bound is included and upper bound is not.
+type RangeOptions struct {
+	// FromExclusive excludes the lower bound key from the range.
+	FromExclusive bool
+	// ToInclusive includes the upper bound key in the range.
+	ToInclusive bool
+	// Descending makes iteration go from the upper bound down to the lower bound.
+	Descending bool
+}
+
+// keyRange describes the range of keys for ordered trie traversal.
+type keyRange struct {
+	from  string
+	to    string
+	hasTo bool
+	RangeOptions
+}
+
+// trieWalkNode is implemented by nodes of both trie implementations (KV and KVCache),
+// so they can share the ordered traversal code.
+type trieWalkNode[N any] interface {
+	// segment returns the path segment of the node.
+	segment() string
+	isTerminal() bool
+	// appendChildren appends node children to dst in ascending order.
+	appendChildren(dst []N) []N
+	// child returns the child which segment starts with c.
+	child(c byte) (N, bool)
+}
+
+func (n *trieNode) segment() string {
+	return unsafe.String(unsafe.SliceData(n.b), len(n.b))
+}
+
+func (n *trieNode) isTerminal() bool {
+	return n.terminal
+}
+
+func (n *trieNode) appendChildren(dst []*trieNode) []*trieNode {
+	for c := n.nextLevelHead; c != nil; c = c.next {
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+func (n *trieNode) child(c byte) (*trieNode, bool) {
+	next := n.down[c]
+	return next, next != nil
+}
+
+func (n *trieCacheNode[K]) segment() string {
+	return keyToString(n.b)
+}
+
+func (n *trieCacheNode[K]) isTerminal() bool {
+	return n.terminal
+}
+
+func (n *trieCacheNode[K]) appendChildren(dst []*trieCacheNode[K]) []*trieCacheNode[K] {
+	for i := range n.children {
+		dst = append(dst, &n.children[i])
+	}
+	return dst
+}
+
+// boundCmp compares keys of the subtree starting with path against the bound.
+// Returns -1 if all keys of the subtree are less than bound,
+// 1 if all of them are greater than bound, and 0 if path is a prefix of bound
+// (so the subtree can contain keys on both sides of the bound).
+func boundCmp(path []byte, bound string) int {
+	n := min(len(path), len(bound))
+	for i := 0; i < n; i++ {
+		if path[i] != bound[i] {
+			if path[i] < bound[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	if len(path) > len(bound) {
+		return 1
+	}
+
+	return 0
+}
+
+// walkRange traverses the trie starting from the root in key order (or in reverse order),
+// calling fn with the key of every terminal node that is within the range.
+// Subtrees that are out of range are not visited.
+// Path slice is reused, so fn should copy it if it needs to keep it.
+// Stops as soon as fn returns false.
+func walkRange[N trieWalkNode[N]](root N, r keyRange, fn func(path []byte, node N) bool) {
+	type stackEntry struct {
+		node    N
+		pathLen int
+		// Whether bounds should still be checked for the node.
+		// Bound check is not needed when parent is strictly within the bound.
+		checkFrom bool
+		checkTo   bool
+		// post is set for descending order entries that are visited
+		// after all the children of the node were visited.
+		post bool
+	}
+
+	path := make([]byte, 0, maxKeyLength)
+	stack := make([]stackEntry, 0, 64)
+	stack = append(stack, stackEntry{node: root, checkFrom: true, checkTo: r.hasTo})
+
+	var children []N
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		path = append(path[:e.pathLen], e.node.segment()...)
+
+		if e.post {
+			if !fn(path, e.node) {
+				return
+			}
+			continue
+		}
+
+		emit := e.node.isTerminal()
+		descend := true
+		checkFrom, checkTo := e.checkFrom, e.checkTo
+
+		if checkFrom {
+			switch boundCmp(path, r.from) {
+			case -1:
+				if r.Descending {
+					// Everything that is left is less than the lower bound.
+					return
+				}
+				continue
+			case 1:
+				checkFrom = false
+			case 0:
+				if len(path) == len(r.from) {
+					emit = emit && !r.FromExclusive
+					// All descendants are greater than the lower bound.
+					checkFrom = false
+				} else {
+					emit = false
+				}
+			}
+		}
+
+		if checkTo {
+			switch boundCmp(path, r.to) {
+			case 1:
+				if !r.Descending {
+					// Everything that is left is greater than the upper bound.
+					return
+				}
+				continue
+			case -1:
+				checkTo = false
+			case 0:
+				if len(path) == len(r.to) {
+					emit = emit && r.ToInclusive
+					// All descendants are greater than the upper bound.
+					descend = false
+				}
+			}
+		}
+
+		if r.Descending {
+			if emit {
+				e.post = true
+				stack = append(stack, e)
+			}
+			if descend {
+				children = e.node.appendChildren(children[:0])
+				for _, child := range children {
+					stack = append(stack, stackEntry{
+						node:      child,
+						pathLen:   len(path),
+						checkFrom: checkFrom,
+						checkTo:   checkTo,
+					})
+				}
+			}
+			continue
+		}
+
+		if emit {
+			if !fn(path, e.node) {
+				return
+			}
+		}
+
+		if !descend {
+			// Node is equal to the upper bound, nothing greater can be in range.
+			return
+		}
+
+		children = e.node.appendChildren(children[:0])
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, stackEntry{
+				node:      children[i],
+				pathLen:   len(path),
+				checkFrom: checkFrom,
+				checkTo:   checkTo,
+			})
+		}
+	}
+}
+
+// walkChildren traverses the subtree of keys starting with prefix in key order.
+// Terminal nodes are passed to onKey. When the part of the path after prefix
+// contains delimiter, the whole subtree is collapsed into a single onPrefix call
+// with the path up to and including the delimiter, and is not traversed any further.
+func walkChildren[N trieWalkNode[N]](
+	root N,
+	prefix, delimiter string,
+	onKey func(key []byte, node N),
+	onPrefix func(p []byte, node N),
+) {
+	type stackEntry struct {
+		node    N
+		pathLen int
+	}
+
+	delim := []byte(delimiter)
+	path := make([]byte, 0, max(len(prefix), maxKeyLength))
+	stack := make([]stackEntry, 0, 64)
+	stack = append(stack, stackEntry{node: root})
+
+	var children []N
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		path = append(path[:e.pathLen], e.node.segment()...)
+
+		if len(path) < len(prefix) {
+			if boundCmp(path, prefix) != 0 {
+				continue
+			}
+		} else {
+			if string(path[:len(prefix)]) != prefix {
+				continue
+			}
+
+			if len(delim) > 0 {
+				if i := bytes.Index(path[len(prefix):], delim); i >= 0 {
+					onPrefix(path[:len(prefix)+i+len(delim)], e.node)
+					continue
+				}
+			}
+
+			if e.node.isTerminal() {
+				onKey(path, e.node)
+			}
+		}
+
+		children = e.node.appendChildren(children[:0])
+		for i := len(children) - 1; i >= 0; i-- {
+			stack = append(stack, stackEntry{node: children[i], pathLen: len(path)})
+		}
+	}
+}
+
+func (n *trieCacheNode[K]) child(c byte) (*trieCacheNode[K], bool) {
+	idx, found := n.findChild(c)
+	if !found {
+		return nil, false
+	}
+	return &n.children[idx], true
+}
+
+// walkPrefixesOf walks down the trie along s and calls fn for every terminal
+// node which key is a prefix of s (from the shortest to the longest),
+// passing the length of the key. Stops as soon as fn returns false.
+func walkPrefixesOf[N trieWalkNode[N]](root N, s string, fn func(n int, node N) bool) {
+	node := root
+	for i := 0; ; {
+		if node.isTerminal() && !fn(i, node) {
+			return
+		}
+
+		if i == len(s) {
+			return
+		}
+
+		next, ok := node.child(s[i])
+		if !ok {
+			return
+		}
+
+		seg := next.segment()
+		if len(seg) > len(s)-i || seg != s[i:i+len(seg)] {
+			return
+		}
+
+		i += len(seg)
+		node = next
+	}
+}
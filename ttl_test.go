@@ -3,6 +3,7 @@ package geche
 import (
 	"context"
 	"math/rand"
+	"slices"
 	"strconv"
 	"sync"
 	"testing"
@@ -522,3 +523,52 @@ func TestOnEvictPartialCleanup(t *testing.T) {
 		t.Errorf("expected 4 evictions total, got %d", len(evicted))
 	}
 }
+
+func TestOnEvictReplace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewMapTTLCache[string, string](ctx, time.Second, time.Hour)
+	ts := time.Now()
+
+	var calls []string
+	c.OnEvict(func(key string, value string) {
+		calls = append(calls, "first:"+key)
+	})
+	c.OnEvict(func(key string, value string) {
+		calls = append(calls, "second:"+key)
+	})
+
+	c.Set("key1", "value1")
+
+	c.mux.Lock()
+	c.now = func() time.Time { return ts.Add(2 * time.Second) }
+	c.mux.Unlock()
+
+	if err := c.cleanup(); err != nil {
+		t.Errorf("unexpected error in cleanup: %v", err)
+	}
+
+	if !slices.Equal(calls, []string{"second:key1"}) {
+		t.Errorf("expected the second callback to replace the first one, got %v", calls)
+	}
+
+	// Wrappers are subscribed separately, nil removes only the callback.
+	kv := NewKV[string](c)
+	kv.Set("key2", "value2")
+	c.OnEvict(nil)
+	calls = nil
+	c.mux.Lock()
+	c.now = func() time.Time { return ts.Add(4 * time.Second) }
+	c.mux.Unlock()
+	if err := c.cleanup(); err != nil {
+		t.Errorf("unexpected error in cleanup: %v", err)
+	}
+
+	if len(calls) != 0 {
+		t.Errorf("expected removed callback not to be called, got %v", calls)
+	}
+	if n := kv.CountByPrefix("key"); n != 0 {
+		t.Errorf("expected KV to prune evicted key, got %d keys", n)
+	}
+}
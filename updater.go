@@ -2,6 +2,7 @@ package geche
 
 import (
 	"errors"
+	"iter"
 	"sync"
 )
 
@@ -16,9 +17,7 @@ type UpdateFn[K comparable, V any] func(key K) (V, error)
 type Updater[K comparable, V any] struct {
 	cache    Geche[K, V]
 	updateFn UpdateFn[K, V]
-	pool     chan struct{}
-	inFlight map[K]chan struct{}
-	mux      sync.RWMutex
+	gate     *keyGate[K]
 }
 
 // NewCacheUpdater returns cache wrapped with Updater. It calls updateFn
@@ -33,29 +32,64 @@ func NewCacheUpdater[K comparable, V any](
 	u := Updater[K, V]{
 		cache:    cache,
 		updateFn: updateFn,
-		pool:     make(chan struct{}, poolSize),
-		inFlight: make(map[K]chan struct{}, poolSize),
+		gate:     newKeyGate[K](poolSize),
 	}
 
 	return &u
 }
 
-// checkAndWaitInFlight waits for other cache key update
-// operation to finish. Returns true if had to wait (update operation
-// for key was running).
-func (u *Updater[K, V]) waitInFlight(key K) bool {
-	u.mux.RLock()
-	ch, ok := u.inFlight[key]
-	u.mux.RUnlock()
+// keyGate allows only one operation per key at a time, and only
+// pool size operations with different keys simultaneously.
+// It is used by Updater to run updateFn and by WriteThrough
+// and WriteBehind to run store operations.
+type keyGate[K comparable] struct {
+	mux      sync.Mutex
+	inFlight map[K]chan struct{}
+	pool     chan struct{}
+}
 
-	if !ok {
+func newKeyGate[K comparable](poolSize int) *keyGate[K] {
+	return &keyGate[K]{
+		inFlight: make(map[K]chan struct{}, poolSize),
+		pool:     make(chan struct{}, poolSize),
+	}
+}
+
+// tryAcquire starts the operation with the key and takes a token from the pool.
+// If the operation with the same key is already running, tryAcquire waits
+// for it to finish and returns false instead.
+func (g *keyGate[K]) tryAcquire(key K) bool {
+	g.mux.Lock()
+	if ch, ok := g.inFlight[key]; ok {
+		g.mux.Unlock()
+		<-ch // Wait for channel to be closed.
 		return false
 	}
+	g.inFlight[key] = make(chan struct{})
+	g.mux.Unlock()
 
-	<-ch // Wait for channel to be closed.
+	// Put token in the pool. Will wait if pool is full.
+	g.pool <- struct{}{}
 	return true
 }
 
+// acquire waits for operations with the same key
+// to finish and starts a new one.
+func (g *keyGate[K]) acquire(key K) {
+	for !g.tryAcquire(key) {
+	}
+}
+
+// release finishes the operation started by acquire or tryAcquire.
+func (g *keyGate[K]) release(key K) {
+	<-g.pool
+
+	g.mux.Lock()
+	close(g.inFlight[key])
+	delete(g.inFlight, key)
+	g.mux.Unlock()
+}
+
 func (u *Updater[K, V]) Set(key K, value V) {
 	u.cache.Set(key, value)
 }
@@ -77,36 +111,12 @@ func (u *Updater[K, V]) Get(key K) (V, error) {
 	v, err := u.cache.Get(key)
 	// Cache miss - update the cache!
 	if errors.Is(err, ErrNotFound) {
-	wait:
-		if u.waitInFlight(key) {
+		if !u.gate.tryAcquire(key) {
 			// If we had to wait, then other goroutine has already updated
 			// the cache. Returning it.
 			return u.cache.Get(key)
 		}
-
-		// Put token in the pool. Will wait if pool is full.
-		u.pool <- struct{}{}
-
-		u.mux.Lock()
-		// Another goroutine could have started doing update between waitInFlight and here.
-		_, ok := u.inFlight[key]
-		if ok {
-			<-u.pool
-			u.mux.Unlock()
-			goto wait
-		}
-
-		inFlightCh := make(chan struct{})
-		u.inFlight[key] = inFlightCh
-		u.mux.Unlock()
-		defer func() {
-			// When finished cache update, releasing all locks.
-			u.mux.Lock()
-			close(inFlightCh)
-			delete(u.inFlight, key)
-			u.mux.Unlock()
-			<-u.pool
-		}()
+		defer u.gate.release(key)
 
 		v, err = u.updateFn(key)
 		if err != nil {
@@ -137,8 +147,8 @@ func (u *Updater[K, V]) Len() int {
 
 // Clear removes all elements from the cache.
 func (u *Updater[K, V]) Clear() {
-	u.mux.Lock()
-	defer u.mux.Unlock()
+	u.gate.mux.Lock()
+	defer u.gate.mux.Unlock()
 
 	u.cache.Clear()
 }
@@ -153,3 +163,22 @@ func (u *Updater[K, V]) ListByPrefix(prefix string) ([]V, error) {
 
 	return kv.ListByPrefix(prefix)
 }
+
+// All is an iterator over all key-value pairs in the underlying cache.
+// If the underlying cache does not implement Iterable, its Snapshot is iterated.
+// Iteration does not call updateFn. Locking rules of the underlying cache apply.
+func (u *Updater[K, V]) All() iter.Seq2[K, V] {
+	return all(u.cache)
+}
+
+// Keys is an iterator over all keys in the underlying cache.
+// Same rules as for All apply.
+func (u *Updater[K, V]) Keys() iter.Seq[K] {
+	return keysOf(u.All())
+}
+
+// Values is an iterator over all values in the underlying cache.
+// Same rules as for All apply.
+func (u *Updater[K, V]) Values() iter.Seq[V] {
+	return valuesOf(u.All())
+}
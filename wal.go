@@ -0,0 +1,195 @@
+package geche
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrCorruptLog is returned by NewDurable when the write-ahead log
+// can't be replayed because one of its segments is corrupted.
+var ErrCorruptLog = errors.New("corrupt write-ahead log")
+
+// Write-ahead log directory contains numbered segments and snapshots:
+//
+//	wal-<n>.log       log records written after snapshot-<n>.bin
+//	snapshot-<n>.bin  state of the cache that includes all records of
+//	                  segments with numbers less than n (see SaveTo)
+//
+// Segment is a sequence of records (all integers are little endian):
+//
+//	record:  payload length (uint32), CRC-32C of the payload (uint32), payload
+//	payload: operation (1 byte) followed by
+//	         Set:   key length (uvarint), key, value length (uvarint), value,
+//	                write time in Unix nanoseconds (varint)
+//	         Del:   key length (uvarint), key
+//	         Clear: nothing
+//
+// Records are applied in order, and replaying a record that is already
+// included in the snapshot does not change the result, so snapshot can be
+// written while new records are appended to the next segment.
+const (
+	walSegmentPrefix  = "wal-"
+	walSegmentSuffix  = ".log"
+	walSnapshotPrefix = "snapshot-"
+	walSnapshotSuffix = ".bin"
+	walTmpSuffix      = ".tmp"
+
+	maxWALRecordSize = 1 << 30
+)
+
+type walOp byte
+
+const (
+	walOpSet walOp = iota + 1
+	walOpDel
+	walOpClear
+)
+
+func walSegmentName(n uint64) string {
+	return fmt.Sprintf("%s%020d%s", walSegmentPrefix, n, walSegmentSuffix)
+}
+
+func walSnapshotName(n uint64) string {
+	return fmt.Sprintf("%s%020d%s", walSnapshotPrefix, n, walSnapshotSuffix)
+}
+
+// walFiles lists numbers of segments and snapshots in the directory
+// in ascending order. Leftovers of interrupted snapshot writes are removed.
+func walFiles(dir string) (segments, snapshots []uint64, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, walTmpSuffix) {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		var n uint64
+		if _, err := fmt.Sscanf(name, walSegmentPrefix+"%d"+walSegmentSuffix, &n); err == nil && name == walSegmentName(n) {
+			segments = append(segments, n)
+		} else if _, err := fmt.Sscanf(name, walSnapshotPrefix+"%d"+walSnapshotSuffix, &n); err == nil && name == walSnapshotName(n) {
+			snapshots = append(snapshots, n)
+		}
+	}
+
+	slices.Sort(segments)
+	slices.Sort(snapshots)
+
+	return segments, snapshots, nil
+}
+
+// appendWALRecord appends framed record with the payload to dst.
+func appendWALRecord(dst, payload []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(payload)))
+	dst = binary.LittleEndian.AppendUint32(dst, crc32.Checksum(payload, crcTable))
+	return append(dst, payload...)
+}
+
+// readWALSegment calls fn for payload of each record of the segment.
+// Returns the size of the valid part of the segment and ErrCorruptLog
+// if the segment has invalid or incomplete records after it.
+func readWALSegment(r io.Reader, fn func(payload []byte) error) (int64, error) {
+	var (
+		valid   int64
+		header  [8]byte
+		payload []byte
+	)
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return valid, nil
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return valid, fmt.Errorf("%w: incomplete record", ErrCorruptLog)
+			}
+			return valid, err
+		}
+
+		size := binary.LittleEndian.Uint32(header[0:])
+		sum := binary.LittleEndian.Uint32(header[4:])
+		if size > maxWALRecordSize {
+			return valid, fmt.Errorf("%w: record is too large", ErrCorruptLog)
+		}
+
+		payload = slices.Grow(payload[:0], int(size))[:size]
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return valid, fmt.Errorf("%w: incomplete record", ErrCorruptLog)
+			}
+			return valid, err
+		}
+
+		if crc32.Checksum(payload, crcTable) != sum {
+			return valid, fmt.Errorf("%w: checksum mismatch", ErrCorruptLog)
+		}
+
+		if err := fn(payload); err != nil {
+			return valid, err
+		}
+		valid += int64(len(header)) + int64(size)
+	}
+}
+
+// syncDir makes changes of the directory entries (created, renamed
+// and removed files) durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// appendKeyChunk appends the key encoded by the codec
+// and prefixed with its length (uvarint) to dst.
+func appendKeyChunk[K, V any](dst []byte, codec Codec[K, V], key K) ([]byte, error) {
+	start := len(dst)
+	dst, err := codec.AppendKey(dst, key)
+	if err != nil {
+		return dst, err
+	}
+
+	return insertUvarint(dst, start, len(dst)-start), nil
+}
+
+// appendValueChunk appends the value encoded by the codec
+// and prefixed with its length (uvarint) to dst.
+func appendValueChunk[K, V any](dst []byte, codec Codec[K, V], value V) ([]byte, error) {
+	start := len(dst)
+	dst, err := codec.AppendValue(dst, value)
+	if err != nil {
+		return dst, err
+	}
+
+	return insertUvarint(dst, start, len(dst)-start), nil
+}
+
+// insertUvarint inserts n encoded as uvarint at position i of b.
+func insertUvarint(b []byte, i, n int) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(tmp[:], uint64(n))
+	b = append(b, tmp[:l]...)
+	copy(b[i+l:], b[i:len(b)-l])
+	copy(b[i:], tmp[:l])
+
+	return b
+}
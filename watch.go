@@ -0,0 +1,471 @@
+package geche
+
+import (
+	"context"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// EventType is the kind of the cache change reported by Watch.
+type EventType int
+
+const (
+	// EventSet is sent when the record is set.
+	EventSet EventType = iota + 1
+	// EventDel is sent when the record is deleted.
+	EventDel
+	// EventEvict is sent when the record is evicted by the cache
+	// (e.g. RingBuffer is full).
+	EventEvict
+	// EventExpire is sent when the expired record is removed by MapTTLCache.
+	EventExpire
+	// EventClear is sent when all records are removed by Clear.
+	EventClear
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDel:
+		return "del"
+	case EventEvict:
+		return "evict"
+	case EventExpire:
+		return "expire"
+	case EventClear:
+		return "clear"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a single change of the cache.
+type Event[K, V any] struct {
+	Type EventType
+	// Key of the changed record. Zero for EventClear.
+	Key K
+	// Old is the previous value of the record. For EventDel, EventEvict
+	// and EventExpire it is the removed value.
+	Old V
+	// HasOld is false if the record did not exist before EventSet.
+	HasOld bool
+	// New is the value set by EventSet.
+	New V
+}
+
+// SlowConsumerPolicy defines what happens when the buffer
+// of the subscriber is full.
+type SlowConsumerPolicy int
+
+const (
+	// DropEvents drops events that do not fit into the buffer.
+	DropEvents SlowConsumerPolicy = iota
+	// BlockWriters makes writers wait until the subscriber reads the event.
+	// Subscriber should not write to the watched cache, otherwise it
+	// can deadlock waiting for itself.
+	BlockWriters
+	// Disconnect unsubscribes the subscriber and closes its channel.
+	Disconnect
+)
+
+// WatchFilter selects events sent to the subscriber
+// and configures its buffer. Zero value receives all events.
+type WatchFilter[K any] struct {
+	// Types of events to receive. Empty means all types.
+	Types []EventType
+	// Key returns true for keys which events should be received.
+	// Nil means all keys. EventClear is not filtered by the key.
+	Key func(key K) bool
+	// BufferSize is the capacity of the event channel. Default is 64.
+	BufferSize int
+	// Policy applied when the buffer is full. Default is DropEvents.
+	Policy SlowConsumerPolicy
+}
+
+const defaultWatchBufferSize = 64
+
+type watcher[K, V any] struct {
+	ch     chan Event[K, V]
+	types  uint
+	key    func(K) bool
+	policy SlowConsumerPolicy
+	// done is closed when the context of the subscriber is done,
+	// and stop is closed when the subscriber is removed.
+	done <-chan struct{}
+	stop chan struct{}
+	// overflow is set when the subscriber is about to be disconnected.
+	overflow bool
+
+	// mux is held while an event is sent to ch, so ch is never
+	// closed during the send.
+	mux    sync.Mutex
+	closed bool
+}
+
+func (w *watcher[K, V]) match(ev Event[K, V]) bool {
+	if w.types != 0 && w.types&(1<<ev.Type) == 0 {
+		return false
+	}
+
+	return ev.Type == EventClear || w.key == nil || w.key(ev.Key)
+}
+
+// send sends the event according to the policy of the subscriber.
+// Returns false if the buffer is full and the subscriber should be disconnected.
+func (w *watcher[K, V]) send(ev Event[K, V]) bool {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return true
+	}
+
+	switch w.policy {
+	case BlockWriters:
+		select {
+		case w.ch <- ev:
+		case <-w.done:
+		case <-w.stop:
+		}
+	case Disconnect:
+		select {
+		case w.ch <- ev:
+		default:
+			return false
+		}
+	default:
+		select {
+		case w.ch <- ev:
+		default:
+		}
+	}
+
+	return true
+}
+
+// close closes the channel of the subscriber,
+// waiting for the event being sent to it.
+func (w *watcher[K, V]) close() {
+	w.mux.Lock()
+	w.closed = true
+	close(w.ch)
+	w.mux.Unlock()
+}
+
+// watchHub delivers events of the cache to its subscribers.
+// Zero value is ready to use.
+//
+// Events are added to the queue while the cache lock is held, so they
+// are queued in the order of changes. Then the writer releases the cache lock
+// and calls flush, which sends all queued events. Flushes are serialized,
+// so subscribers receive events in the same order.
+type watchHub[K, V any] struct {
+	// mux protects subscribers. Events are sent to a copy of subscribers
+	// without the lock held, so a blocked send does not stall Watch.
+	mux  sync.RWMutex
+	subs map[*watcher[K, V]]struct{}
+	// Number of subscribers, to skip building events when nobody watches.
+	n atomic.Int32
+
+	pendingMux sync.Mutex
+	pending    []Event[K, V]
+
+	flushMux sync.Mutex
+}
+
+// watch adds the subscriber, which is removed when ctx is done.
+func (h *watchHub[K, V]) watch(ctx context.Context, filter WatchFilter[K]) <-chan Event[K, V] {
+	size := filter.BufferSize
+	if size <= 0 {
+		size = defaultWatchBufferSize
+	}
+
+	w := &watcher[K, V]{
+		ch:     make(chan Event[K, V], size),
+		key:    filter.Key,
+		policy: filter.Policy,
+		done:   ctx.Done(),
+		stop:   make(chan struct{}),
+	}
+	for _, t := range filter.Types {
+		w.types |= 1 << t
+	}
+
+	h.mux.Lock()
+	if h.subs == nil {
+		h.subs = make(map[*watcher[K, V]]struct{})
+	}
+	h.subs[w] = struct{}{}
+	h.n.Add(1)
+	h.mux.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			h.remove(w)
+		case <-w.stop:
+		}
+	}()
+
+	return w.ch
+}
+
+// remove unsubscribes the subscriber and closes its channel.
+// It is safe to call it several times.
+func (h *watchHub[K, V]) remove(w *watcher[K, V]) {
+	h.mux.Lock()
+	if _, ok := h.subs[w]; !ok {
+		h.mux.Unlock()
+		return
+	}
+
+	delete(h.subs, w)
+	h.n.Add(-1)
+	h.mux.Unlock()
+
+	// Closing stop unblocks the send to the subscriber, if any.
+	close(w.stop)
+	w.close()
+}
+
+// active returns true if there are subscribers.
+// Caches should not build events if there are none.
+func (h *watchHub[K, V]) active() bool {
+	return h.n.Load() > 0
+}
+
+// add queues the event. Should be called with the cache lock held.
+func (h *watchHub[K, V]) add(ev Event[K, V]) {
+	h.pendingMux.Lock()
+	h.pending = append(h.pending, ev)
+	h.pendingMux.Unlock()
+}
+
+// flush sends queued events to subscribers.
+// Should be called after the cache lock is released.
+func (h *watchHub[K, V]) flush() {
+	h.pendingMux.Lock()
+	empty := len(h.pending) == 0
+	h.pendingMux.Unlock()
+	if empty {
+		return
+	}
+
+	h.flushMux.Lock()
+	defer h.flushMux.Unlock()
+
+	// Events queued after the check above are taken too,
+	// and later flush finds the queue empty.
+	h.pendingMux.Lock()
+	events := h.pending
+	h.pending = nil
+	h.pendingMux.Unlock()
+
+	h.mux.RLock()
+	subs := slices.Collect(maps.Keys(h.subs))
+	h.mux.RUnlock()
+
+	var overflown []*watcher[K, V]
+	for _, ev := range events {
+		for _, w := range subs {
+			if w.overflow || !w.match(ev) {
+				continue
+			}
+
+			if !w.send(ev) {
+				w.overflow = true
+				overflown = append(overflown, w)
+			}
+		}
+	}
+
+	for _, w := range overflown {
+		h.remove(w)
+	}
+}
+
+// evictEventType returns the type of events for evictions reported
+// by the cache: caches with TTL evict expired records.
+func evictEventType[K comparable, V any](cache Geche[K, V]) EventType {
+	if _, ok := cache.(ttlIterable[K, V]); ok {
+		return EventExpire
+	}
+
+	return EventEvict
+}
+
+// prefixFilter narrows the filter down to keys starting with the prefix.
+func prefixFilter[K byteSlice](filter WatchFilter[K], prefix K) WatchFilter[K] {
+	p := strings.Clone(keyToString(prefix))
+	match := filter.Key
+	filter.Key = func(key K) bool {
+		return strings.HasPrefix(keyToString(key), p) && (match == nil || match(key))
+	}
+
+	return filter
+}
+
+// Watched is a wrapper for any Geche interface implementation
+// that sends changes of the cache to subscribers (see Watch).
+// To report previous values, writes are serialized
+// and read the current value before changing it.
+// If the cache implements EvictionNotifier (e.g. MapTTLCache or RingBuffer),
+// evictions are reported too: as EventExpire for MapTTLCache
+// and as EventEvict for other caches.
+type Watched[K comparable, V any] struct {
+	cache     Geche[K, V]
+	mux       sync.Mutex
+	hub       watchHub[K, V]
+	evictType EventType
+}
+
+// NewWatched creates a new Watched wrapper over the cache.
+func NewWatched[K comparable, V any](cache Geche[K, V]) *Watched[K, V] {
+	w := &Watched[K, V]{
+		cache:     cache,
+		evictType: evictEventType(cache),
+	}
+
+	subscribeEvict(cache, w.onEvict)
+
+	return w
+}
+
+func (w *Watched[K, V]) onEvict(key K, value V) {
+	if !w.hub.active() {
+		return
+	}
+
+	w.hub.add(Event[K, V]{Type: w.evictType, Key: key, Old: value, HasOld: true})
+	w.hub.flush()
+}
+
+// Watch subscribes to changes of the cache. Events are sent to the returned
+// channel until ctx is done, then the channel is closed. Changes made
+// before Watch returns are not sent. Filter selects events and defines
+// what happens if the subscriber does not keep up with changes.
+func (w *Watched[K, V]) Watch(ctx context.Context, filter WatchFilter[K]) <-chan Event[K, V] {
+	return w.hub.watch(ctx, filter)
+}
+
+// old returns the current value of the key if there are subscribers.
+func (w *Watched[K, V]) old(key K) (V, bool) {
+	if !w.hub.active() {
+		var zero V
+		return zero, false
+	}
+
+	v, err := w.cache.Get(key)
+	return v, err == nil
+}
+
+// Set sets the record and sends EventSet.
+func (w *Watched[K, V]) Set(key K, value V) {
+	w.mux.Lock()
+	defer w.hub.flush()
+	defer w.mux.Unlock()
+
+	old, ok := w.old(key)
+	w.cache.Set(key, value)
+	if w.hub.active() {
+		w.hub.add(Event[K, V]{Type: EventSet, Key: key, Old: old, HasOld: ok, New: value})
+	}
+}
+
+// SetIfPresent sets the value only if the key already exists.
+// EventSet is sent if the value was set.
+func (w *Watched[K, V]) SetIfPresent(key K, value V) (V, bool) {
+	w.mux.Lock()
+	defer w.hub.flush()
+	defer w.mux.Unlock()
+
+	old, ok := w.cache.SetIfPresent(key, value)
+	if ok && w.hub.active() {
+		w.hub.add(Event[K, V]{Type: EventSet, Key: key, Old: old, HasOld: true, New: value})
+	}
+
+	return old, ok
+}
+
+// SetIfAbsent sets the value only if the key does not exist yet.
+// EventSet is sent if the value was set.
+func (w *Watched[K, V]) SetIfAbsent(key K, value V) (V, bool) {
+	w.mux.Lock()
+	defer w.hub.flush()
+	defer w.mux.Unlock()
+
+	old, ok := w.cache.SetIfAbsent(key, value)
+	if ok && w.hub.active() {
+		w.hub.add(Event[K, V]{Type: EventSet, Key: key, New: value})
+	}
+
+	return old, ok
+}
+
+// Get returns the value from the underlying cache.
+func (w *Watched[K, V]) Get(key K) (V, error) {
+	return w.cache.Get(key)
+}
+
+// Del deletes the key and sends EventDel if the key existed.
+func (w *Watched[K, V]) Del(key K) error {
+	w.mux.Lock()
+	defer w.hub.flush()
+	defer w.mux.Unlock()
+
+	old, ok := w.old(key)
+	if err := w.cache.Del(key); err != nil {
+		return err
+	}
+	if ok {
+		w.hub.add(Event[K, V]{Type: EventDel, Key: key, Old: old, HasOld: true})
+	}
+
+	return nil
+}
+
+// Snapshot returns a shallow copy of the underlying cache.
+func (w *Watched[K, V]) Snapshot() map[K]V {
+	return w.cache.Snapshot()
+}
+
+// Len returns the number of records in the underlying cache.
+func (w *Watched[K, V]) Len() int {
+	return w.cache.Len()
+}
+
+// Clear removes all records and sends EventClear.
+// Events for individual records are not sent.
+func (w *Watched[K, V]) Clear() {
+	w.mux.Lock()
+	defer w.hub.flush()
+	defer w.mux.Unlock()
+
+	w.cache.Clear()
+	if w.hub.active() {
+		w.hub.add(Event[K, V]{Type: EventClear})
+	}
+}
+
+// All is an iterator over all key-value pairs of the underlying cache.
+// Locking rules of the underlying cache apply.
+func (w *Watched[K, V]) All() iter.Seq2[K, V] {
+	return all(w.cache)
+}
+
+// Keys is an iterator over all keys of the underlying cache.
+// Same rules as for All apply.
+func (w *Watched[K, V]) Keys() iter.Seq[K] {
+	return keysOf(w.All())
+}
+
+// Values is an iterator over all values of the underlying cache.
+// Same rules as for All apply.
+func (w *Watched[K, V]) Values() iter.Seq[V] {
+	return valuesOf(w.All())
+}
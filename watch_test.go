@@ -0,0 +1,359 @@
+package geche
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func ExampleNewWatched() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewWatched[string, int](NewMapCache[string, int]())
+	events := c.Watch(ctx, WatchFilter[string]{})
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	_ = c.Del("a")
+
+	for i := 0; i < 3; i++ {
+		ev := <-events
+		fmt.Println(ev.Type, ev.Key, ev.Old, ev.New)
+	}
+	// Output:
+	// set a 0 1
+	// set a 1 2
+	// del a 2 0
+}
+
+// receive reads n events from the channel or fails the test on timeout.
+func receive[K, V any](t *testing.T, ch <-chan Event[K, V], n int) []Event[K, V] {
+	t.Helper()
+
+	var events []Event[K, V]
+	for len(events) < n {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				t.Fatalf("channel closed after %d events: %v", len(events), events)
+			}
+			events = append(events, ev)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d events, got %v", n, events)
+		}
+	}
+
+	return events
+}
+
+// expectNoEvents fails the test if there are events in the channel.
+func expectNoEvents[K, V any](t *testing.T, ch <-chan Event[K, V]) {
+	t.Helper()
+
+	select {
+	case ev := <-ch:
+		t.Errorf("unexpected event %v", ev)
+	default:
+	}
+}
+
+func TestWatchedEvents(t *testing.T) {
+	c := NewWatched[string, string](NewMapCache[string, string]())
+	all := c.Watch(t.Context(), WatchFilter[string]{})
+	dels := c.Watch(t.Context(), WatchFilter[string]{
+		Types: []EventType{EventDel, EventClear},
+		Key:   func(key string) bool { return key != "b" },
+	})
+
+	c.Set("a", "1")
+	c.SetIfPresent("a", "2")
+	c.SetIfPresent("b", "x")
+	c.SetIfAbsent("b", "3")
+	c.SetIfAbsent("b", "x")
+	_ = c.Del("b")
+	_ = c.Del("missing")
+	_ = c.Del("a")
+	c.Clear()
+
+	expected := []Event[string, string]{
+		{Type: EventSet, Key: "a", New: "1"},
+		{Type: EventSet, Key: "a", Old: "1", HasOld: true, New: "2"},
+		{Type: EventSet, Key: "b", New: "3"},
+		{Type: EventDel, Key: "b", Old: "3", HasOld: true},
+		{Type: EventDel, Key: "a", Old: "2", HasOld: true},
+		{Type: EventClear},
+	}
+	if events := receive(t, all, len(expected)); !slices.Equal(events, expected) {
+		t.Errorf("expected events %v, got %v", expected, events)
+	}
+	expectNoEvents(t, all)
+
+	expected = []Event[string, string]{
+		{Type: EventDel, Key: "a", Old: "2", HasOld: true},
+		{Type: EventClear},
+	}
+	if events := receive(t, dels, len(expected)); !slices.Equal(events, expected) {
+		t.Errorf("expected filtered events %v, got %v", expected, events)
+	}
+	expectNoEvents(t, dels)
+}
+
+func TestWatchedEviction(t *testing.T) {
+	c := NewWatched[int, int](NewRingBuffer[int, int](2))
+	events := c.Watch(t.Context(), WatchFilter[int]{Types: []EventType{EventEvict}})
+
+	for i := 0; i < 4; i++ {
+		c.Set(i, i*10)
+	}
+
+	expected := []Event[int, int]{
+		{Type: EventEvict, Key: 0, Old: 0, HasOld: true},
+		{Type: EventEvict, Key: 1, Old: 10, HasOld: true},
+	}
+	if got := receive(t, events, 2); !slices.Equal(got, expected) {
+		t.Errorf("expected events %v, got %v", expected, got)
+	}
+
+	ttl := NewMapTTLCache[string, string](t.Context(), time.Second, time.Hour)
+	w := NewWatched[string, string](ttl)
+	expired := w.Watch(t.Context(), WatchFilter[string]{Types: []EventType{EventExpire}})
+	ts := time.Now()
+
+	w.Set("a", "a")
+	ttl.mux.Lock()
+	ttl.now = func() time.Time { return ts.Add(2 * time.Second) }
+	ttl.mux.Unlock()
+
+	if err := ttl.cleanup(); err != nil {
+		t.Fatalf("unexpected error in cleanup: %v", err)
+	}
+
+	ev := receive(t, expired, 1)[0]
+	if ev.Type != EventExpire || ev.Key != "a" || ev.Old != "a" {
+		t.Errorf("expected expire event for a, got %v", ev)
+	}
+}
+
+func TestWatchSlowConsumer(t *testing.T) {
+	c := NewWatched[int, int](NewMapCache[int, int]())
+	drop := c.Watch(t.Context(), WatchFilter[int]{BufferSize: 2})
+	disconnect := c.Watch(t.Context(), WatchFilter[int]{BufferSize: 2, Policy: Disconnect})
+	block := c.Watch(t.Context(), WatchFilter[int]{BufferSize: 1, Policy: BlockWriters})
+
+	var (
+		wg    sync.WaitGroup
+		keys  []int
+		reads = make(chan struct{})
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			<-reads
+			ev := <-block
+			keys = append(keys, ev.Key)
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			c.Set(i, i)
+		}
+	}()
+
+	// Writer is blocked until the blocking subscriber reads events.
+	for i := 0; i < 5; i++ {
+		reads <- struct{}{}
+	}
+	wg.Wait()
+	<-done
+
+	if !slices.Equal(keys, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("expected blocking subscriber to receive all events, got %v", keys)
+	}
+
+	if got := receive(t, drop, 2); got[0].Key != 0 || got[1].Key != 1 {
+		t.Errorf("expected first 2 events to be kept, got %v", got)
+	}
+	expectNoEvents(t, drop)
+
+	receive(t, disconnect, 2)
+	if _, ok := <-disconnect; ok {
+		t.Error("expected slow subscriber to be disconnected")
+	}
+	if c.hub.n.Load() != 2 {
+		t.Errorf("expected 2 subscribers left, got %d", c.hub.n.Load())
+	}
+}
+
+func TestWatchCancel(t *testing.T) {
+	c := NewWatched[int, int](NewMapCache[int, int]())
+
+	ctx, cancel := context.WithCancel(t.Context())
+	events := c.Watch(ctx, WatchFilter[int]{BufferSize: 1, Policy: BlockWriters})
+	c.Set(1, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Blocks until the subscriber is canceled.
+		c.Set(2, 2)
+	}()
+
+	cancel()
+	<-done
+
+	if ev := <-events; ev.Key != 1 {
+		t.Errorf("expected buffered event to be kept, got %v", ev)
+	}
+	if _, ok := <-events; ok {
+		t.Error("expected channel to be closed")
+	}
+}
+
+func TestWatchWhileWriterBlocked(t *testing.T) {
+	c := NewWatched[int, int](NewMapCache[int, int]())
+
+	events := c.Watch(t.Context(), WatchFilter[int]{BufferSize: 1, Policy: BlockWriters})
+	c.Set(1, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Blocks until the subscriber reads the first event.
+		c.Set(2, 2)
+	}()
+	for _, err := c.Get(2); err != nil; _, err = c.Get(2) {
+		time.Sleep(time.Millisecond)
+	}
+	// Let the writer block in sending the event.
+	time.Sleep(10 * time.Millisecond)
+
+	// Subscribing and unsubscribing do not wait for the blocked writer.
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		ctx, cancel := context.WithCancel(t.Context())
+		other := c.Watch(ctx, WatchFilter[int]{})
+		cancel()
+		for range other {
+		}
+	}()
+
+	select {
+	case <-watched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Watch not to be blocked by the slow subscriber")
+	}
+
+	if got := receive(t, events, 2); got[0].Key != 1 || got[1].Key != 2 {
+		t.Errorf("expected blocking subscriber to receive all events, got %v", got)
+	}
+	<-done
+}
+
+func TestKVWatchPrefix(t *testing.T) {
+	kv := NewKV[string](NewRingBuffer[string, string](2))
+	events := kv.WatchPrefix(t.Context(), "user:", WatchFilter[string]{})
+
+	kv.Set("user:1", "a")
+	kv.Set("group:1", "b")
+	kv.Set("user:2", "c") // Evicts user:1.
+	kv.Set("user:1", "d")
+	kv.Set("user:3", "e") // Evicts user:2.
+	_ = kv.Del("user:2")
+	if n := kv.DeleteByPrefix("user:"); n != 2 {
+		t.Fatalf("expected 2 keys deleted, got %d", n)
+	}
+	kv.Clear()
+
+	expected := []Event[string, string]{
+		{Type: EventSet, Key: "user:1", New: "a"},
+		{Type: EventEvict, Key: "user:1", Old: "a", HasOld: true},
+		{Type: EventSet, Key: "user:2", New: "c"},
+		{Type: EventSet, Key: "user:1", New: "d"},
+		{Type: EventEvict, Key: "user:2", Old: "c", HasOld: true},
+		{Type: EventSet, Key: "user:3", New: "e"},
+		{Type: EventDel, Key: "user:1", Old: "d", HasOld: true},
+		{Type: EventDel, Key: "user:3", Old: "e", HasOld: true},
+		{Type: EventClear},
+	}
+	if got := receive(t, events, len(expected)); !slices.Equal(got, expected) {
+		t.Errorf("expected events\n%v\ngot\n%v", expected, got)
+	}
+	expectNoEvents(t, events)
+}
+
+func TestKVCacheWatchPrefix(t *testing.T) {
+	kv := NewKVCache[[]byte, int]()
+	events := kv.WatchPrefix(t.Context(), []byte("a"), WatchFilter[[]byte]{})
+
+	kv.Set([]byte("ab"), 1)
+	kv.Set([]byte("ac"), 2)
+	kv.Set([]byte("b"), 3)
+	kv.SetWithScore([]byte("ab"), 4, 1)
+	_ = kv.Del([]byte("ac"))
+	kv.Set([]byte("ad"), 5)
+	if n := kv.DeleteByPrefix([]byte("a")); n != 2 {
+		t.Fatalf("expected 2 keys deleted, got %d", n)
+	}
+	kv.Clear()
+
+	var got []string
+	for _, ev := range receive(t, events, 8) {
+		if len(ev.Key) > 0 {
+			ev.Key[0] = 'x' // Event keys are copies.
+		}
+		got = append(got, fmt.Sprintf("%s %s %d/%t %d", ev.Type, ev.Key, ev.Old, ev.HasOld, ev.New))
+	}
+	expected := []string{
+		"set xb 0/false 1",
+		"set xc 0/false 2",
+		"set xb 1/true 4",
+		"del xc 2/true 0",
+		"set xd 0/false 5",
+		"del xb 4/true 0",
+		"del xd 5/true 0",
+		"clear  0/false 0",
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected events\n%v\ngot\n%v", expected, got)
+	}
+	expectNoEvents(t, events)
+}
+
+func TestWatchConcurrent(t *testing.T) {
+	kv := NewKVCache[string, int]()
+	events := kv.Watch(t.Context(), WatchFilter[string]{BufferSize: 1, Policy: BlockWriters})
+
+	const n = 1000
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				key := strconv.Itoa(j % 10)
+				kv.Set(key, i*n+j)
+			}
+		}()
+	}
+
+	// Values of the key are replayed in order: old value
+	// of each event is the new value of the previous one.
+	last := map[string]int{}
+	for _, ev := range receive(t, events, 4*n) {
+		if old, ok := last[ev.Key]; ok != ev.HasOld || old != ev.Old {
+			t.Fatalf("expected old value %d/%t for %s, got %v", old, ok, ev.Key, ev)
+		}
+		last[ev.Key] = ev.New
+	}
+	wg.Wait()
+}
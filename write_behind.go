@@ -0,0 +1,465 @@
+package geche
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultWriteBehindBatchSize     = 100
+	defaultWriteBehindFlushInterval = time.Second
+	defaultWriteBehindMaxRetries    = 3
+	defaultWriteBehindRetryDelay    = 100 * time.Millisecond
+)
+
+// WriteBehindOptions configures WriteBehind. Zero value is valid.
+type WriteBehindOptions[K comparable] struct {
+	// BatchSize is the number of queued keys that triggers flush
+	// before FlushInterval passes. Default is 100.
+	BatchSize int
+	// FlushInterval is the interval of background flushes. Default is 1s.
+	FlushInterval time.Duration
+	// PoolSize is the number of concurrent store operations during flush
+	// if the store does not implement BatchStore. Default is 1.
+	PoolSize int
+	// MaxRetries is the number of retries of failed writes during flush.
+	// Default is 3, negative value disables retries.
+	MaxRetries int
+	// RetryDelay is the delay before the first retry, it is doubled
+	// for every next retry. Default is 100ms.
+	RetryDelay time.Duration
+	// OnError is called with keys that were not written to the store
+	// after all retries, and the error of the last attempt.
+	OnError func(keys []K, err error)
+}
+
+// writeOp is a queued write of WriteBehind.
+type writeOp[V any] struct {
+	value V
+	del   bool
+}
+
+// WriteBehind is a wrapper for any Geche interface implementation
+// that writes changes to the backing store asynchronously.
+// Set and Del are applied to the cache immediately and queued.
+// Queued writes of the same key are coalesced, so only the last one is written.
+// Queue is flushed to the store in batches every FlushInterval or when
+// BatchSize keys are queued. Cache misses are loaded from the store,
+// unless the key has queued writes.
+// Writes that failed after all retries are reported to OnError
+// and dropped, so the store can get out of sync with the cache.
+// After Close or ctx cancellation writes are flushed synchronously
+// by the call that made them.
+type WriteBehind[K comparable, V any] struct {
+	cache Geche[K, V]
+	store Store[K, V]
+	opts  WriteBehindOptions[K]
+
+	// mux serializes writes to the cache with the queue,
+	// so loaded values do not overwrite newer writes.
+	mux      sync.Mutex
+	pending  map[K]writeOp[V]
+	flushing map[K]writeOp[V]
+	// loading keys that are being loaded from the store,
+	// with the last write made while loading, if any.
+	loading map[K]*writeOp[V]
+	gate    *keyGate[K]
+
+	// flushMux allows only one flush at a time.
+	flushMux sync.Mutex
+	kick     chan struct{}
+	done     chan struct{}
+	// stopped is set when the background goroutine stops.
+	stopped   atomic.Bool
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewWriteBehind returns cache wrapped with WriteBehind.
+// Background goroutine that flushes queued writes runs until
+// ctx is canceled or Close is called.
+func NewWriteBehind[K comparable, V any](
+	ctx context.Context,
+	cache Geche[K, V],
+	store Store[K, V],
+	opts WriteBehindOptions[K],
+) *WriteBehind[K, V] {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultWriteBehindBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultWriteBehindFlushInterval
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 1
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultWriteBehindMaxRetries
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = defaultWriteBehindRetryDelay
+	}
+
+	w := WriteBehind[K, V]{
+		cache:   cache,
+		store:   store,
+		opts:    opts,
+		pending: make(map[K]writeOp[V]),
+		loading: make(map[K]*writeOp[V]),
+		gate:    newKeyGate[K](opts.PoolSize),
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	w.wg.Add(1)
+	go w.run(ctx)
+
+	return &w
+}
+
+func (w *WriteBehind[K, V]) run(ctx context.Context) {
+	defer w.wg.Done()
+
+	t := time.NewTicker(w.opts.FlushInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.stopped.Store(true)
+			_ = w.Flush()
+			return
+		case <-w.done:
+			return
+		case <-t.C:
+		case <-w.kick:
+		}
+		_ = w.Flush()
+	}
+}
+
+// enqueue queues the write of the key. Caller must hold the lock.
+func (w *WriteBehind[K, V]) enqueue(key K, op writeOp[V]) {
+	w.pending[key] = op
+	if _, ok := w.loading[key]; ok {
+		w.loading[key] = &op
+	}
+}
+
+// maybeKick wakes up the background goroutine if the queue is full.
+// If the background goroutine is stopped, the queue is flushed synchronously.
+func (w *WriteBehind[K, V]) maybeKick(queued int) {
+	if w.stopped.Load() {
+		_ = w.Flush()
+		return
+	}
+	if queued < w.opts.BatchSize {
+		return
+	}
+
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+// lookup returns the value of the key from the cache or from the queue.
+// Returns false if the key is neither cached nor queued, so only the store
+// knows if it exists. Caller must hold the lock.
+func (w *WriteBehind[K, V]) lookup(key K) (v V, present, ok bool) {
+	if v, err := w.cache.Get(key); err == nil {
+		return v, true, true
+	}
+
+	for _, q := range []map[K]writeOp[V]{w.pending, w.flushing} {
+		if op, ok := q[key]; ok {
+			if op.del {
+				return v, false, true
+			}
+			return op.value, true, true
+		}
+	}
+
+	return v, false, false
+}
+
+// Set sets the record in the cache and queues the write to the store.
+func (w *WriteBehind[K, V]) Set(key K, value V) {
+	w.mux.Lock()
+	w.cache.Set(key, value)
+	w.enqueue(key, writeOp[V]{value: value})
+	queued := len(w.pending)
+	w.mux.Unlock()
+
+	w.maybeKick(queued)
+}
+
+// SetIfPresent sets the value only if the key exists in the cache,
+// in the queue, or in the store.
+func (w *WriteBehind[K, V]) SetIfPresent(key K, value V) (V, bool) {
+	return w.setIf(key, value, true)
+}
+
+// SetIfAbsent sets the value only if the key does not exist in the cache,
+// in the queue, or in the store. Errors of the store are treated as absence.
+func (w *WriteBehind[K, V]) SetIfAbsent(key K, value V) (V, bool) {
+	return w.setIf(key, value, false)
+}
+
+func (w *WriteBehind[K, V]) setIf(key K, value V, ifPresent bool) (V, bool) {
+	old, err := w.Get(key)
+	present := err == nil
+
+	w.mux.Lock()
+	// Key could be written after Get.
+	if v, p, ok := w.lookup(key); ok {
+		old, present = v, p
+	}
+	if present != ifPresent {
+		w.mux.Unlock()
+		return old, false
+	}
+
+	w.cache.Set(key, value)
+	w.enqueue(key, writeOp[V]{value: value})
+	queued := len(w.pending)
+	w.mux.Unlock()
+
+	w.maybeKick(queued)
+	return old, true
+}
+
+// Get returns the value from the cache. On cache miss the value of the
+// queued write is returned, or the value is loaded from the store and set
+// to the cache. Only one Load per key runs at the same time,
+// and at most PoolSize in total.
+func (w *WriteBehind[K, V]) Get(key K) (V, error) {
+	if v, err := w.cache.Get(key); err == nil {
+		return v, nil
+	}
+
+	w.gate.acquire(key)
+	defer w.gate.release(key)
+
+	return w.load(key)
+}
+
+// load loads the value from the store and sets it to the cache.
+// If the key was written while loading, the loaded value is outdated,
+// and the last written one is returned instead. Caller must acquire the key.
+func (w *WriteBehind[K, V]) load(key K) (V, error) {
+	w.mux.Lock()
+	if v, present, ok := w.lookup(key); ok {
+		w.mux.Unlock()
+		if !present {
+			return v, ErrNotFound
+		}
+		return v, nil
+	}
+	w.loading[key] = nil
+	w.mux.Unlock()
+
+	v, err := w.store.Load(key)
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	written := w.loading[key]
+	delete(w.loading, key)
+	if written != nil {
+		if written.del {
+			var zero V
+			return zero, ErrNotFound
+		}
+		return written.value, nil
+	}
+	if err == nil {
+		w.cache.Set(key, v)
+	}
+
+	return v, err
+}
+
+// Del deletes the key from the cache and queues the deletion from the store.
+func (w *WriteBehind[K, V]) Del(key K) error {
+	w.mux.Lock()
+	err := w.cache.Del(key)
+	w.enqueue(key, writeOp[V]{del: true})
+	queued := len(w.pending)
+	w.mux.Unlock()
+
+	w.maybeKick(queued)
+	return err
+}
+
+// Flush writes all queued writes to the store and waits for them to finish.
+// Failed writes are retried up to MaxRetries times, and then dropped.
+// Returns the error of the last attempt if some writes were dropped.
+func (w *WriteBehind[K, V]) Flush() error {
+	w.flushMux.Lock()
+	defer w.flushMux.Unlock()
+
+	w.mux.Lock()
+	batch := w.pending
+	w.pending = make(map[K]writeOp[V])
+	w.flushing = batch
+	w.mux.Unlock()
+
+	var err error
+	for attempt := 0; len(batch) > 0; attempt++ {
+		if attempt > 0 {
+			time.Sleep(w.opts.RetryDelay << (attempt - 1))
+		}
+		batch, err = w.write(batch)
+		if attempt == w.opts.MaxRetries {
+			break
+		}
+	}
+
+	w.mux.Lock()
+	w.flushing = nil
+	w.mux.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if w.opts.OnError != nil {
+		w.opts.OnError(slices.Collect(maps.Keys(batch)), err)
+	}
+
+	return err
+}
+
+// write writes the batch to the store.
+// Returns failed writes and the first error.
+func (w *WriteBehind[K, V]) write(batch map[K]writeOp[V]) (map[K]writeOp[V], error) {
+	failed := make(map[K]writeOp[V])
+
+	if bs, ok := w.store.(BatchStore[K, V]); ok {
+		records := make(map[K]V, len(batch))
+		var deleted []K
+		for key, op := range batch {
+			if op.del {
+				deleted = append(deleted, key)
+			} else {
+				records[key] = op.value
+			}
+		}
+
+		var errs []error
+		if len(records) > 0 {
+			if err := bs.StoreBatch(records); err != nil {
+				errs = append(errs, err)
+				for key, value := range records {
+					failed[key] = writeOp[V]{value: value}
+				}
+			}
+		}
+		if len(deleted) > 0 {
+			if err := bs.DeleteBatch(deleted); err != nil {
+				errs = append(errs, err)
+				for _, key := range deleted {
+					failed[key] = writeOp[V]{del: true}
+				}
+			}
+		}
+
+		return failed, errors.Join(errs...)
+	}
+
+	var (
+		mux      sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+		pool     = make(chan struct{}, w.opts.PoolSize)
+	)
+	for key, op := range batch {
+		// Put token in the pool. Will wait if pool is full.
+		pool <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-pool
+				wg.Done()
+			}()
+
+			var err error
+			if op.del {
+				err = w.store.Delete(key)
+			} else {
+				err = w.store.Store(key, op.value)
+			}
+			if err != nil {
+				mux.Lock()
+				failed[key] = op
+				if firstErr == nil {
+					firstErr = err
+				}
+				mux.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return failed, firstErr
+}
+
+// Close stops the background goroutine and flushes queued writes.
+// Writes after Close are flushed synchronously by Set, Del and other
+// writing methods, errors are reported to OnError.
+func (w *WriteBehind[K, V]) Close() error {
+	w.closeOnce.Do(func() {
+		w.stopped.Store(true)
+		close(w.done)
+	})
+	w.wg.Wait()
+
+	return w.Flush()
+}
+
+// Snapshot returns a shallow copy of the cache. The store is not read.
+func (w *WriteBehind[K, V]) Snapshot() map[K]V {
+	return w.cache.Snapshot()
+}
+
+// Len returns the number of records in the cache.
+func (w *WriteBehind[K, V]) Len() int {
+	return w.cache.Len()
+}
+
+// Clear removes all records from the cache.
+// The store is not affected, and queued writes are still flushed.
+func (w *WriteBehind[K, V]) Clear() {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.cache.Clear()
+}
+
+// All is an iterator over all key-value pairs in the underlying cache.
+// Iteration does not read the store. Locking rules of the underlying cache apply.
+func (w *WriteBehind[K, V]) All() iter.Seq2[K, V] {
+	return all(w.cache)
+}
+
+// Keys is an iterator over all keys in the underlying cache.
+// Same rules as for All apply.
+func (w *WriteBehind[K, V]) Keys() iter.Seq[K] {
+	return keysOf(w.All())
+}
+
+// Values is an iterator over all values in the underlying cache.
+// Same rules as for All apply.
+func (w *WriteBehind[K, V]) Values() iter.Seq[V] {
+	return valuesOf(w.All())
+}